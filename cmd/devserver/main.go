@@ -0,0 +1,358 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/google/uuid"
+	logger "github.com/sirupsen/logrus"
+
+	"poc-ddb-tidb-search/pkg/api"
+	"poc-ddb-tidb-search/pkg/changefeed"
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/db/localsql"
+	"poc-ddb-tidb-search/pkg/pipeline"
+	queue "poc-ddb-tidb-search/pkg/sqs"
+)
+
+// the sync queue only lives in this process, the url just has to look like the fifo queue
+const syncQueueURL = "https://sqs.local/devserver-sync.fifo"
+
+type apiHandler func(context.Context, events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error)
+
+// stores are the tables behind the handlers, connect opens TiDB for a search request
+type stores struct {
+	jobs    db.DB
+	saved   db.DB // optional
+	tiDB    db.DB
+	connect func() (db.DB, error)
+	close   func()
+}
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	memory := flag.Bool("memory", false, "keep the jobs in memory and the search tables in an embedded sql server instead of the dynamodb tables and the TiDB cluster")
+	jobTable := flag.String("table", os.Getenv("POC_TABLE"), "dynamodb table of the jobs")
+	savedSearchTable := flag.String("saved-search-table", os.Getenv("SAVED_SEARCH_TABLE"), "dynamodb table of the saved searches, optional")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var st *stores
+	var err error
+	if *memory {
+		st, err = newMemoryStores(ctx)
+	} else {
+		st, err = newAWSStores(ctx, *jobTable, *savedSearchTable)
+	}
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "StoreErr",
+		}).Fatal("failed to open the dev server tables")
+	}
+	defer st.close()
+
+	srv := &http.Server{Addr: *addr, Handler: newServer(ctx, st)}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdown)
+	}()
+
+	logger.WithFields(logger.Fields{"addr": *addr, "memory": *memory}).Info("dev server listening")
+	if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.WithFields(logger.Fields{"error": err.Error(), "code": "HTTPErr"}).Fatal("dev server failed")
+	}
+}
+
+// newMemoryStores keeps the jobs and saved searches in memory and the search tables in an embedded
+// mysql compatible server migrated to the latest schema, everything is lost on exit
+func newMemoryStores(ctx context.Context) (*stores, error) {
+	jobs := db.NewMemoryDDB()
+	if err := jobs.SetTableName("jobs"); err != nil {
+		return nil, err
+	}
+	saved := db.NewMemoryDDB()
+	if err := saved.SetTableName("saved-searches"); err != nil {
+		return nil, err
+	}
+
+	dsn, stopSQL, err := localsql.Start(db.TiDB_DatabaseName)
+	if err != nil {
+		return nil, err
+	}
+	connect := func() (db.DB, error) {
+		conn, err := sql.Open("mysql", dsn)
+		if err != nil {
+			return nil, err
+		}
+		return db.NewTiDBFromConn(conn), nil
+	}
+
+	tiDB, err := connect()
+	if err == nil {
+		err = migrate(ctx, tiDB)
+	}
+	if err != nil {
+		stopSQL()
+		return nil, err
+	}
+
+	return &stores{
+		jobs:    jobs,
+		saved:   saved,
+		tiDB:    tiDB,
+		connect: connect,
+		close: func() {
+			_ = tiDB.Close()
+			stopSQL()
+		},
+	}, nil
+}
+
+func migrate(ctx context.Context, tiDB db.DB) error {
+	migrator, err := db.NewMigrator(tiDB.GetTiDBConn())
+	if err != nil {
+		return err
+	}
+	_, err = migrator.Up(ctx, 0)
+	return err
+}
+
+// newAWSStores uses the dynamodb tables and the TiDB cluster, the schema is left to cmd/migrate
+func newAWSStores(ctx context.Context, jobTable, savedSearchTable string) (*stores, error) {
+	jobs := db.NewDDB(ctx)
+	if err := jobs.SetTableName(jobTable); err != nil {
+		return nil, fmt.Errorf("invalid job table name, set -table or POC_TABLE: %v", err)
+	}
+
+	tiDB, err := db.NewTiDB(db.TiDB_DatabaseName)
+	if err != nil {
+		return nil, err
+	}
+
+	st := &stores{
+		jobs:    jobs,
+		tiDB:    tiDB,
+		connect: func() (db.DB, error) { return db.NewTiDB(db.TiDB_DatabaseName) },
+		close:   func() { _ = tiDB.Close() },
+	}
+	if savedSearchTable != "" {
+		saved := db.NewDDB(ctx)
+		if err := saved.SetTableName(savedSearchTable); err == nil {
+			st.saved = saved
+		}
+	}
+
+	return st, nil
+}
+
+// newServer wires the handlers to the stores. The job writes feed the outbox instead of the table
+// stream, and the stream receiver sends to an in-memory queue read by the TiDB sync, both run
+// until the context is done
+func newServer(ctx context.Context, st *stores) http.Handler {
+	outbox := changefeed.NewOutbox()
+	syncQueue := newChanQueue(1000)
+	receiver := &pipeline.StreamReceiver{Client: syncQueue, QueueURL: syncQueueURL}
+	syncer := &pipeline.Syncer{TiDB: st.tiDB}
+
+	search := &api.Search{Connect: st.connect}
+	if st.saved != nil {
+		search.SavedSearches = st.saved
+		syncer.SavedSearches = st.saved
+	}
+
+	go func() {
+		if err := outbox.Run(ctx, receiver.Handle); err != nil && !errors.Is(err, context.Canceled) {
+			logger.WithFields(logger.Fields{"error": err.Error(), "code": "StreamErr"}).Error("change feed stopped")
+		}
+	}()
+	go syncQueue.consume(ctx, syncer.Handle)
+
+	shipments := &api.Shipments{Jobs: changefeed.NewTable(st.jobs, outbox)}
+
+	mux := http.NewServeMux()
+	mux.Handle("/shipments", lambdaHandler("/shipments", shipments.Handle, http.MethodPost))
+	mux.Handle("/search", lambdaHandler("/search", search.Handle, http.MethodGet, http.MethodPost))
+	mux.Handle("/dead-letters", deadLetterHandler(syncQueue))
+	return mux
+}
+
+// deadLetterHandler lists the sync messages given up on, like the dead letter queue of the sync
+func deadLetterHandler(q *chanQueue) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(q.deadLetters())
+	})
+}
+
+// lambdaHandler serves an api gateway lambda handler, the request is translated like the rest api
+// proxy integration does. Header names are lower cased as http/2 clients send them
+func lambdaHandler(resource string, handler apiHandler, methods ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := false
+		for _, m := range methods {
+			allowed = allowed || r.Method == m
+		}
+		if !allowed {
+			w.Header().Set("Allow", strings.Join(methods, ", "))
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		req, err := toProxyRequest(r, resource)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		resp, err := handler(r.Context(), *req)
+		if err != nil || resp == nil {
+			// lambda answers a handler error with a 502 through api gateway
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+
+		writeProxyResponse(w, resp)
+	})
+}
+
+func toProxyRequest(r *http.Request, resource string) (*events.APIGatewayProxyRequest, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &events.APIGatewayProxyRequest{
+		Resource:                        resource,
+		Path:                            r.URL.Path,
+		HTTPMethod:                      r.Method,
+		Headers:                         make(map[string]string),
+		MultiValueHeaders:               make(map[string][]string),
+		QueryStringParameters:           make(map[string]string),
+		MultiValueQueryStringParameters: make(map[string][]string),
+		Body:                            string(body),
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID:  uuid.NewString(),
+			HTTPMethod: r.Method,
+			Path:       r.URL.Path,
+			Stage:      "local",
+		},
+	}
+
+	for k, v := range r.Header {
+		name := strings.ToLower(k)
+		req.Headers[name] = v[0]
+		req.MultiValueHeaders[name] = v
+	}
+	for k, v := range r.URL.Query() {
+		req.QueryStringParameters[k] = v[len(v)-1]
+		req.MultiValueQueryStringParameters[k] = v
+	}
+
+	return req, nil
+}
+
+func writeProxyResponse(w http.ResponseWriter, resp *events.APIGatewayProxyResponse) {
+	for k, v := range resp.Headers {
+		w.Header().Set(k, v)
+	}
+	for k, vs := range resp.MultiValueHeaders {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	if w.Header().Get("Content-Type") == "" && resp.Body != "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.WriteString(w, resp.Body)
+}
+
+// chanQueue stands in for the sync queue, sent messages are handed to the consumer in order.
+// Messages failing every attempt are kept as dead letters
+type chanQueue struct {
+	messages  chan events.SQSMessage
+	retryWait time.Duration
+
+	mu   sync.Mutex
+	dead []events.SQSMessage
+}
+
+func newChanQueue(size int) *chanQueue {
+	return &chanQueue{messages: make(chan events.SQSMessage, size), retryWait: time.Second}
+}
+
+// deadLetters returns the messages given up on, oldest first
+func (q *chanQueue) deadLetters() []events.SQSMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return append([]events.SQSMessage{}, q.dead...)
+}
+
+func (q *chanQueue) SendMessage(ctx context.Context, in *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	msg := queue.ToSQSMessage(uuid.NewString(), in)
+
+	select {
+	case q.messages <- msg:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return &sqs.SendMessageOutput{MessageId: aws.String(msg.MessageId)}, nil
+}
+
+// consume hands every message to the handler, failed ones are retried a few times like the
+// queue redrive policy before they are moved to the dead letters
+func (q *chanQueue) consume(ctx context.Context, handler func(context.Context, events.SQSEvent) (*events.SQSEventResponse, error)) {
+	const maxReceiveCount = 3
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-q.messages:
+			for attempt := 1; ; attempt++ {
+				resp, err := handler(ctx, events.SQSEvent{Records: []events.SQSMessage{msg}})
+				if err == nil && len(resp.BatchItemFailures) == 0 {
+					break
+				}
+				if attempt == maxReceiveCount || ctx.Err() != nil {
+					logger.WithFields(logger.Fields{
+						"code":      "SQSErr",
+						"messageID": msg.MessageId,
+					}).Error("moving sync message to the dead letters after failed attempts, see /dead-letters")
+					q.mu.Lock()
+					q.dead = append(q.dead, msg)
+					q.mu.Unlock()
+					break
+				}
+				time.Sleep(q.retryWait)
+			}
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+
+	"poc-ddb-tidb-search/pkg/query"
+)
+
+func TestLambdaHandler(t *testing.T) {
+	var got events.APIGatewayProxyRequest
+	h := lambdaHandler("/search", func(ctx context.Context, req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+		got = req
+		return &events.APIGatewayProxyResponse{StatusCode: http.StatusTeapot, Body: `{"ok":true}`}, nil
+	}, http.MethodGet, http.MethodPost)
+
+	req := httptest.NewRequest(http.MethodPost, "/search?status=new&page=2&page=3", strings.NewReader(`{"filter":{}}`))
+	req.Header.Set("ORGID", "org1")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+	assert.Equal(t, `{"ok":true}`, rec.Body.String())
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	assert.Equal(t, "/search", got.Resource)
+	assert.Equal(t, http.MethodPost, got.HTTPMethod)
+	assert.Equal(t, `{"filter":{}}`, got.Body)
+	assert.Equal(t, "org1", query.GetOrgID(&got))
+	assert.Equal(t, "new", got.QueryStringParameters["status"])
+	assert.Equal(t, "3", got.QueryStringParameters["page"])
+	assert.Equal(t, []string{"2", "3"}, got.MultiValueQueryStringParameters["page"])
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/search", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestChanQueue(t *testing.T) {
+	q := newChanQueue(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := q.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:       aws.String(syncQueueURL),
+		MessageBody:    aws.String("job"),
+		MessageGroupId: aws.String("org1"),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"recordType": {DataType: aws.String("String"), StringValue: aws.String("insert")},
+		},
+	})
+	assert.NoError(t, err)
+
+	received := make(chan events.SQSMessage, 2)
+	attempts := 0
+	go q.consume(ctx, func(ctx context.Context, event events.SQSEvent) (*events.SQSEventResponse, error) {
+		received <- event.Records[0]
+		if attempts++; attempts == 1 {
+			// fail the first delivery
+			return &events.SQSEventResponse{BatchItemFailures: []events.SQSBatchItemFailure{{ItemIdentifier: event.Records[0].MessageId}}}, nil
+		}
+		return &events.SQSEventResponse{}, nil
+	})
+
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-received:
+			assert.Equal(t, "job", msg.Body)
+			assert.Equal(t, "insert", *msg.MessageAttributes["recordType"].StringValue)
+			assert.Equal(t, "org1", msg.Attributes["MessageGroupId"])
+		case <-time.After(3 * time.Second):
+			t.Fatal("message was not delivered again")
+		}
+	}
+}
+
+// TestChanQueueDeadLetters keeps the message failing every attempt and serves it on /dead-letters
+func TestChanQueueDeadLetters(t *testing.T) {
+	q := newChanQueue(10)
+	q.retryWait = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, err := q.SendMessage(ctx, &sqs.SendMessageInput{QueueUrl: aws.String(syncQueueURL), MessageBody: aws.String("job")})
+	assert.NoError(t, err)
+
+	go q.consume(ctx, func(ctx context.Context, event events.SQSEvent) (*events.SQSEventResponse, error) {
+		return nil, errors.New("tidb down")
+	})
+
+	assert.Eventually(t, func() bool { return len(q.deadLetters()) == 1 }, 3*time.Second, 10*time.Millisecond)
+
+	rec := httptest.NewRecorder()
+	deadLetterHandler(q).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/dead-letters", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	dead := make([]events.SQSMessage, 0)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &dead))
+	if assert.Len(t, dead, 1) {
+		assert.Equal(t, "job", dead[0].Body)
+	}
+}
+
+// TestMemoryServer posts a shipment to the memory dev server and finds it through the search once
+// the change feed and the sync have run
+func TestMemoryServer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	st, err := newMemoryStores(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer st.close()
+
+	srv := httptest.NewServer(newServer(ctx, st))
+	defer srv.Close()
+
+	payload, err := os.ReadFile("../../testData/job.json")
+	assert.NoError(t, err)
+	resp, err := http.Post(srv.URL+"/shipments", "application/json", bytes.NewReader(payload))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	search := func() *query.JobSearchResult {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/search?status=unallocated", nil)
+		assert.NoError(t, err)
+		req.Header.Set("orgid", "POC-TEST-ORGID-001122")
+
+		resp, err := http.DefaultClient.Do(req)
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		res := new(query.JobSearchResult)
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(res))
+		return res
+	}
+
+	assert.Eventually(t, func() bool {
+		res := search()
+		return res != nil && res.TotalItems == 1
+	}, 5*time.Second, 50*time.Millisecond)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	logger "github.com/sirupsen/logrus"
+
+	"poc-ddb-tidb-search/pkg/dlq"
+	"poc-ddb-tidb-search/pkg/pipeline"
+	"poc-ddb-tidb-search/pkg/session"
+	queue "poc-ddb-tidb-search/pkg/sqs"
+)
+
+const usage = `usage: dlq -queue <dlq url> [flags] <command>
+
+commands:
+  list     list the messages of the dlq matching the filters
+  redrive  send the matching messages back and delete them from the dlq. Changes of the sync
+           queue dlq go to -to, stream batches are read from the stream again and handed to
+           the stream receiver, which sends their records to -to
+
+flags:
+`
+
+func main() {
+	queueURL := flag.String("queue", "", "url of the dead letter queue")
+	to := flag.String("to", os.Getenv("QUEUE_URL"), "sync queue the messages are redriven to")
+	kind := flag.String("kind", "", "only messages of this kind, change or stream_batch")
+	orgID := flag.String("org", "", "only messages of this org")
+	recordType := flag.String("record-type", "", "only messages of this record type, insert, modify, remove or reconcile")
+	jobID := flag.String("job", "", "only messages of this job id or doc id")
+	max := flag.Int("max", 100, "most messages to read")
+	visibility := flag.Duration("visibility", 30*time.Second, "how long the read messages are hidden from other readers")
+	dryRun := flag.Bool("dry-run", false, "check what redrive would send without sending or deleting")
+	expand := flag.Bool("expand", false, "read the records of the stream batches from the stream, needed to filter them")
+	asJSON := flag.Bool("json", false, "print the messages or outcomes as json")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	ctx := context.Background()
+
+	command := flag.Arg(0)
+	if *queueURL == "" || (command != "list" && command != "redrive") {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	client := queue.NewSQSClient(ctx)
+	if client == nil {
+		logger.WithFields(logger.Fields{
+			"code": "SQSErr",
+		}).Fatal("failed to initialise sqs client")
+	}
+
+	reader := &dlq.Reader{Client: client, QueueURL: *queueURL, Visibility: *visibility}
+	var streams *dynamodbstreams.Client
+	if *expand || command == "redrive" {
+		cfg, success := session.GetSessionConfig(ctx)
+		if !success {
+			logger.WithFields(logger.Fields{
+				"code": "CFGErr",
+			}).Fatal("failed to load aws config")
+		}
+		streams = dynamodbstreams.NewFromConfig(cfg)
+	}
+	if *expand {
+		reader.Streams = streams
+	}
+
+	filter := &dlq.Filter{Kind: *kind, OrgID: *orgID, RecordType: *recordType, JobID: *jobID}
+	messages, err := reader.Read(ctx, filter, *max)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "SQSErr",
+		}).Fatal("failed to read the dlq")
+	}
+
+	if command == "list" {
+		if *asJSON {
+			printJSON(os.Stdout, messages)
+			return
+		}
+		printMessages(os.Stdout, messages)
+		return
+	}
+
+	if *to == "" {
+		logger.WithFields(logger.Fields{
+			"code": "ParamErr",
+		}).Fatal("no queue to redrive to, set -to or QUEUE_URL")
+	}
+
+	receiver := &pipeline.StreamReceiver{Client: client, QueueURL: *to}
+	redriver := &dlq.Redriver{
+		Client:   client,
+		DLQURL:   *queueURL,
+		QueueURL: *to,
+		Streams:  streams,
+		Handler:  receiver.Handle,
+		DryRun:   *dryRun,
+	}
+	outcomes := redriver.Redrive(ctx, messages)
+
+	if *asJSON {
+		printJSON(os.Stdout, outcomes)
+		return
+	}
+	printOutcomes(os.Stdout, outcomes)
+}
+
+func printJSON(out io.Writer, v any) {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
+
+// printMessages lists a line per message, a stream batch has a line per expanded change below it
+func printMessages(out io.Writer, messages []*dlq.Message) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tKIND\tRECORD TYPE\tORG\tJOB\tRECEIVES\tSENT")
+
+	for _, m := range messages {
+		job := ""
+		if j := m.Job(); j != nil {
+			job = j.ID
+		}
+		if m.Batch != nil {
+			job = fmt.Sprintf("%s %s-%s", m.Batch.ShardID, m.Batch.StartSeq, m.Batch.EndSeq)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", m.ID, m.Kind, m.RecordType, m.OrgID, job, m.Receives, m.SentAt.Format(time.RFC3339))
+
+		for _, c := range m.Changes {
+			j := c.Current()
+			fmt.Fprintf(w, "\t\t%s\t%s\t%s\t\t\n", c.EventName, j.OrgID2, j.ID)
+		}
+		if m.Error != "" {
+			fmt.Fprintf(w, "\t\terror: %s\t\t\t\t\n", m.Error)
+		}
+	}
+	_ = w.Flush()
+}
+
+func printOutcomes(out io.Writer, outcomes []*dlq.Outcome) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tKIND\tACTION\tRECORDS\tERROR")
+
+	for _, o := range outcomes {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", o.ID, o.Kind, o.Action, o.Records, o.Error)
+	}
+	_ = w.Flush()
+}
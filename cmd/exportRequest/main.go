@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/export"
+	"poc-ddb-tidb-search/pkg/query"
+	queue "poc-ddb-tidb-search/pkg/sqs"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	logger "github.com/sirupsen/logrus"
+)
+
+var (
+	sqsClient queue.SendMessageClient
+	QueueURL  = ""
+)
+
+func init() {
+	logger.SetFormatter(&logger.JSONFormatter{})
+	QueueURL = os.Getenv("EXPORT_QUEUE_URL")
+}
+
+func handler(ctx context.Context, request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	params, err := query.ParametersFromRequest(&request)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "ParamsErr",
+		}).Error("failed to parse request parameters")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusBadRequest,
+		}, nil
+	}
+
+	format, err := export.ParseFormat(request.QueryStringParameters["format"])
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "ParamsErr",
+		}).Error("invalid export format")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusBadRequest,
+		}, nil
+	}
+
+	orgID := query.GetOrgID(&request)
+
+	job, err := export.NewExportJob(orgID, format, params)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "JSONErr",
+		}).Error("failed to create export job")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	if err := initSQSClient(ctx); err != nil {
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	tiDB, err := db.NewTiDB(db.TiDB_DatabaseName)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TiDBErr",
+		}).Error("failed to connect to TiDB instance")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	defer tiDB.Close()
+
+	if err := db.SaveExportJob(tiDB, job); err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TiDBErr",
+		}).Error("failed to save export job")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	if err := export.Enqueue(ctx, sqsClient, QueueURL, job); err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "SQSErr",
+		}).Error("failed to send export job to queue")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	jsonRes, err := json.Marshal(job)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "JSONErr",
+		}).Error("failed to marshal export job")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: http.StatusAccepted,
+		Body:       string(jsonRes),
+	}, nil
+}
+
+func initSQSClient(ctx context.Context) error {
+	if sqsClient != nil {
+		return nil
+	}
+
+	client := queue.NewSQSClient(ctx)
+	if client == nil {
+		logger.WithFields(logger.Fields{
+			"error": "failed to initialise sqs client",
+			"code":  "SQSErr",
+		}).Error("failed to initialise sqs client")
+		return errors.New("failed to initialise sqs client")
+	}
+
+	sqsClient = client
+	return nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
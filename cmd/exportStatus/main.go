@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/query"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	logger "github.com/sirupsen/logrus"
+)
+
+func init() {
+	logger.SetFormatter(&logger.JSONFormatter{})
+}
+
+func handler(ctx context.Context, request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	id := request.PathParameters["id"]
+	orgID := query.GetOrgID(&request)
+	if id == "" || orgID == "" {
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusBadRequest,
+		}, nil
+	}
+
+	tiDB, err := db.NewTiDB(db.TiDB_DatabaseName)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TiDBErr",
+		}).Error("failed to connect to TiDB instance")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	defer tiDB.Close()
+
+	job, err := db.GetExportJob(tiDB, orgID, id)
+	if errors.Is(err, db.ErrExportJobNotFound) {
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusNotFound,
+		}, nil
+	}
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TiDBErr",
+		}).Error("failed to fetch export job")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	jsonRes, err := json.Marshal(job)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "JSONErr",
+		}).Error("failed to marshal export job")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Body:       string(jsonRes),
+	}, nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
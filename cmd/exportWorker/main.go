@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"poc-ddb-tidb-search/pkg/blob"
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/export"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	logger "github.com/sirupsen/logrus"
+)
+
+func init() {
+	logger.SetFormatter(&logger.JSONFormatter{})
+}
+
+func handler(ctx context.Context, event events.SQSEvent) (*events.SQSEventResponse, error) {
+	store, err := blob.NewStoreFromEnv(ctx)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "BlobErr",
+		}).Error("failed to initialise blob store")
+		return nil, err
+	}
+
+	tiDB, err := db.NewTiDB(db.TiDB_DatabaseName)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TiDBErr",
+		}).Error("failed to connect to TiDB instance")
+		return nil, err
+	}
+	defer tiDB.Close()
+
+	failures := make([]events.SQSBatchItemFailure, 0, len(event.Records))
+	for _, record := range event.Records {
+		if err := runExport(ctx, &record, tiDB, store); err != nil {
+			failures = append(failures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+		}
+	}
+
+	return &events.SQSEventResponse{
+		BatchItemFailures: failures,
+	}, nil
+}
+
+func runExport(ctx context.Context, record *events.SQSMessage, tiDB db.DB, store blob.Store) error {
+	msg := new(export.Message)
+	if err := json.Unmarshal([]byte(record.Body), msg); err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "SQSParseErr",
+			"body":  record.Body,
+		}).Error("failed to parse sqs message")
+		return err
+	}
+
+	job, err := db.GetExportJob(tiDB, msg.OrgID, msg.ID)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TiDBErr",
+			"id":    msg.ID,
+		}).Error("failed to fetch export job")
+		return err
+	}
+
+	if job.Status == db.ExportStatusCompleted {
+		return nil
+	}
+
+	job.Status = db.ExportStatusRunning
+	if err := db.SaveExportJob(tiDB, job); err != nil {
+		return err
+	}
+
+	if err := export.Run(ctx, tiDB, store, job); err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "ExportErr",
+			"id":    job.ID,
+		}).Error("failed to export jobs")
+
+		job.Status = db.ExportStatusFailed
+		job.Error = err.Error()
+		_ = db.SaveExportJob(tiDB, job)
+		return err
+	}
+
+	job.Status = db.ExportStatusCompleted
+	job.Error = ""
+	return db.SaveExportJob(tiDB, job)
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	logger "github.com/sirupsen/logrus"
+
+	"poc-ddb-tidb-search/pkg/advisor"
+	"poc-ddb-tidb-search/pkg/db"
+)
+
+func main() {
+	database := flag.String("database", db.TiDB_DatabaseName, "TiDB database of the search tables")
+	maxFilters := flag.Int("max-filters", 2, "explain every combination of up to this many filters")
+	orgID := flag.String("org", "POC-TEST-ORGID-001122", "org id of the explained searches")
+	asJSON := flag.Bool("json", false, "print the plan of every case as json")
+	flag.Parse()
+
+	tiDB, err := db.NewTiDB(*database)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TiDBErr",
+		}).Fatal("failed to connect to TiDB instance")
+	}
+	defer tiDB.Close()
+
+	adv := &advisor.Advisor{DB: tiDB.GetTiDBConn(), Database: *database}
+	report, err := adv.Run(context.Background(), advisor.Combinations(advisor.Filters, *maxFilters, *orgID))
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TiDBErr",
+		}).Fatal("failed to explain the searches")
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(report)
+		return
+	}
+	printReport(os.Stdout, report)
+}
+
+// printReport lists the cases with full table scans, partly matching indexes or failing explains,
+// then the indexes no plan used
+func printReport(out io.Writer, report *advisor.Report) {
+	fullScans, partial, failed := 0, 0, 0
+
+	for _, c := range report.Cases {
+		if len(c.FullScans) == 0 && len(c.Partial) == 0 && c.Error == "" {
+			continue
+		}
+
+		fmt.Fprintf(out, "%s\n", c.Name)
+		if c.Error != "" {
+			failed++
+			fmt.Fprintf(out, "  explain failed: %s\n", c.Error)
+		}
+		if len(c.FullScans) > 0 {
+			fullScans++
+			fmt.Fprintf(out, "  full scan: %s\n", strings.Join(c.FullScans, ", "))
+		}
+		if len(c.Partial) > 0 {
+			partial++
+		}
+		for _, p := range c.Partial {
+			fmt.Fprintf(out, "  partial: %s\n", p)
+		}
+	}
+
+	fmt.Fprintf(out, "\n%d cases, %d with full scans, %d with partly matching indexes, %d failed\n",
+		len(report.Cases), fullScans, partial, failed)
+
+	if len(report.UnusedIndexes) > 0 {
+		fmt.Fprintln(out, "unused indexes:")
+		for _, index := range report.UnusedIndexes {
+			fmt.Fprintf(out, "  %s\n", index)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	logger "github.com/sirupsen/logrus"
+
+	"poc-ddb-tidb-search/pkg/db"
+)
+
+const usage = `usage: migrate [-database name] <command>
+
+commands:
+  up [n]           apply the pending migrations, at most n
+  down [n]         revert the last n applied migrations, 1 by default
+  status           list the migrations and whether they are applied
+  force <version>  mark a migration applied and clean, after fixing a failed one by hand
+`
+
+func main() {
+	database := flag.String("database", db.TiDB_DatabaseName, "TiDB database of the search tables")
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+
+	tiDB, err := db.NewTiDB(*database)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TiDBErr",
+		}).Fatal("failed to connect to TiDB instance")
+	}
+	defer tiDB.Close()
+
+	migrator, err := db.NewMigrator(tiDB.GetTiDBConn())
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "MigrationErr",
+		}).Fatal("failed to load migrations")
+	}
+
+	if err := run(context.Background(), migrator, flag.Args(), os.Stdout); err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "MigrationErr",
+		}).Fatal("migration failed")
+	}
+}
+
+func run(ctx context.Context, migrator *db.Migrator, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing command\n%s", usage)
+	}
+
+	n, err := countArg(args[1:])
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up(ctx, n)
+		printMigrations(out, "applied", done)
+		return err
+	case "down":
+		if n == 0 {
+			n = 1
+		}
+		done, err := migrator.Down(ctx, n)
+		printMigrations(out, "reverted", done)
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		printStatus(out, statuses)
+		return nil
+	case "force":
+		if n == 0 {
+			return fmt.Errorf("force needs a version\n%s", usage)
+		}
+		return migrator.Force(ctx, n)
+	}
+
+	return fmt.Errorf("unknown command %s\n%s", args[0], usage)
+}
+
+// countArg parses the optional number after the command, 0 if there is none
+func countArg(args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, nil
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid number %s\n%s", args[0], usage)
+	}
+	return n, nil
+}
+
+func printMigrations(out io.Writer, action string, migrations []*db.Migration) {
+	if len(migrations) == 0 {
+		fmt.Fprintf(out, "no migrations %s\n", action)
+	}
+	for _, m := range migrations {
+		fmt.Fprintf(out, "%s %04d_%s\n", action, m.Version, m.Name)
+	}
+}
+
+func printStatus(out io.Writer, statuses []*db.MigrationStatus) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATE\tAPPLIED AT")
+
+	for _, s := range statuses {
+		state, appliedAt := "pending", ""
+		if s.Applied {
+			state, appliedAt = "applied", s.AppliedAt.Format(time.RFC3339)
+		}
+		if s.Dirty {
+			state = "dirty"
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+	}
+	_ = w.Flush()
+}
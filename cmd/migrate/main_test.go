@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"poc-ddb-tidb-search/pkg/db"
+)
+
+func TestRunArgs(t *testing.T) {
+	ctx := context.Background()
+	migrator := &db.Migrator{}
+	out := new(bytes.Buffer)
+
+	assert.ErrorContains(t, run(ctx, migrator, nil, out), "missing command")
+	assert.ErrorContains(t, run(ctx, migrator, []string{"sideways"}, out), "unknown command")
+	assert.ErrorContains(t, run(ctx, migrator, []string{"down", "-1"}, out), "invalid number")
+	assert.ErrorContains(t, run(ctx, migrator, []string{"force"}, out), "needs a version")
+	assert.ErrorContains(t, run(ctx, migrator, []string{"up"}, out), "no database connection")
+}
+
+func TestPrintStatus(t *testing.T) {
+	out := new(bytes.Buffer)
+	printStatus(out, []*db.MigrationStatus{
+		{Version: 1, Name: "search_tables", Applied: true, AppliedAt: time.Date(2023, 3, 20, 10, 0, 0, 0, time.UTC)},
+		{Version: 2, Name: "street_idx", Applied: true, Dirty: true, AppliedAt: time.Date(2023, 3, 21, 10, 0, 0, 0, time.UTC)},
+		{Version: 3, Name: "status_idx"},
+	})
+
+	assert.Equal(t, "VERSION  NAME           STATE    APPLIED AT\n"+
+		"0001     search_tables  applied  2023-03-20T10:00:00Z\n"+
+		"0002     street_idx     dirty    2023-03-21T10:00:00Z\n"+
+		"0003     status_idx     pending  \n", out.String())
+
+	out.Reset()
+	printMigrations(out, "applied", nil)
+	assert.Equal(t, "no migrations applied\n", out.String())
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	logger "github.com/sirupsen/logrus"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/reconcile"
+	queue "poc-ddb-tidb-search/pkg/sqs"
+)
+
+func main() {
+	table := flag.String("table", os.Getenv("POC_TABLE"), "dynamodb table of the jobs")
+	database := flag.String("database", db.TiDB_DatabaseName, "TiDB database of the search tables")
+	orgs := flag.String("orgs", "", "comma separated org ids to compare")
+	repair := flag.Bool("repair", false, "queue the drifted jobs for the sync to replace or delete their rows")
+	queueURL := flag.String("queue-url", os.Getenv("QUEUE_URL"), "sync queue the repairs are sent to")
+	asJSON := flag.Bool("json", false, "print the reports as json")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	if *orgs == "" {
+		logger.WithFields(logger.Fields{
+			"code": "ParamErr",
+		}).Fatal("no orgs to reconcile, set -orgs")
+	}
+
+	ddb := db.NewDDB(ctx)
+	if err := ddb.SetTableName(*table); err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TablenameErr",
+		}).Fatal("invalid job table name, set -table or POC_TABLE")
+	}
+
+	tiDB, err := db.NewTiDB(*database)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TiDBErr",
+		}).Fatal("failed to connect to TiDB instance")
+	}
+	defer tiDB.Close()
+
+	r := &reconcile.Reconciler{DDB: ddb, TiDB: tiDB, QueueURL: *queueURL}
+	if *repair {
+		client := queue.NewSQSClient(ctx)
+		if client == nil {
+			logger.WithFields(logger.Fields{
+				"code": "SQSErr",
+			}).Fatal("failed to initialise sqs client")
+		}
+		r.Client = client
+	}
+
+	reports := make([]*reconcile.Report, 0)
+	for _, orgID := range strings.Split(*orgs, ",") {
+		report, err := r.Org(ctx, strings.TrimSpace(orgID))
+		if err != nil {
+			logger.WithFields(logger.Fields{
+				"error": err.Error(),
+				"code":  "ReconcileErr",
+				"orgID": orgID,
+			}).Fatal("failed to reconcile org")
+		}
+		reports = append(reports, report)
+
+		if !*repair {
+			continue
+		}
+		repaired, err := r.Repair(ctx, report.Drifts)
+		if err != nil {
+			logger.WithFields(logger.Fields{
+				"error": err.Error(),
+				"code":  "SQSErr",
+				"orgID": orgID,
+			}).Fatal("failed to queue repairs")
+		}
+		logger.WithFields(logger.Fields{
+			"orgID":    orgID,
+			"repaired": repaired,
+		}).Info("repairs queued")
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(reports)
+		return
+	}
+	printReports(os.Stdout, reports)
+}
+
+// printReports lists the drifts of every org after a line with its counts
+func printReports(out io.Writer, reports []*reconcile.Report) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	for _, report := range reports {
+		fmt.Fprintf(w, "%s: %d jobs, %d rows, %d drifted\n", report.OrgID, report.Jobs, report.Rows, len(report.Drifts))
+		for _, d := range report.Drifts {
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", d.Kind, d.JobID, strings.Join(d.UUIDs, ","))
+		}
+	}
+	_ = w.Flush()
+}
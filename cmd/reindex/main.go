@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	logger "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/reindex"
+	"poc-ddb-tidb-search/pkg/session"
+)
+
+func main() {
+	table := flag.String("table", os.Getenv("POC_TABLE"), "dynamodb table of the jobs")
+	database := flag.String("database", db.TiDB_DatabaseName, "TiDB database of the search tables")
+	segments := flag.Int("segments", 4, "parallel scan segments")
+	pageSize := flag.Int("page-size", 100, "jobs per scan page, each page is written in one transaction")
+	rps := flag.Float64("rps", 10, "scan requests per second of all segments, 0 for no limit")
+	checkpoint := flag.String("checkpoint", "reindex-checkpoint.json", "progress file, an unfinished reindex resumes from it")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cfg, success := session.GetSessionConfig(ctx)
+	if !success {
+		logger.WithFields(logger.Fields{
+			"code": "CFGErr",
+		}).Fatal("failed to load aws config")
+	}
+
+	tiDB, err := db.NewTiDB(*database)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TiDBErr",
+		}).Fatal("failed to connect to TiDB instance")
+	}
+	defer tiDB.Close()
+
+	limiter := rate.NewLimiter(rate.Inf, 1)
+	if *rps > 0 {
+		limiter = rate.NewLimiter(rate.Limit(*rps), 1)
+	}
+
+	r := &reindex.Reindexer{
+		Client:      dynamodb.NewFromConfig(cfg),
+		Table:       *table,
+		TiDB:        tiDB,
+		Segments:    *segments,
+		PageSize:    int32(*pageSize),
+		Limiter:     limiter,
+		Checkpoints: &reindex.CheckpointFile{Path: *checkpoint},
+	}
+
+	stats, err := r.Run(ctx)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "ReindexErr",
+		}).Fatal("reindex stopped, run again to resume from the checkpoint")
+	}
+
+	logger.WithFields(logger.Fields{
+		"scanned": stats.Scanned,
+		"indexed": stats.Indexed,
+		"skipped": stats.Skipped,
+	}).Info("reindex finished")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/query"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	logger "github.com/sirupsen/logrus"
+)
+
+func init() {
+	logger.SetFormatter(&logger.JSONFormatter{})
+}
+
+func handler(ctx context.Context, request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	var start = time.Now()
+
+	params, err := query.ReportParametersFromRequest(&request)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "ParamsErr",
+		}).Error("failed to parse report parameters")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusBadRequest,
+		}, nil
+	}
+
+	orgID := query.GetOrgID(&request)
+
+	tiDB, err := db.NewTiDB(db.TiDB_DatabaseName)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TiDBErr",
+		}).Error("failed to connect to TiDB instance")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	defer tiDB.Close()
+
+	res, err := reportInTiDB(tiDB, params, orgID, start)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TiDBErr",
+		}).Error("failed to query TiDB")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	jsonRes, err := json.Marshal(res)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "JSONErr",
+		}).Error("failed to marshal report")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Body:       string(jsonRes),
+	}, nil
+}
+
+func reportInTiDB(tiDB db.DB, params *query.ReportParams, orgID string, start time.Time) (*query.ReportResult, error) {
+	res, err := tiDB.Search(db.MakeReportSQLStatement(params, orgID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &query.ReportResult{
+		Bucket:       params.Bucket,
+		GroupBy:      params.GroupBy,
+		Metric:       params.Metric,
+		Rows:         res.(*db.TiDBResult).Report,
+		ResponseTime: time.Since(start).String(),
+	}, nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
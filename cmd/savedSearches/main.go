@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/query"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/google/uuid"
+	logger "github.com/sirupsen/logrus"
+)
+
+var (
+	tableName = ""
+)
+
+func init() {
+	logger.SetFormatter(&logger.JSONFormatter{})
+	tableName = os.Getenv("SAVED_SEARCH_TABLE")
+}
+
+type savedSearchBody struct {
+	Name   string                 `json:"name"`
+	Params *query.JobSearchParams `json:"params"`
+}
+
+func handler(ctx context.Context, request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	ddb := db.NewDDB(ctx)
+	if err := ddb.SetTableName(tableName); err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TablenameErr",
+		}).Error("invalid table name")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	return handle(ctx, request, ddb)
+}
+
+// handle serves the request with the table, which tests can swap for db.NewMemoryDDB
+func handle(ctx context.Context, request events.APIGatewayProxyRequest, ddb db.DB) (*events.APIGatewayProxyResponse, error) {
+	orgID := query.GetOrgID(&request)
+	userID := query.GetUserID(&request)
+	if orgID == "" || userID == "" {
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusBadRequest,
+		}, nil
+	}
+
+	id := request.PathParameters["id"]
+
+	var (
+		status int
+		res    any
+		err    error
+	)
+
+	isWatch := strings.HasSuffix(request.Resource, "/watch")
+
+	switch {
+	case isWatch && request.HTTPMethod == http.MethodPut && id != "":
+		status, res, err = setWatch(ddb, orgID, userID, id, request.Body)
+	case isWatch && request.HTTPMethod == http.MethodDelete && id != "":
+		status, res, err = removeWatch(ddb, orgID, userID, id)
+	case isWatch:
+		status = http.StatusMethodNotAllowed
+	case request.HTTPMethod == http.MethodPost && id == "":
+		status, res, err = createSavedSearch(ddb, orgID, userID, request.Body)
+	case request.HTTPMethod == http.MethodGet && id == "":
+		status, res, err = listSavedSearches(ddb, orgID, userID)
+	case request.HTTPMethod == http.MethodGet:
+		status, res, err = getSavedSearch(ddb, orgID, userID, id)
+	case request.HTTPMethod == http.MethodPut && id != "":
+		status, res, err = updateSavedSearch(ddb, orgID, userID, id, request.Body)
+	case request.HTTPMethod == http.MethodDelete && id != "":
+		status, res, err = deleteSavedSearch(ddb, orgID, userID, id)
+	default:
+		status = http.StatusMethodNotAllowed
+	}
+
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "DDBErr",
+		}).Error("failed to process saved search request")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	if res == nil {
+		return &events.APIGatewayProxyResponse{
+			StatusCode: status,
+		}, nil
+	}
+
+	jsonRes, err := json.Marshal(res)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "JSONErr",
+		}).Error("failed to marshal saved search")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Body:       string(jsonRes),
+	}, nil
+}
+
+// parseBody reads and validates the name and params of a saved search
+func parseBody(body string) (*savedSearchBody, error) {
+	b := new(savedSearchBody)
+	if err := json.Unmarshal([]byte(body), b); err != nil {
+		return nil, err
+	}
+
+	if b.Name == "" {
+		return nil, errors.New("missing name")
+	}
+	if b.Params == nil {
+		return nil, errors.New("missing params")
+	}
+	if err := b.Params.Validate(); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func createSavedSearch(ddb db.DB, orgID, userID, body string) (int, any, error) {
+	b, err := parseBody(body)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "ParseErr",
+		}).Error("failed to parse request body")
+		return http.StatusBadRequest, nil, nil
+	}
+
+	now := time.Now().UTC()
+	s := &db.SavedSearch{
+		OrgID:     orgID,
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Name:      b.Name,
+		Params:    b.Params,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := db.SaveSavedSearch(ddb, s); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, s, nil
+}
+
+func listSavedSearches(ddb db.DB, orgID, userID string) (int, any, error) {
+	list, err := db.ListSavedSearches(ddb, orgID, userID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, list, nil
+}
+
+func getSavedSearch(ddb db.DB, orgID, userID, id string) (int, any, error) {
+	s, err := db.GetSavedSearch(ddb, orgID, userID, id)
+	if errors.Is(err, db.ErrSavedSearchNotFound) {
+		return http.StatusNotFound, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, s, nil
+}
+
+func updateSavedSearch(ddb db.DB, orgID, userID, id, body string) (int, any, error) {
+	b, err := parseBody(body)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "ParseErr",
+		}).Error("failed to parse request body")
+		return http.StatusBadRequest, nil, nil
+	}
+
+	s, err := db.GetSavedSearch(ddb, orgID, userID, id)
+	if errors.Is(err, db.ErrSavedSearchNotFound) {
+		return http.StatusNotFound, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	s.Name = b.Name
+	s.Params = b.Params
+	s.UpdatedAt = time.Now().UTC()
+
+	if err := db.SaveSavedSearch(ddb, s); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, s, nil
+}
+
+func deleteSavedSearch(ddb db.DB, orgID, userID, id string) (int, any, error) {
+	if _, err := db.GetSavedSearch(ddb, orgID, userID, id); errors.Is(err, db.ErrSavedSearchNotFound) {
+		return http.StatusNotFound, nil, nil
+	} else if err != nil {
+		return 0, nil, err
+	}
+
+	if err := db.DeleteSavedSearch(ddb, orgID, userID, id); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+// parseWatch reads the sink of a watch. Webhook watches take no url, they are delivered to the
+// org endpoints registered with /webhooks
+func parseWatch(body string) (*db.SearchWatch, error) {
+	w := new(db.SearchWatch)
+	dec := json.NewDecoder(strings.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(w); err != nil {
+		return nil, err
+	}
+
+	switch w.Sink {
+	case db.WatchSinkSQS, db.WatchSinkWebhook:
+	default:
+		return nil, errors.New("sink must be sqs or webhook")
+	}
+
+	return w, nil
+}
+
+func setWatch(ddb db.DB, orgID, userID, id, body string) (int, any, error) {
+	w, err := parseWatch(body)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "ParseErr",
+		}).Error("failed to parse request body")
+		return http.StatusBadRequest, nil, nil
+	}
+
+	return changeWatch(ddb, orgID, userID, id, w)
+}
+
+func removeWatch(ddb db.DB, orgID, userID, id string) (int, any, error) {
+	return changeWatch(ddb, orgID, userID, id, nil)
+}
+
+func changeWatch(ddb db.DB, orgID, userID, id string, w *db.SearchWatch) (int, any, error) {
+	s, err := db.GetSavedSearch(ddb, orgID, userID, id)
+	if errors.Is(err, db.ErrSavedSearchNotFound) {
+		return http.StatusNotFound, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	s.Watch = w
+	s.UpdatedAt = time.Now().UTC()
+
+	if err := db.SaveSavedSearch(ddb, s); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, s, nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+
+	"poc-ddb-tidb-search/pkg/db"
+)
+
+func request(method, resource, id, body string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		HTTPMethod:     method,
+		Resource:       resource,
+		Headers:        map[string]string{"orgid": "org1", "userid": "u1"},
+		PathParameters: map[string]string{"id": id},
+		Body:           body,
+	}
+}
+
+func TestSavedSearchLifecycle(t *testing.T) {
+	ctx := context.Background()
+	ddb := db.NewMemoryDDB()
+	assert.NoError(t, ddb.SetTableName("saved"))
+
+	resp, err := handle(ctx, request(http.MethodPost, "/saved-searches", "", `{"name":"failed","params":{"status":"failed"}}`), ddb)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	created := new(db.SavedSearch)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), created))
+	assert.NotEmpty(t, created.ID)
+	assert.Equal(t, "u1", created.UserID)
+
+	resp, err = handle(ctx, request(http.MethodPut, "/saved-searches/{id}/watch", created.ID, `{"sink":"webhook","url":"http://insecure"}`), ddb)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = handle(ctx, request(http.MethodPut, "/saved-searches/{id}/watch", created.ID, `{"sink":"webhook","url":"https://internal.local"}`), ddb)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "webhook watches go to the org endpoints")
+
+	resp, err = handle(ctx, request(http.MethodPut, "/saved-searches/{id}/watch", created.ID, `{"sink":"webhook"}`), ddb)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = handle(ctx, request(http.MethodPut, "/saved-searches/{id}/watch", created.ID, `{"sink":"sqs"}`), ddb)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	watched, err := db.ListWatchedSearches(ddb, "org1")
+	assert.NoError(t, err)
+	assert.Len(t, watched, 1)
+
+	resp, err = handle(ctx, request(http.MethodGet, "/saved-searches", "", ""), ddb)
+	assert.NoError(t, err)
+	list := make([]*db.SavedSearch, 0)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), &list))
+	assert.Len(t, list, 1)
+
+	resp, err = handle(ctx, request(http.MethodDelete, "/saved-searches/{id}", created.ID, ""), ddb)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp, err = handle(ctx, request(http.MethodGet, "/saved-searches/{id}", created.ID, ""), ddb)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	noUser := request(http.MethodGet, "/saved-searches", "", "")
+	delete(noUser.Headers, "userid")
+	resp, err = handle(ctx, noUser, ddb)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -2,27 +2,28 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
+	"os"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 	logger "github.com/sirupsen/logrus"
 
 	"poc-ddb-tidb-search/pkg/db"
-	"poc-ddb-tidb-search/pkg/models"
-
-	"github.com/google/uuid"
+	"poc-ddb-tidb-search/pkg/pipeline"
+	queue "poc-ddb-tidb-search/pkg/sqs"
 )
 
-const (
-	recType_Insert = "insert"
-	recType_Modify = "modify"
-	recType_Remove = "remove"
+var (
+	savedSearchTable = ""
+	watchQueueURL    = ""
+	webhookQueueURL  = ""
 )
 
 func init() {
 	logger.SetFormatter(&logger.JSONFormatter{})
+	savedSearchTable = os.Getenv("SAVED_SEARCH_TABLE")
+	watchQueueURL = os.Getenv("WATCH_QUEUE_URL")
+	webhookQueueURL = os.Getenv("WEBHOOK_QUEUE_URL")
 }
 
 func handler(ctx context.Context, event events.SQSEvent) (*events.SQSEventResponse, error) {
@@ -36,98 +37,30 @@ func handler(ctx context.Context, event events.SQSEvent) (*events.SQSEventRespon
 	}
 	defer tiDB.Close()
 
-	failures := make([]events.SQSBatchItemFailure, 0, len(event.Records))
-	for _, record := range event.Records {
-		err := parseAndSend(ctx, &record, tiDB)
-		if err != nil {
-			failures = append(failures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
-		}
-	}
-
-	return &events.SQSEventResponse{
-		BatchItemFailures: failures,
-	}, nil
-}
-
-func parseAndSend(ctx context.Context, record *events.SQSMessage, tiDB db.DB) error {
-
-	job := new(models.Job)
-	err := json.Unmarshal([]byte(record.Body), job)
-	if err != nil {
-		logger.WithFields(logger.Fields{
-			"error": err.Error(),
-			"code":  "SQSParseErr",
-			"body":  record.Body,
-		}).Error("failed to parse sqs message")
-		return err
-	}
-
-	// get sqs messag attributes -> recordType and orgID
-	orgID, recordType := getMessageAttribs(record)
-
-	return syncToTiDB(ctx, orgID, recordType, job, tiDB)
-}
-
-func syncToTiDB(ctx context.Context, orgID, recordType string, job *models.Job, tiDB db.DB) error {
-	var err error
-
-	switch recordType {
-
-	case recType_Insert:
-		err = insertToTiDB(job, tiDB)
-
-	case recType_Modify:
-		//_, err = tiDB.Put(job) // deffered
-
-	case recType_Remove:
-		//err = tiDB.Delete(nil) // deffered
-
-	default:
-		return errors.New("unknown record type")
+	syncer := &pipeline.Syncer{
+		TiDB:            tiDB,
+		WatchQueueURL:   watchQueueURL,
+		WebhookQueueURL: webhookQueueURL,
 	}
 
-	return err
-}
-
-func getMessageAttribs(record *events.SQSMessage) (string, string) {
-	orgID, recType := "", ""
-
-	for k, v := range record.MessageAttributes {
-		switch k {
-		case "orgID":
-			orgID = *v.StringValue
-		case "recordType":
-			recType = *v.StringValue
-		default:
-			continue
+	if savedSearchTable != "" {
+		ddb := db.NewDDB(ctx)
+		if err := ddb.SetTableName(savedSearchTable); err != nil {
+			logger.WithFields(logger.Fields{
+				"error": err.Error(),
+				"code":  "TablenameErr",
+			}).Error("invalid table name")
+		} else {
+			syncer.SavedSearches = ddb
 		}
-	}
-
-	return orgID, recType
-}
-
-func insertToTiDB(job *models.Job, tiDB db.DB) error {
-	sqlStmts := make([]string, 0)
-	id := uuid.New()
 
-	jobStmt, err := db.MakeInsertJobSQLStatement(job, id.String())
-	if err != nil {
-		return err
-	}
-
-	jobRefStmt, err := db.MakeInsertJobReferenceSQLStatement(job, id.String())
-	if err != nil {
-		return err
-	}
-
-	sqlStmts = append(sqlStmts, jobStmt, jobRefStmt)
-
-	_, err = tiDB.Put(sqlStmts[0], sqlStmts[1])
-	if err != nil {
-		return err
+		// nil when there is no aws config, sqs watch notifications then fail on their own
+		if client := queue.NewSQSClient(ctx); client != nil {
+			syncer.Client = client
+		}
 	}
 
-	return nil
+	return syncer.Handle(ctx, event)
 }
 
 func main() {
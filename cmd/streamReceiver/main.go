@@ -2,30 +2,28 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"os"
-	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 
-	"poc-ddb-tidb-search/pkg/models"
+	"poc-ddb-tidb-search/pkg/pipeline"
 	queue "poc-ddb-tidb-search/pkg/sqs"
 
-	"poc-ddb-tidb-search/pkg/ddbstream"
-
 	logger "github.com/sirupsen/logrus"
 )
 
 var (
-	sqsClient queue.SendMessageClient
-	QueueURL  = ""
+	sqsClient       queue.SendMessageClient
+	QueueURL        = ""
+	WebhookQueueURL = ""
 )
 
 func init() {
 	logger.SetFormatter(&logger.JSONFormatter{})
 	QueueURL = os.Getenv("QUEUE_URL")
+	WebhookQueueURL = os.Getenv("WEBHOOK_QUEUE_URL")
 }
 
 func handler(ctx context.Context, streamEvent events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
@@ -35,58 +33,12 @@ func handler(ctx context.Context, streamEvent events.DynamoDBEvent) (events.Dyna
 		}, err
 	}
 
-	streamEventFailures := events.DynamoDBEventResponse{BatchItemFailures: make([]events.DynamoDBBatchItemFailure, 0)}
-
-	for _, event := range streamEvent.Records {
-		job, err := parseRecordStream(&event)
-		if err != nil {
-			logger.WithFields(logger.Fields{
-				"error": err.Error(),
-				"code":  "DDBStreamErr",
-			}).Error("failed to parse stream event")
-			streamEventFailures.BatchItemFailures = append(streamEventFailures.BatchItemFailures, events.DynamoDBBatchItemFailure{ItemIdentifier: event.Change.SequenceNumber})
-			continue
-		}
-
-		err = sendToQueue(ctx, job, event.EventName)
-		if err != nil {
-			logger.WithFields(logger.Fields{
-				"error": err.Error(),
-				"code":  "SQSErr",
-			}).Error("failed to send stream event to queue ")
-			streamEventFailures.BatchItemFailures = append(streamEventFailures.BatchItemFailures, events.DynamoDBBatchItemFailure{ItemIdentifier: event.Change.SequenceNumber})
-		}
-	}
-
-	return streamEventFailures, nil
-}
-
-func parseRecordStream(event *events.DynamoDBEventRecord) (*models.Job, error) {
-	job := new(models.Job)
-	err := ddbstream.ConvertStreamRecord(&event.Change, "json", job) // should add dynamodbav tags in job struct as well
-	if err != nil {
-		return nil, err
+	receiver := &pipeline.StreamReceiver{
+		Client:          sqsClient,
+		QueueURL:        QueueURL,
+		WebhookQueueURL: WebhookQueueURL,
 	}
-
-	return job, nil
-}
-
-func sendToQueue(ctx context.Context, job *models.Job, recordType string) error {
-	msg, err := json.Marshal(job)
-	if err != nil {
-		return err
-	}
-	input := queue.NewQueueInput(QueueURL, string(msg))
-	input.SetMessageAttributes("recordType", strings.ToLower(recordType)) // remove, insert or modify
-	input.SetMessageAttributes("orgID", job.OrgID2)
-	input.SetMessageGroupID(job.OrgID2)
-
-	_, err = queue.Enqueue(ctx, sqsClient, input)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return receiver.Handle(ctx, streamEvent)
 }
 
 func initSQSClient(ctx context.Context) error {
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/webhook"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	logger "github.com/sirupsen/logrus"
+)
+
+var (
+	tableName = ""
+)
+
+func init() {
+	logger.SetFormatter(&logger.JSONFormatter{})
+	tableName = os.Getenv("WEBHOOK_TABLE")
+}
+
+func handler(ctx context.Context, event events.SQSEvent) (*events.SQSEventResponse, error) {
+	ddb := db.NewDDB(ctx)
+	if err := ddb.SetTableName(tableName); err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TablenameErr",
+		}).Error("invalid table name")
+		return nil, err
+	}
+
+	store := &webhook.DDBStore{DB: ddb}
+	dispatcher := webhook.NewDispatcher()
+
+	failures := make([]events.SQSBatchItemFailure, 0, len(event.Records))
+	for _, record := range event.Records {
+		if err := dispatch(ctx, dispatcher, store, &record); err != nil {
+			failures = append(failures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+		}
+	}
+
+	return &events.SQSEventResponse{
+		BatchItemFailures: failures,
+	}, nil
+}
+
+// dispatch delivers one queued lifecycle event, endpoint failures end in the dead letter store
+// so only malformed messages, store errors and events left when the lambda ran out of time are
+// retried by the queue
+func dispatch(ctx context.Context, dispatcher *webhook.Dispatcher, store webhook.Store, record *events.SQSMessage) error {
+	ev := new(webhook.Event)
+	if err := json.Unmarshal([]byte(record.Body), ev); err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "SQSParseErr",
+			"body":  record.Body,
+		}).Error("failed to parse webhook event")
+		return err
+	}
+
+	if err := dispatcher.Dispatch(ctx, store, ev); err != nil {
+		logger.WithFields(logger.Fields{
+			"error":   err.Error(),
+			"code":    "WebhookErr",
+			"eventID": ev.ID,
+		}).Error("failed to dispatch webhook event")
+		return err
+	}
+
+	return nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/query"
+	"poc-ddb-tidb-search/pkg/webhook"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/google/uuid"
+	logger "github.com/sirupsen/logrus"
+)
+
+var (
+	tableName = ""
+)
+
+func init() {
+	logger.SetFormatter(&logger.JSONFormatter{})
+	tableName = os.Getenv("WEBHOOK_TABLE")
+}
+
+type endpointBody struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+func handler(ctx context.Context, request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	ddb := db.NewDDB(ctx)
+	if err := ddb.SetTableName(tableName); err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TablenameErr",
+		}).Error("invalid table name")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	return handle(ctx, request, ddb)
+}
+
+// handle serves the request with the table, which tests can swap for db.NewMemoryDDB
+func handle(ctx context.Context, request events.APIGatewayProxyRequest, ddb db.DB) (*events.APIGatewayProxyResponse, error) {
+	orgID := query.GetOrgID(&request)
+	if orgID == "" {
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusBadRequest,
+		}, nil
+	}
+
+	store := &webhook.DDBStore{DB: ddb}
+
+	id := request.PathParameters["id"]
+
+	var (
+		status int
+		res    any
+		err    error
+	)
+
+	switch {
+	case strings.HasSuffix(request.Resource, "/dead-letters") && request.HTTPMethod == http.MethodGet:
+		status, res, err = listDeadLetters(ctx, store, orgID)
+	case request.HTTPMethod == http.MethodPost && id == "":
+		status, res, err = createEndpoint(ctx, store, orgID, request.Body)
+	case request.HTTPMethod == http.MethodGet && id == "":
+		status, res, err = listEndpoints(ctx, store, orgID)
+	case request.HTTPMethod == http.MethodDelete && id != "":
+		status, res, err = deleteEndpoint(ctx, store, orgID, id)
+	default:
+		status = http.StatusMethodNotAllowed
+	}
+
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "DDBErr",
+		}).Error("failed to process webhook request")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	if res == nil {
+		return &events.APIGatewayProxyResponse{
+			StatusCode: status,
+		}, nil
+	}
+
+	jsonRes, err := json.Marshal(res)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "JSONErr",
+		}).Error("failed to marshal webhook response")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: status,
+		Body:       string(jsonRes),
+	}, nil
+}
+
+func parseBody(body string) (*endpointBody, error) {
+	b := new(endpointBody)
+	if err := json.Unmarshal([]byte(body), b); err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(b.URL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, errors.New("url must be an https url")
+	}
+	if err := webhook.ValidEventTypes(b.Events); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// createEndpoint registers the endpoint, its signing secret is only returned here
+func createEndpoint(ctx context.Context, store *webhook.DDBStore, orgID, body string) (int, any, error) {
+	b, err := parseBody(body)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "ParseErr",
+		}).Error("failed to parse request body")
+		return http.StatusBadRequest, nil, nil
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return 0, nil, err
+	}
+
+	ep := &webhook.Endpoint{
+		OrgID:     orgID,
+		ID:        uuid.New().String(),
+		URL:       b.URL,
+		Secret:    hex.EncodeToString(secret),
+		Events:    b.Events,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := store.PutEndpoint(ctx, ep); err != nil {
+		return 0, nil, err
+	}
+	return http.StatusCreated, ep, nil
+}
+
+func listEndpoints(ctx context.Context, store *webhook.DDBStore, orgID string) (int, any, error) {
+	list, err := store.Endpoints(ctx, orgID)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	for _, ep := range list {
+		ep.Secret = ""
+	}
+	return http.StatusOK, list, nil
+}
+
+func deleteEndpoint(ctx context.Context, store *webhook.DDBStore, orgID, id string) (int, any, error) {
+	err := store.DeleteEndpoint(ctx, orgID, id)
+	if errors.Is(err, webhook.ErrEndpointNotFound) {
+		return http.StatusNotFound, nil, nil
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusNoContent, nil, nil
+}
+
+func listDeadLetters(ctx context.Context, store *webhook.DDBStore, orgID string) (int, any, error) {
+	list, err := store.DeadLetters(ctx, orgID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return http.StatusOK, list, nil
+}
+
+func main() {
+	lambda.Start(handler)
+}
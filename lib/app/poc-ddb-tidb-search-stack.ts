@@ -12,13 +12,20 @@ export class PocDdbTidbSearchStack extends cdk.Stack {
 
     const lambdas = new LambdaStack(scope, "POC-DDB-TiDB-Lambdas", {
       testTable: ddbStatck.pocTestTable,
+      savedSearchTable: ddbStatck.savedSearchTable,
+      webhookTable: ddbStatck.webhookTable,
     });
     lambdas.node.addDependency(ddbStatck);
 
     new APIStack(scope, "POC-DDB-TiDB-API",{
       stageName: "POC-DDB-TiDB-DevStage",
       searchFunc: lambdas.searchFunc,
+      reportsFunc: lambdas.reportsFunc,
       receiveShipmentFunc: lambdas.receiveShipmentFunc,
+      exportRequestFunc: lambdas.exportRequestFunc,
+      exportStatusFunc: lambdas.exportStatusFunc,
+      savedSearchesFunc: lambdas.savedSearchesFunc,
+      webhooksFunc: lambdas.webhooksFunc,
     });
     
   }
@@ -7,6 +7,11 @@ import {Construct} from "constructs";
 export interface APIProperties extends StackProps {
     receiveShipmentFunc: lambda.Function;
     searchFunc: lambda.Function;
+    reportsFunc: lambda.Function;
+    exportRequestFunc: lambda.Function;
+    exportStatusFunc: lambda.Function;
+    savedSearchesFunc: lambda.Function;
+    webhooksFunc: lambda.Function;
     stageName: string;
 }
 
@@ -42,6 +47,55 @@ export class APIStack extends Stack {
 
         const search_path = api.root.addResource("search");
         search_path.addMethod("GET", new apig.LambdaIntegration(props.searchFunc, {
+            requestParameters: {
+                "integration.request.header.ORGID": "method.request.header.ORGID",
+                "integration.request.header.USERID": "method.request.header.USERID"
+            }
+        }), {
+            apiKeyRequired: true,
+            requestParameters: {
+                "method.request.header.ORGID": true,
+                "method.request.header.USERID": false
+            }
+        });
+        search_path.addMethod("POST", new apig.LambdaIntegration(props.searchFunc, {
+            requestParameters: {
+                "integration.request.header.ORGID": "method.request.header.ORGID",
+                "integration.request.header.USERID": "method.request.header.USERID"
+            }
+        }), {
+            apiKeyRequired: true,
+            requestParameters: {
+                "method.request.header.ORGID": true,
+                "method.request.header.USERID": false
+            }
+        });
+
+        const reports_path = api.root.addResource("reports");
+        reports_path.addMethod("GET", new apig.LambdaIntegration(props.reportsFunc, {
+            requestParameters: {
+                "integration.request.header.ORGID": "method.request.header.ORGID"
+            }
+        }), {
+            apiKeyRequired: true,
+            requestParameters: {
+                "method.request.header.ORGID": true
+            }
+        });
+
+        const export_path = api.root.addResource("exports");
+        export_path.addMethod("POST", new apig.LambdaIntegration(props.exportRequestFunc, {
+            requestParameters: {
+                "integration.request.header.ORGID": "method.request.header.ORGID"
+            }
+        }), {
+            apiKeyRequired: true,
+            requestParameters: {
+                "method.request.header.ORGID": true
+            }
+        });
+
+        export_path.addResource("{id}").addMethod("GET", new apig.LambdaIntegration(props.exportStatusFunc, {
             requestParameters: {
                 "integration.request.header.ORGID": "method.request.header.ORGID"
             }
@@ -52,6 +106,48 @@ export class APIStack extends Stack {
             }
         });
 
+        const saved_path = api.root.addResource("saved-searches");
+        const saved_item_path = saved_path.addResource("{id}");
+        const savedSearchesIntegration = new apig.LambdaIntegration(props.savedSearchesFunc, {
+            requestParameters: {
+                "integration.request.header.ORGID": "method.request.header.ORGID",
+                "integration.request.header.USERID": "method.request.header.USERID"
+            }
+        });
+        const savedSearchesMethodOptions = {
+            apiKeyRequired: true,
+            requestParameters: {
+                "method.request.header.ORGID": true,
+                "method.request.header.USERID": true
+            }
+        };
+        saved_path.addMethod("GET", savedSearchesIntegration, savedSearchesMethodOptions);
+        saved_path.addMethod("POST", savedSearchesIntegration, savedSearchesMethodOptions);
+        saved_item_path.addMethod("GET", savedSearchesIntegration, savedSearchesMethodOptions);
+        saved_item_path.addMethod("PUT", savedSearchesIntegration, savedSearchesMethodOptions);
+        saved_item_path.addMethod("DELETE", savedSearchesIntegration, savedSearchesMethodOptions);
+
+        const watch_path = saved_item_path.addResource("watch");
+        watch_path.addMethod("PUT", savedSearchesIntegration, savedSearchesMethodOptions);
+        watch_path.addMethod("DELETE", savedSearchesIntegration, savedSearchesMethodOptions);
+
+        const webhooks_path = api.root.addResource("webhooks");
+        const webhooksIntegration = new apig.LambdaIntegration(props.webhooksFunc, {
+            requestParameters: {
+                "integration.request.header.ORGID": "method.request.header.ORGID"
+            }
+        });
+        const webhooksMethodOptions = {
+            apiKeyRequired: true,
+            requestParameters: {
+                "method.request.header.ORGID": true
+            }
+        };
+        webhooks_path.addMethod("GET", webhooksIntegration, webhooksMethodOptions);
+        webhooks_path.addMethod("POST", webhooksIntegration, webhooksMethodOptions);
+        webhooks_path.addResource("{id}").addMethod("DELETE", webhooksIntegration, webhooksMethodOptions);
+        webhooks_path.addResource("dead-letters").addMethod("GET", webhooksIntegration, webhooksMethodOptions);
+
     }
 
 }
\ No newline at end of file
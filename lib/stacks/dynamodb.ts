@@ -5,12 +5,16 @@ import { Construct } from "constructs";
 
 export class POCDynamoDBStack extends Stack {
     public readonly pocTestTable: Table;
+    public readonly savedSearchTable: Table;
+    public readonly webhookTable: Table;
 
     constructor(scope: Construct, id: string) {
 
         super(scope, id);
 
         this.pocTestTable = this.createTestTable();
+        this.savedSearchTable = this.createSavedSearchTable();
+        this.webhookTable = this.createWebhookTable();
     };
 
     private createTestTable(): Table {
@@ -27,7 +31,7 @@ export class POCDynamoDBStack extends Stack {
                 name: 'docID',
                 type: AttributeType.STRING
             },
-            stream: StreamViewType.NEW_IMAGE,
+            stream: StreamViewType.NEW_AND_OLD_IMAGES,
         });
 
         table.addGlobalSecondaryIndex({
@@ -40,5 +44,40 @@ export class POCDynamoDBStack extends Stack {
         return table;
     }
 
+    // no stream, saved searches are not synced to TiDB
+    private createSavedSearchTable(): Table {
+        return new Table(this, 'POCSavedSearchTable', {
+            tableName: 'POC_SavedSearches',
+            removalPolicy: RemovalPolicy.RETAIN,
+            billingMode: BillingMode.PAY_PER_REQUEST,
+            encryption: TableEncryption.AWS_MANAGED,
+            partitionKey: {
+                name: 'orgID',
+                type: AttributeType.STRING
+            },
+            sortKey: {
+                name: 'docID',
+                type: AttributeType.STRING
+            },
+        });
+    }
+
+    // webhook endpoints and dead letters per org, no stream
+    private createWebhookTable(): Table {
+        return new Table(this, 'POCWebhookTable', {
+            tableName: 'POC_Webhooks',
+            removalPolicy: RemovalPolicy.RETAIN,
+            billingMode: BillingMode.PAY_PER_REQUEST,
+            encryption: TableEncryption.AWS_MANAGED,
+            partitionKey: {
+                name: 'orgID',
+                type: AttributeType.STRING
+            },
+            sortKey: {
+                name: 'docID',
+                type: AttributeType.STRING
+            },
+        });
+    }
 
 }
\ No newline at end of file
@@ -2,23 +2,32 @@ import {
     aws_events_targets as event_targets,
     aws_lambda as lambda,
     Duration,
+    Size,
     Stack,
     StackProps,
 } from "aws-cdk-lib";
 import { Table } from "aws-cdk-lib/aws-dynamodb";
 import { DynamoEventSource, SqsDlq, SqsEventSource } from "aws-cdk-lib/aws-lambda-event-sources";
 import { Queue, QueueEncryption } from "aws-cdk-lib/aws-sqs";
+import { Bucket, BucketEncryption } from "aws-cdk-lib/aws-s3";
 import { GoFunction } from "@aws-cdk/aws-lambda-go-alpha";
 import { Construct } from "constructs";
 import { StartingPosition, Tracing } from "aws-cdk-lib/aws-lambda";
 
 export interface LambdaProperties extends StackProps {
     testTable: Table
+    savedSearchTable: Table
+    webhookTable: Table
 }
 
 export class LambdaStack extends Stack {
     public readonly receiveShipmentFunc: lambda.Function;
     public readonly searchFunc: lambda.Function;
+    public readonly reportsFunc: lambda.Function;
+    public readonly exportRequestFunc: lambda.Function;
+    public readonly exportStatusFunc: lambda.Function;
+    public readonly savedSearchesFunc: lambda.Function;
+    public readonly webhooksFunc: lambda.Function;
     
     constructor(scope: Construct, id: string, props: LambdaProperties) {
 
@@ -26,9 +35,42 @@ export class LambdaStack extends Stack {
         const queue = this.createFIFOQueue("POC-DynamoDB-Stream-Queue");
 
         this.receiveShipmentFunc = this.receiveShipment(props.testTable);
-        this.sendDDBRecord(queue);
-        this.streamReceiver(props.testTable, queue);
-        this.searchFunc = this.search();
+        const watchQueue = new Queue(this, "POC-Watch-Notifications-Queue", {
+            encryption: QueueEncryption.SQS_MANAGED,
+            retentionPeriod: Duration.days(4),
+        });
+        const webhookQueue = new Queue(this, "POC-Webhook-Events-Queue", {
+            visibilityTimeout: Duration.minutes(6),
+            encryption: QueueEncryption.SQS_MANAGED,
+            deadLetterQueue: {
+                queue: new Queue(this, "POC-Webhook-Events-Queue-DLQ", {encryption: QueueEncryption.SQS_MANAGED}),
+                maxReceiveCount: 3,
+            },
+        });
+        this.sendDDBRecord(queue, props.savedSearchTable, watchQueue, webhookQueue);
+        this.streamReceiver(props.testTable, queue, webhookQueue);
+        this.webhookDispatcher(webhookQueue, props.webhookTable);
+        this.webhooksFunc = this.webhooks(props.webhookTable);
+        this.searchFunc = this.search(props.savedSearchTable);
+        this.savedSearchesFunc = this.savedSearches(props.savedSearchTable);
+        this.reportsFunc = this.reports();
+
+        const exportQueue = new Queue(this, "POC-Export-Queue", {
+            visibilityTimeout: Duration.minutes(15),
+            encryption: QueueEncryption.SQS_MANAGED,
+            deadLetterQueue: {
+                queue: new Queue(this, "POC-Export-Queue-DLQ", {encryption: QueueEncryption.SQS_MANAGED}),
+                maxReceiveCount: 3,
+            },
+        });
+        const exportBucket = new Bucket(this, "POC-Export-Bucket", {
+            encryption: BucketEncryption.S3_MANAGED,
+            lifecycleRules: [{expiration: Duration.days(7)}],
+        });
+
+        this.exportRequestFunc = this.exportRequest(exportQueue);
+        this.exportStatusFunc = this.exportStatus();
+        this.exportWorker(exportQueue, exportBucket);
     };
 
     private receiveShipment(pocTable: Table,) :GoFunction {
@@ -51,7 +93,7 @@ export class LambdaStack extends Stack {
         return func;
     }
 
-    private streamReceiver(pocTable: Table, queue: Queue) {
+    private streamReceiver(pocTable: Table, queue: Queue, webhookQueue: Queue) {
         const streamErrDlq = new Queue(this, "POC_Table_DDB_Error_Stream_Handler.dlq",
         {visibilityTimeout: Duration.seconds(60)},);
 
@@ -65,6 +107,7 @@ export class LambdaStack extends Stack {
             architecture: lambda.Architecture.ARM_64,
             environment: {
                 QUEUE_URL: queue.queueUrl,
+                WEBHOOK_QUEUE_URL: webhookQueue.queueUrl,
             },
             bundling: {
                 goBuildFlags: ['-ldflags "-s -w"', "-trimpath"],
@@ -84,9 +127,55 @@ export class LambdaStack extends Stack {
         });
 
         queue.grantSendMessages(func);
+        webhookQueue.grantSendMessages(func);
+    }
+
+    private webhookDispatcher(queue: Queue, webhookTable: Table) {
+        const func = new GoFunction(this, "POC_WebhookDispatcher_Func", {
+            functionName: "poc-webhook-dispatcher-func",
+            timeout: Duration.minutes(5),
+            entry: "./cmd/webhookDispatcher",
+            tracing: Tracing.PASS_THROUGH,
+            architecture: lambda.Architecture.ARM_64,
+            environment: {
+                WEBHOOK_TABLE: webhookTable.tableName,
+            },
+            bundling: {
+                goBuildFlags: ['-ldflags "-s -w"', "-trimpath"],
+            },
+            events: [
+                new SqsEventSource(queue, {
+                    batchSize: 5,
+                    enabled: true,
+                    reportBatchItemFailures: true,
+                }),
+            ],
+        });
+
+        webhookTable.grantReadWriteData(func);
+    }
+
+    private webhooks(webhookTable: Table) :GoFunction {
+        const func = new GoFunction(this, "POC_Webhooks_Func", {
+            functionName: "poc-webhooks-func",
+            timeout: Duration.seconds(60),
+            entry: "./cmd/webhooks",
+            tracing: Tracing.PASS_THROUGH,
+            architecture: lambda.Architecture.ARM_64,
+            environment: {
+                WEBHOOK_TABLE: webhookTable.tableName,
+            },
+            bundling: {
+                goBuildFlags: ['-ldflags "-s -w"', "-trimpath"],
+            },
+        });
+
+        webhookTable.grantReadWriteData(func);
+
+        return func;
     }
 
-    private sendDDBRecord(queue: Queue) {
+    private sendDDBRecord(queue: Queue, savedSearchTable: Table, watchQueue: Queue, webhookQueue: Queue) {
         const dlq = new Queue(this, "POC_SendDDB_Error_Handler.dlq", {visibilityTimeout: Duration.seconds(60)});
 
         const func = new GoFunction(this, "POC_SendDDB_Record_Func", {
@@ -97,6 +186,9 @@ export class LambdaStack extends Stack {
             architecture: lambda.Architecture.ARM_64,
             environment: {
                 QUEUE_URL: queue.queueUrl,
+                SAVED_SEARCH_TABLE: savedSearchTable.tableName,
+                WATCH_QUEUE_URL: watchQueue.queueUrl,
+                WEBHOOK_QUEUE_URL: webhookQueue.queueUrl,
             },
             bundling: {
                 goBuildFlags: ['-ldflags "-s -w"', "-trimpath"],
@@ -110,20 +202,125 @@ export class LambdaStack extends Stack {
             ],
             deadLetterQueue: dlq,
         });
+
+        savedSearchTable.grantReadData(func);
+        watchQueue.grantSendMessages(func);
+        webhookQueue.grantSendMessages(func);
     }
 
-    private search() :GoFunction {
-        return new GoFunction(this, "POC_Search_Func", {
+    private search(savedSearchTable: Table) :GoFunction {
+        const func = new GoFunction(this, "POC_Search_Func", {
             functionName: "poc-search-func",
             timeout: Duration.seconds(60),
             entry: "./cmd/search",
             tracing: Tracing.PASS_THROUGH,
             architecture: lambda.Architecture.ARM_64,
             memorySize: 1024,
+            environment: {
+                SAVED_SEARCH_TABLE: savedSearchTable.tableName,
+            },
+            bundling: {
+                goBuildFlags: ['-ldflags "-s -w"', "-trimpath"],
+            },
+        });
+
+        savedSearchTable.grantReadData(func);
+
+        return func;
+    }
+
+    private savedSearches(savedSearchTable: Table) :GoFunction {
+        const func = new GoFunction(this, "POC_SavedSearches_Func", {
+            functionName: "poc-saved-searches-func",
+            timeout: Duration.seconds(60),
+            entry: "./cmd/savedSearches",
+            tracing: Tracing.PASS_THROUGH,
+            architecture: lambda.Architecture.ARM_64,
+            environment: {
+                SAVED_SEARCH_TABLE: savedSearchTable.tableName,
+            },
+            bundling: {
+                goBuildFlags: ['-ldflags "-s -w"', "-trimpath"],
+            },
+        });
+
+        savedSearchTable.grantReadWriteData(func);
+
+        return func;
+    }
+
+    private reports() :GoFunction {
+        return new GoFunction(this, "POC_Reports_Func", {
+            functionName: "poc-reports-func",
+            timeout: Duration.seconds(60),
+            entry: "./cmd/reports",
+            tracing: Tracing.PASS_THROUGH,
+            architecture: lambda.Architecture.ARM_64,
+            memorySize: 1024,
+            bundling: {
+                goBuildFlags: ['-ldflags "-s -w"', "-trimpath"],
+            },
+        });
+    }
+
+    private exportRequest(queue: Queue) :GoFunction {
+        const func = new GoFunction(this, "POC_ExportRequest_Func", {
+            functionName: "poc-export-request-func",
+            timeout: Duration.seconds(60),
+            entry: "./cmd/exportRequest",
+            tracing: Tracing.PASS_THROUGH,
+            architecture: lambda.Architecture.ARM_64,
+            environment: {
+                EXPORT_QUEUE_URL: queue.queueUrl,
+            },
+            bundling: {
+                goBuildFlags: ['-ldflags "-s -w"', "-trimpath"],
+            },
+        });
+
+        queue.grantSendMessages(func);
+
+        return func;
+    }
+
+    private exportStatus() :GoFunction {
+        return new GoFunction(this, "POC_ExportStatus_Func", {
+            functionName: "poc-export-status-func",
+            timeout: Duration.seconds(60),
+            entry: "./cmd/exportStatus",
+            tracing: Tracing.PASS_THROUGH,
+            architecture: lambda.Architecture.ARM_64,
+            bundling: {
+                goBuildFlags: ['-ldflags "-s -w"', "-trimpath"],
+            },
+        });
+    }
+
+    private exportWorker(queue: Queue, bucket: Bucket) {
+        const func = new GoFunction(this, "POC_ExportWorker_Func", {
+            functionName: "poc-export-worker-func",
+            timeout: Duration.minutes(15),
+            entry: "./cmd/exportWorker",
+            tracing: Tracing.PASS_THROUGH,
+            architecture: lambda.Architecture.ARM_64,
+            memorySize: 1024,
+            ephemeralStorageSize: Size.gibibytes(2),
+            environment: {
+                EXPORT_BUCKET: bucket.bucketName,
+            },
             bundling: {
                 goBuildFlags: ['-ldflags "-s -w"', "-trimpath"],
             },
+            events: [
+                new SqsEventSource(queue, {
+                    batchSize: 1,
+                    enabled: true,
+                    reportBatchItemFailures: true,
+                }),
+            ],
         });
+
+        bucket.grantReadWrite(func);
     }
 
     private createFIFOQueue(queueName: string): Queue {
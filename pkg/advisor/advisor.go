@@ -0,0 +1,282 @@
+// Package advisor explains the search sql of filter combinations against a database and reports the
+// full table scans, partly matching and unused indexes, so the indexes follow the real query plans
+package advisor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/geo"
+	"poc-ddb-tidb-search/pkg/query"
+)
+
+// Filter is a search filter with a sample value. Columns are the columns of Table the filter compares
+// with = or in, which an index can match, a filter on a function of a column has none
+type Filter struct {
+	Name    string
+	Table   string
+	Columns []string
+	Apply   func(p *query.JobSearchParams)
+}
+
+// Filters are the filters of the search params, see makeSearchWhereClause for the sql of each
+var Filters = []*Filter{
+	{"shipment_id", "jobs", []string{"shipment_id"}, func(p *query.JobSearchParams) { p.ShipmentID = "SHP-1" }},
+	{"order_id", "jobs", []string{"order_id"}, func(p *query.JobSearchParams) { p.OrderID = "ORD-1" }},
+	{"job_id", "jobs", []string{"job_id"}, func(p *query.JobSearchParams) { p.JobID = "JOB-1" }},
+	{"status", "jobs", []string{"status"}, func(p *query.JobSearchParams) { p.Status = "completed" }},
+	{"start_time", "jobs", nil, func(p *query.JobSearchParams) { p.StartTime = "2023-03-03" }},
+	{"commit_time", "jobs", nil, func(p *query.JobSearchParams) { p.CommitTime = "2023-03-15" }},
+	{"consignee_name", "jobs_reference", []string{"consignee_name"}, func(p *query.JobSearchParams) { p.ConsigneeName = "Quiapo Clinic" }},
+	{"sender_name", "jobs_reference", []string{"sender_name"}, func(p *query.JobSearchParams) { p.SenderName = "Makati Pharma" }},
+	{"vendor_name", "jobs_reference", []string{"assigned_vendor"}, func(p *query.JobSearchParams) { p.VendorName = "Acme Express" }},
+	{"facility_name", "jobs_reference", []string{"assigned_facility"}, func(p *query.JobSearchParams) { p.FacilityName = "North Hub" }},
+	{"customer_account_name", "jobs_reference", []string{"customer_account_name"}, func(p *query.JobSearchParams) { p.AccountName = "Pharma" }},
+	{"driver_id", "jobs_reference", []string{"driver_id"}, func(p *query.JobSearchParams) { p.DriverID = "drv-1" }},
+	{"driver_name", "jobs_reference", []string{"driver_name"}, func(p *query.JobSearchParams) { p.DriverName = "Juan Dela Cruz" }},
+	{"vehicle_number", "jobs_reference", []string{"vehicle_number"}, func(p *query.JobSearchParams) { p.VehicleNumber = "ABC-123" }},
+	{"tracking_id", "jobs_reference", []string{"tracking_id"}, func(p *query.JobSearchParams) { p.TrackingID = "TRK-1" }},
+	{"client_order_code", "jobs_reference", []string{"client_order_code"}, func(p *query.JobSearchParams) { p.ClientOrderCode = "COC-1" }},
+	{"order_label", "jobs_reference", []string{"order_label"}, func(p *query.JobSearchParams) { p.OrderLabel = "OL-1" }},
+	{"shipment_label", "jobs_reference", []string{"shipment_label"}, func(p *query.JobSearchParams) { p.ShipmentLabel = "SL-1" }},
+	{"package_label", "jobs_reference", []string{"package_label"}, func(p *query.JobSearchParams) { p.PackageLabel = "PL-1" }},
+	{"pickup_postcode", "jobs_reference", []string{"pickup_postal_code"}, func(p *query.JobSearchParams) { p.PickupPostcode = "1200" }},
+	{"pickup_postcode_prefix", "jobs_reference", []string{"pickup_postal_code"}, func(p *query.JobSearchParams) { p.PickupPostcodePrefix = "12" }},
+	{"pickup_city", "jobs_reference", []string{"pickup_city"}, func(p *query.JobSearchParams) { p.PickupCity = "MAKATI" }},
+	{"pickup_state", "jobs_reference", []string{"pickup_state"}, func(p *query.JobSearchParams) { p.PickupState = "METRO MANILA" }},
+	{"pickup_country", "jobs_reference", []string{"pickup_country"}, func(p *query.JobSearchParams) { p.PickupCountry = "PHILIPPINES" }},
+	{"delivery_postcode", "jobs_reference", []string{"delivery_postal_code"}, func(p *query.JobSearchParams) { p.DeliveryPostcode = "1001" }},
+	{"delivery_postcode_prefix", "jobs_reference", []string{"delivery_postal_code"}, func(p *query.JobSearchParams) { p.DeliveryPostcodePrefix = "10" }},
+	{"delivery_city", "jobs_reference", []string{"delivery_city"}, func(p *query.JobSearchParams) { p.DeliveryCity = "MANILA" }},
+	{"delivery_state", "jobs_reference", []string{"delivery_state"}, func(p *query.JobSearchParams) { p.DeliveryState = "METRO MANILA" }},
+	{"delivery_country", "jobs_reference", []string{"delivery_country"}, func(p *query.JobSearchParams) { p.DeliveryCountry = "PHILIPPINES" }},
+	{"customer_ref", "job_customer_refs", []string{"ref"}, func(p *query.JobSearchParams) { p.CustomerRef = "PO-1" }},
+	{"shipment_tags", "job_tags", []string{"tag"}, func(p *query.JobSearchParams) { p.ShipmentTags = []string{"fragile", "cold"} }},
+	{"order_tags", "order_tags", []string{"tag"}, func(p *query.JobSearchParams) { p.OrderTags = []string{"vip"} }},
+	{"near", "job_locations", []string{"leg", "cell"}, func(p *query.JobSearchParams) {
+		p.Near, p.RadiusKm = &geo.Point{Lat: 14.5995, Lon: 120.9842}, 5
+	}},
+	{"bbox", "job_locations", []string{"leg", "cell"}, func(p *query.JobSearchParams) {
+		p.BBox = &geo.BoundingBox{MinLat: 14.5, MinLon: 120.9, MaxLat: 14.7, MaxLon: 121.1}
+	}},
+	{"q", "jobs_keywords", []string{"token"}, func(p *query.JobSearchParams) { p.Text = "quiapo clinic" }},
+}
+
+// orgScoped are the tables the search compares org_id on, jobs_reference is only joined by uuid
+var orgScoped = map[string]bool{
+	"jobs":              true,
+	"job_customer_refs": true,
+	"job_tags":          true,
+	"order_tags":        true,
+	"job_locations":     true,
+	"jobs_keywords":     true,
+}
+
+// aliases of the search sql, plans of TiDB and mysql name the tables by alias
+var aliases = map[string]string{"a": "jobs", "b": "jobs_reference"}
+
+// Case is a combination of filters and the search sql of it
+type Case struct {
+	Filters []*Filter
+	Params  *query.JobSearchParams
+	SQL     string
+}
+
+func (c *Case) Name() string {
+	names := make([]string, 0, len(c.Filters))
+	for _, f := range c.Filters {
+		names = append(names, f.Name)
+	}
+	if len(names) == 0 {
+		return "org_id"
+	}
+	return strings.Join(names, "+")
+}
+
+// Combinations returns a case per combination of up to maxFilters filters, starting with the org
+// only search. All combinations of the 35 filters are too many to explain, pairs already show how
+// the filters of two tables are planned together
+func Combinations(filters []*Filter, maxFilters int, orgID string) []*Case {
+	cases := make([]*Case, 0)
+
+	var combine func(start int, picked []*Filter)
+	combine = func(start int, picked []*Filter) {
+		params := &query.JobSearchParams{PageSize: 10}
+		for _, f := range picked {
+			f.Apply(params)
+		}
+		cases = append(cases, &Case{
+			Filters: append([]*Filter(nil), picked...),
+			Params:  params,
+			SQL:     db.MakeSearchSQLStatements(params, orgID)[0],
+		})
+
+		if len(picked) == maxFilters {
+			return
+		}
+		for i := start; i < len(filters); i++ {
+			combine(i+1, append(picked, filters[i]))
+		}
+	}
+	combine(0, nil)
+
+	sort.SliceStable(cases, func(i, j int) bool { return len(cases[i].Filters) < len(cases[j].Filters) })
+	return cases
+}
+
+// CaseReport is the plan of a case: the tables read in full, the indexes used and the indexes
+// which match only part of the columns the case compares
+type CaseReport struct {
+	Name      string   `json:"name"`
+	SQL       string   `json:"sql"`
+	FullScans []string `json:"full_scans,omitempty"`
+	Indexes   []string `json:"indexes,omitempty"`
+	Partial   []string `json:"partial,omitempty"`
+	Error     string   `json:"error,omitempty"`
+}
+
+// Report covers all cases, UnusedIndexes are the secondary indexes of the searched tables no plan used
+type Report struct {
+	Cases         []*CaseReport `json:"cases"`
+	UnusedIndexes []string      `json:"unused_indexes"`
+}
+
+// Advisor explains the cases on the database of the connection
+type Advisor struct {
+	DB       *sql.DB
+	Database string
+}
+
+func (a *Advisor) Run(ctx context.Context, cases []*Case) (*Report, error) {
+	indexes, err := LoadIndexes(ctx, a.DB, a.Database)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Cases: make([]*CaseReport, 0, len(cases)), UnusedIndexes: make([]string, 0)}
+	used := make(map[string]bool)
+	searched := map[string]bool{"jobs": true}
+
+	for _, c := range cases {
+		for _, f := range c.Filters {
+			searched[f.Table] = true
+		}
+
+		cr := &CaseReport{Name: c.Name(), SQL: c.SQL}
+		report.Cases = append(report.Cases, cr)
+
+		accesses, err := Explain(ctx, a.DB, c.SQL)
+		if err != nil {
+			cr.Error = err.Error()
+			continue
+		}
+
+		for _, access := range accesses {
+			table := access.Table
+			if t, ok := aliases[table]; ok {
+				table = t
+			}
+
+			index := findIndex(indexes[table], access)
+			if index == nil {
+				if access.FullScan {
+					cr.FullScans = appendOnce(cr.FullScans, table)
+				}
+				continue
+			}
+
+			used[index.String()] = true
+			name := index.String()
+			if access.FullScan {
+				name += " full index scan"
+				cr.FullScans = appendOnce(cr.FullScans, table)
+			}
+			cr.Indexes = appendOnce(cr.Indexes, name)
+
+			if partial := partialMatch(index, c.columns(table)); partial != "" {
+				cr.Partial = appendOnce(cr.Partial, partial)
+			}
+		}
+	}
+
+	for table, list := range indexes {
+		if !searched[table] {
+			continue
+		}
+		for _, index := range list {
+			if index.Name != "PRIMARY" && !used[index.String()] {
+				report.UnusedIndexes = append(report.UnusedIndexes, index.String())
+			}
+		}
+	}
+	sort.Strings(report.UnusedIndexes)
+
+	return report, nil
+}
+
+// columns returns the columns the case compares on the table, the org scope and the uuid the
+// tables are joined by included
+func (c *Case) columns(table string) map[string]bool {
+	cols := map[string]bool{"uuid": true}
+	if orgScoped[table] {
+		cols["org_id"] = true
+	}
+	for _, f := range c.Filters {
+		if f.Table != table {
+			continue
+		}
+		for _, col := range f.Columns {
+			cols[col] = true
+		}
+	}
+	return cols
+}
+
+// partialMatch describes the index if a column the case compares follows a column the case does not,
+// e.g. status of (org_id,updated_at,status) when the search compares org_id and status only
+func partialMatch(index *Index, compared map[string]bool) string {
+	matched := 0
+	for _, col := range index.Columns {
+		if !compared[col] {
+			break
+		}
+		matched++
+	}
+
+	missed := make([]string, 0)
+	for _, col := range index.Columns[matched:] {
+		if compared[col] && col != "uuid" {
+			missed = append(missed, col)
+		}
+	}
+	if len(missed) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%s matches (%s) only, %s not used", index, strings.Join(index.Columns[:matched], ","), strings.Join(missed, ","))
+}
+
+func findIndex(indexes []*Index, access *Access) *Index {
+	for _, index := range indexes {
+		if access.Index != "" && strings.EqualFold(index.Name, access.Index) {
+			return index
+		}
+		if access.Index == "" && len(access.Columns) > 0 && strings.EqualFold(strings.Join(index.Columns, ","), strings.Join(access.Columns, ",")) {
+			return index
+		}
+	}
+	return nil
+}
+
+func appendOnce(list []string, s string) []string {
+	for _, v := range list {
+		if v == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
@@ -0,0 +1,145 @@
+package advisor
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/db/dbtest"
+	"poc-ddb-tidb-search/pkg/query"
+)
+
+func TestFiltersCoverParams(t *testing.T) {
+	set := make(map[string]bool)
+	for _, f := range Filters {
+		params := query.JobSearchParams{}
+		f.Apply(&params)
+
+		v := reflect.ValueOf(params)
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Field(i).IsZero() {
+				set[v.Type().Field(i).Name] = true
+			}
+		}
+	}
+
+	// modifiers of other filters and paging
+	for _, name := range []string{"TagMatch", "GeoLeg", "Facets", "PageSize", "PageNumber"} {
+		set[name] = true
+	}
+
+	fields := reflect.TypeOf(query.JobSearchParams{})
+	for i := 0; i < fields.NumField(); i++ {
+		assert.True(t, set[fields.Field(i).Name], "no advisor filter sets %s", fields.Field(i).Name)
+	}
+}
+
+func TestCombinations(t *testing.T) {
+	n := len(Filters)
+
+	assert.Len(t, Combinations(Filters, 0, "org1"), 1)
+	assert.Len(t, Combinations(Filters, 1, "org1"), 1+n)
+
+	cases := Combinations(Filters, 2, "org1")
+	assert.Len(t, cases, 1+n+n*(n-1)/2)
+	assert.Equal(t, "org_id", cases[0].Name())
+	assert.Equal(t, "shipment_id", cases[1].Name())
+	assert.Equal(t, "shipment_id+order_id", cases[1+n].Name())
+	assert.Equal(t, "bbox+q", cases[len(cases)-1].Name())
+	assert.Contains(t, cases[1+n].SQL, "shipment_id='SHP-1'")
+	assert.Contains(t, cases[1+n].SQL, "order_id='ORD-1'")
+}
+
+func TestParsePlan(t *testing.T) {
+	tidb := [][]string{
+		{"Projection_7", "10.00", "root", "", "dispatchDB.jobs.uuid, dispatchDB.jobs.detail"},
+		{"└─IndexLookUp_14", "10.00", "root", "", ""},
+		{"  ├─IndexRangeScan_12(Build)", "10.00", "cop[tikv]", "table:a, index:shpID_idx(org_id, shipment_id)", "range:[\"org1\" \"SHP-1\",\"org1\" \"SHP-1\"]"},
+		{"  └─TableRowIDScan_13(Probe)", "10.00", "cop[tikv]", "table:a", "keep order:false"},
+		{"└─TableFullScan_20", "10000.00", "cop[tikv]", "table:b", "keep order:false"},
+		{"└─IndexFullScan_22", "10000.00", "cop[tikv]", "table:job_tags, index:uuid_idx(uuid)", "keep order:false"},
+	}
+	accesses, err := ParsePlan([]string{"id", "estRows", "task", "access object", "operator info"}, tidb)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Access{
+		{Table: "a", Index: "shpID_idx"},
+		{Table: "a"},
+		{Table: "b", FullScan: true},
+		{Table: "job_tags", Index: "uuid_idx", FullScan: true},
+	}, accesses)
+
+	mysql := [][]string{
+		{"1", "PRIMARY", "a", "", "ref", "shpID_idx", "shpID_idx", "406", "const,const", "1", "100.00", ""},
+		{"1", "PRIMARY", "b", "", "ALL", "", "", "", "", "1000", "10.00", "Using where"},
+		{"2", "DERIVED", "<derived2>", "", "ALL", "", "", "", "", "2", "100.00", ""},
+	}
+	accesses, err = ParsePlan([]string{"id", "select_type", "table", "partitions", "type", "possible_keys", "key", "key_len", "ref", "rows", "filtered", "Extra"}, mysql)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Access{{Table: "a", Index: "shpID_idx"}, {Table: "b", FullScan: true}}, accesses)
+
+	tree := [][]string{
+		{"Project"},
+		{" └─ LeftOuterJoin"},
+		{"     ├─ TableAlias(a)"},
+		{"     │   └─ IndexedTableAccess(jobs)"},
+		{"     │       ├─ index: [jobs.org_id,jobs.updated_at,jobs.status]"},
+		{"     │       └─ filters: [{[org1, org1], [NULL, ∞), [NULL, ∞)}]"},
+		{"     └─ TableAlias(b)"},
+		{"         └─ Table"},
+		{"             └─ name: jobs_reference"},
+	}
+	accesses, err = ParsePlan([]string{"plan"}, tree)
+	assert.NoError(t, err)
+	assert.Equal(t, []*Access{
+		{Table: "jobs", Columns: []string{"org_id", "updated_at", "status"}},
+		{Table: "jobs_reference", FullScan: true},
+	}, accesses)
+
+	_, err = ParsePlan([]string{"what"}, nil)
+	assert.Error(t, err)
+}
+
+func TestPartialMatch(t *testing.T) {
+	index := &Index{Table: "jobs", Name: "dateStatus_idx", Columns: []string{"org_id", "updated_at", "status"}}
+
+	assert.Equal(t, "jobs.dateStatus_idx(org_id,updated_at,status) matches (org_id) only, status not used",
+		partialMatch(index, map[string]bool{"org_id": true, "status": true}))
+	assert.Empty(t, partialMatch(index, map[string]bool{"org_id": true}))
+	assert.Empty(t, partialMatch(index, map[string]bool{"org_id": true, "updated_at": true, "status": true}))
+}
+
+func TestAdvisorRun(t *testing.T) {
+	ctx := context.Background()
+	conn := dbtest.NewMySQL(t, db.TiDB_DatabaseName)
+
+	migrator, err := db.NewMigrator(conn)
+	assert.NoError(t, err)
+	_, err = migrator.Up(ctx, 0)
+	assert.NoError(t, err)
+
+	adv := &Advisor{DB: conn, Database: db.TiDB_DatabaseName}
+	report, err := adv.Run(ctx, Combinations(Filters, 1, "org1"))
+	assert.NoError(t, err)
+	assert.Len(t, report.Cases, 1+len(Filters))
+
+	byName := make(map[string]*CaseReport)
+	for _, c := range report.Cases {
+		assert.Empty(t, c.Error, c.Name)
+		byName[c.Name] = c
+	}
+
+	assert.Contains(t, byName["shipment_id"].Indexes, "jobs.shpID_idx(org_id,shipment_id)")
+	assert.Empty(t, byName["shipment_id"].FullScans)
+
+	// the status predicate follows updated_at, which the search never compares
+	assert.Contains(t, byName["status"].Partial, "jobs.dateStatus_idx(org_id,updated_at,status) matches (org_id) only, status not used")
+
+	// jobs_reference is joined by uuid, its org_id prefixed indexes don't match the joined filters
+	assert.Contains(t, byName["vendor_name"].FullScans, "jobs_reference")
+
+	assert.Contains(t, report.UnusedIndexes, "jobs_reference.dateStreet_idx(updated_at,job_street)")
+	assert.NotContains(t, report.UnusedIndexes, "jobs.shpID_idx(org_id,shipment_id)")
+}
@@ -0,0 +1,198 @@
+package advisor
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Access is how a query plan reads a table, Index is empty for a full table scan. Plans naming the
+// index columns instead of the index leave Index empty and set Columns
+type Access struct {
+	Table    string
+	Index    string
+	Columns  []string
+	FullScan bool
+}
+
+// Index is a secondary or primary index of a table, the columns in index order
+type Index struct {
+	Table   string
+	Name    string
+	Columns []string
+}
+
+func (i *Index) String() string {
+	return fmt.Sprintf("%s.%s(%s)", i.Table, i.Name, strings.Join(i.Columns, ","))
+}
+
+var (
+	tidbTable    = regexp.MustCompile(`table:([\w$]+)`)
+	tidbIndex    = regexp.MustCompile(`index:([\w$]+)\(`)
+	treeIndexed  = regexp.MustCompile(`IndexedTableAccess\(([\w$]+)\)`)
+	treeIndexCol = regexp.MustCompile(`index: \[([^\]]*)\]`)
+	treeName     = regexp.MustCompile(`name: ([\w$]+)`)
+)
+
+// Explain runs EXPLAIN on the statement and returns the table accesses of the plan
+func Explain(ctx context.Context, conn *sql.DB, stmt string) ([]*Access, error) {
+	rows, err := conn.QueryContext(ctx, "EXPLAIN "+stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := make([][]string, 0)
+	for rows.Next() {
+		vals := make([]sql.NullString, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+
+		row := make([]string, len(vals))
+		for i, v := range vals {
+			row[i] = v.String
+		}
+		plan = append(plan, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ParsePlan(columns, plan)
+}
+
+// ParsePlan reads the table accesses of an EXPLAIN result. It understands the TiDB plan rows,
+// the mysql tabular format and the plan tree of go-mysql-server the tests run against
+func ParsePlan(columns []string, rows [][]string) ([]*Access, error) {
+	col := make(map[string]int)
+	for i, c := range columns {
+		col[strings.ToLower(c)] = i
+	}
+
+	if _, ok := col["access object"]; ok {
+		return parseTiDBPlan(col, rows), nil
+	}
+	if _, ok := col["key"]; ok {
+		return parseMySQLPlan(col, rows), nil
+	}
+	if _, ok := col["plan"]; ok && len(columns) == 1 {
+		return parseTreePlan(rows), nil
+	}
+
+	return nil, fmt.Errorf("unknown explain format with columns %v", columns)
+}
+
+// parseTiDBPlan reads the scan operators, e.g. TableFullScan_5 with access object "table:jobs" or
+// IndexRangeScan_8 with "table:jobs, index:shpID_idx(org_id, shipment_id)"
+func parseTiDBPlan(col map[string]int, rows [][]string) []*Access {
+	accesses := make([]*Access, 0)
+	for _, row := range rows {
+		id, object := row[col["id"]], row[col["access object"]]
+
+		table := tidbTable.FindStringSubmatch(object)
+		if table == nil || !strings.Contains(id, "Scan") {
+			continue
+		}
+
+		access := &Access{Table: table[1]}
+		if index := tidbIndex.FindStringSubmatch(object); index != nil {
+			access.Index = index[1]
+		}
+		access.FullScan = strings.Contains(id, "FullScan")
+		accesses = append(accesses, access)
+	}
+	return accesses
+}
+
+// parseMySQLPlan reads a row per table, type ALL is a full table scan and type index a full index scan
+func parseMySQLPlan(col map[string]int, rows [][]string) []*Access {
+	accesses := make([]*Access, 0)
+	for _, row := range rows {
+		table := row[col["table"]]
+		if table == "" || strings.HasPrefix(table, "<") {
+			continue // derived and union results
+		}
+
+		access := &Access{Table: table, Index: row[col["key"]]}
+		if t, ok := col["type"]; ok {
+			access.FullScan = row[t] == "ALL" || row[t] == "index"
+		}
+		accesses = append(accesses, access)
+	}
+	return accesses
+}
+
+// parseTreePlan reads the go-mysql-server plan, a line per node: IndexedTableAccess(jobs) followed by
+// its "index: [jobs.org_id,jobs.status]" line, or a full scan as Table followed by "name: jobs"
+func parseTreePlan(rows [][]string) []*Access {
+	lines := make([]string, 0, len(rows))
+	for _, row := range rows {
+		lines = append(lines, strings.Split(row[0], "\n")...)
+	}
+
+	accesses := make([]*Access, 0)
+	for i, line := range lines {
+		node := strings.TrimLeft(line, " │├└─")
+		next := ""
+		if i+1 < len(lines) {
+			next = lines[i+1]
+		}
+
+		if m := treeIndexed.FindStringSubmatch(node); m != nil {
+			access := &Access{Table: m[1]}
+			if cols := treeIndexCol.FindStringSubmatch(next); cols != nil {
+				for _, c := range strings.Split(cols[1], ",") {
+					access.Columns = append(access.Columns, c[strings.LastIndex(c, ".")+1:])
+				}
+			}
+			accesses = append(accesses, access)
+			continue
+		}
+
+		if node == "Table" {
+			if m := treeName.FindStringSubmatch(next); m != nil {
+				accesses = append(accesses, &Access{Table: m[1], FullScan: true})
+			}
+		}
+	}
+	return accesses
+}
+
+// LoadIndexes reads the indexes of the database from information_schema, per table
+func LoadIndexes(ctx context.Context, conn *sql.DB, database string) (map[string][]*Index, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT table_name, index_name, column_name FROM information_schema.statistics "+
+		"WHERE table_schema=? ORDER BY table_name, index_name, seq_in_index", database)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	indexes := make(map[string][]*Index)
+	for rows.Next() {
+		var table, name, column string
+		if err := rows.Scan(&table, &name, &column); err != nil {
+			return nil, err
+		}
+
+		list := indexes[table]
+		if len(list) == 0 || list[len(list)-1].Name != name {
+			list = append(list, &Index{Table: table, Name: name})
+		}
+		last := list[len(list)-1]
+		last.Columns = append(last.Columns, column)
+		indexes[table] = list
+	}
+	return indexes, rows.Err()
+}
@@ -0,0 +1,176 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"poc-ddb-tidb-search/pkg/models"
+	"poc-ddb-tidb-search/pkg/query"
+
+	"poc-ddb-tidb-search/pkg/db"
+
+	"github.com/aws/aws-lambda-go/events"
+	logger "github.com/sirupsen/logrus"
+)
+
+// Search answers GET searches with query parameters or saved searches, and POST filter searches
+type Search struct {
+	Connect       func() (db.DB, error) // opens TiDB for a request, it is closed once answered
+	SavedSearches db.DB
+}
+
+func (s *Search) Handle(ctx context.Context, request events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	logger.Info("reading params")
+
+	var start = time.Now()
+
+	orgID := query.GetOrgID(&request)
+
+	var saved *query.JobSearchParams
+	if id := request.QueryStringParameters["saved"]; id != "" && request.HTTPMethod != http.MethodPost {
+		ss, err := s.loadSavedSearch(orgID, query.GetUserID(&request), id)
+		if errors.Is(err, db.ErrSavedSearchNotFound) {
+			return &events.APIGatewayProxyResponse{
+				StatusCode: http.StatusNotFound,
+			}, nil
+		}
+		if err != nil {
+			logger.WithFields(logger.Fields{
+				"error": err.Error(),
+				"code":  "DDBErr",
+			}).Error("failed to load saved search")
+			return &events.APIGatewayProxyResponse{
+				StatusCode: http.StatusInternalServerError,
+			}, nil
+		}
+		saved = ss.Params
+	}
+
+	stmts, pageSize, err := makeSearchStatements(&request, orgID, saved)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "ParamsErr",
+		}).Error("failed to parse request parameters")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusBadRequest,
+		}, nil
+	}
+
+	tiDB, err := s.Connect()
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TiDBErr",
+		}).Error("failed to connect to TiDB instance")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	defer tiDB.Close()
+
+	res, err := searchInTiDB(tiDB, stmts, start)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "TiDBErr",
+		}).Error("failed to query TiDB")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	res.PageSize = pageSize
+
+	jsonRes, err := json.Marshal(res)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "JSONErr",
+		}).Error("failed to marshal jobs")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+		Body:       string(jsonRes),
+	}, nil
+}
+
+func (s *Search) loadSavedSearch(orgID, userID, id string) (*db.SavedSearch, error) {
+	if s.SavedSearches == nil {
+		return nil, errors.New("no saved search table")
+	}
+
+	return db.GetSavedSearch(s.SavedSearches, orgID, userID, id)
+}
+
+// makeSearchStatements builds the queries of a GET search with query parameters, overriding
+// the saved params if any, or of a POST search with a filter body
+func makeSearchStatements(request *events.APIGatewayProxyRequest, orgID string, saved *query.JobSearchParams) ([]any, int, error) {
+	if request.HTTPMethod == http.MethodPost {
+		fs, err := query.FilterSearchFromRequest(request)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		sqlStms, err := db.MakeFilterSearchSQLStatements(fs, orgID)
+		if err != nil {
+			return nil, 0, err
+		}
+		return []any{sqlStms[0], sqlStms[1]}, fs.PageSize, nil
+	}
+
+	var params *query.JobSearchParams
+	var err error
+	if saved != nil {
+		params, err = query.ParametersFromSavedSearch(saved, request)
+	} else {
+		params, err = query.ParametersFromRequest(request)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sqlStms := db.MakeSearchSQLStatements(params, orgID)
+
+	stmts := []any{sqlStms[0], sqlStms[1]}
+	for _, fq := range db.MakeFacetSQLStatements(params, orgID) {
+		stmts = append(stmts, fq)
+	}
+	return stmts, params.PageSize, nil
+}
+
+func searchInTiDB(tiDB db.DB, stmts []any, start time.Time) (*query.JobSearchResult, error) {
+
+	res, err := tiDB.Search(stmts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return makeFinalResult(res, start)
+}
+
+func makeFinalResult(res any, start time.Time) (*query.JobSearchResult, error) {
+	var dbResult = res.(*db.TiDBResult)
+	var result = new(query.JobSearchResult)
+	result.Data = make([]*query.JobRow, 0)
+	result.TotalItems = dbResult.TotalItems
+	result.Facets = dbResult.Facets
+
+	for _, row := range dbResult.Details {
+		jobJson, _ := base64.StdEncoding.DecodeString(row.Detail)
+		var job = new(models.Job)
+		json.Unmarshal(jobJson, job)
+		result.Data = append(result.Data, &query.JobRow{UUID: row.UUID, Job: job})
+	}
+
+	result.ResponseTime = time.Since(start).String()
+	return result, nil
+}
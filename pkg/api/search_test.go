@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/db/localsql"
+	"poc-ddb-tidb-search/pkg/models"
+	"poc-ddb-tidb-search/pkg/query"
+)
+
+func newTestSearch(t *testing.T, tiDB db.DB) *Search {
+	saved := db.NewMemoryDDB()
+	assert.NoError(t, saved.SetTableName("saved"))
+	assert.NoError(t, db.SaveSavedSearch(saved, &db.SavedSearch{
+		OrgID: "org1", UserID: "u1", ID: "s1", Name: "failed",
+		Params: &query.JobSearchParams{Status: "failed", PageSize: 5},
+	}))
+
+	return &Search{
+		Connect:       func() (db.DB, error) { return tiDB, nil },
+		SavedSearches: saved,
+	}
+}
+
+func searchRequest(method string, params map[string]string, body string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		HTTPMethod:            method,
+		Resource:              "/search",
+		Headers:               map[string]string{"orgid": "org1", "userid": "u1"},
+		QueryStringParameters: params,
+		Body:                  body,
+	}
+}
+
+func TestSearchHandle(t *testing.T) {
+	detail, err := json.Marshal(&models.Job{ID: "job1", Status: models.StatusFailed})
+	assert.NoError(t, err)
+
+	tiDB := &db.RecordingTiDB{SearchFunc: func(input ...any) (*db.TiDBResult, error) {
+		return &db.TiDBResult{
+			TotalItems: 1,
+			Details:    []*db.TiDBRow{{UUID: "u-1", Detail: base64.StdEncoding.EncodeToString(detail)}},
+		}, nil
+	}}
+	search := newTestSearch(t, tiDB)
+
+	resp, err := search.Handle(context.Background(), searchRequest(http.MethodGet, map[string]string{"status": "failed"}, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	res := new(query.JobSearchResult)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), res))
+	assert.Equal(t, 1, res.TotalItems)
+	assert.Equal(t, "u-1", res.Data[0].UUID)
+	assert.Equal(t, "job1", res.Data[0].Job.ID)
+
+	searches := tiDB.Searches()
+	assert.Len(t, searches, 1)
+	assert.Contains(t, searches[0][0], "org1")
+	assert.Contains(t, searches[0][0], "failed")
+}
+
+func TestSearchSavedAndFilter(t *testing.T) {
+	tiDB := &db.RecordingTiDB{}
+	search := newTestSearch(t, tiDB)
+
+	resp, err := search.Handle(context.Background(), searchRequest(http.MethodGet, map[string]string{"saved": "s1"}, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	res := new(query.JobSearchResult)
+	assert.NoError(t, json.Unmarshal([]byte(resp.Body), res))
+	assert.Equal(t, 5, res.PageSize, "the saved params are used")
+	assert.Contains(t, tiDB.Searches()[0][0], "failed")
+
+	resp, err = search.Handle(context.Background(), searchRequest(http.MethodGet, map[string]string{"saved": "missing"}, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = search.Handle(context.Background(), searchRequest(http.MethodPost, nil, `{"filter":{"field":"status","op":"eq","value":"new"},"page_size":3}`))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	stmt, ok := tiDB.Searches()[1][0].(*db.SQLStatement)
+	assert.True(t, ok, "filter searches are parameterized")
+	assert.Contains(t, stmt.Args, "new")
+
+	resp, err = search.Handle(context.Background(), searchRequest(http.MethodPost, nil, `{"filter":{"field":"nope","op":"eq","value":"x"}}`))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestSearchOnEngine(t *testing.T) {
+	dsn, stop, err := localsql.Start(db.TiDB_DatabaseName)
+	assert.NoError(t, err)
+	t.Cleanup(stop)
+
+	conn, err := sql.Open("mysql", dsn)
+	assert.NoError(t, err)
+	migrator, err := db.NewMigrator(conn)
+	assert.NoError(t, err)
+	_, err = migrator.Up(context.Background(), 0)
+	assert.NoError(t, err)
+
+	payload, err := os.ReadFile("../../testData/job.json")
+	assert.NoError(t, err)
+
+	tiDB := db.NewTiDBFromConn(conn)
+	for i, status := range []models.Status{models.StatusFailed, models.StatusNew} {
+		job := new(models.Job)
+		assert.NoError(t, json.Unmarshal(payload, job))
+		job.OrgID2, job.ID, job.Status = "org1", "job"+strconv.Itoa(i), status
+
+		stmts, err := db.MakeInsertJobSQLStatements(job, "u-"+strconv.Itoa(i))
+		assert.NoError(t, err)
+		puts := make([]any, 0, len(stmts))
+		for _, stmt := range stmts {
+			puts = append(puts, stmt)
+		}
+		_, err = tiDB.Put(puts...)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tiDB.Close())
+
+	// every request opens its own connection, the handler closes it
+	search := newTestSearch(t, nil)
+	search.Connect = func() (db.DB, error) {
+		conn, err := sql.Open("mysql", dsn)
+		return db.NewTiDBFromConn(conn), err
+	}
+
+	for _, req := range []events.APIGatewayProxyRequest{
+		searchRequest(http.MethodGet, map[string]string{"status": "failed"}, ""),
+		searchRequest(http.MethodGet, map[string]string{"saved": "s1"}, ""),
+		searchRequest(http.MethodPost, nil, `{"filter":{"field":"status","op":"eq","value":"failed"}}`),
+	} {
+		resp, err := search.Handle(context.Background(), req)
+		assert.NoError(t, err)
+		if !assert.Equal(t, http.StatusOK, resp.StatusCode, resp.Body) {
+			continue
+		}
+
+		res := new(query.JobSearchResult)
+		assert.NoError(t, json.Unmarshal([]byte(resp.Body), res))
+		assert.Equal(t, 1, res.TotalItems)
+		if assert.Len(t, res.Data, 1) {
+			assert.Equal(t, "job0", res.Data[0].Job.ID)
+		}
+	}
+}
+
+func TestSearchTiDBErrors(t *testing.T) {
+	search := newTestSearch(t, &db.RecordingTiDB{SearchFunc: func(input ...any) (*db.TiDBResult, error) {
+		return nil, errors.New("query failed")
+	}})
+
+	resp, err := search.Handle(context.Background(), searchRequest(http.MethodGet, map[string]string{"status": "new"}, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	search.Connect = func() (db.DB, error) { return nil, errors.New("no connection") }
+	resp, err = search.Handle(context.Background(), searchRequest(http.MethodGet, map[string]string{"status": "new"}, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	search.SavedSearches = nil
+	resp, err = search.Handle(context.Background(), searchRequest(http.MethodGet, map[string]string{"saved": "s1"}, ""))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
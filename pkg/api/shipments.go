@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/models"
+
+	"github.com/aws/aws-lambda-go/events"
+	logger "github.com/sirupsen/logrus"
+)
+
+// Shipments stores the received shipments as jobs of the table, the table stream syncs them to TiDB
+type Shipments struct {
+	Jobs db.DB
+}
+
+func (s *Shipments) Handle(ctx context.Context, req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	job, err := parseBody(req.Body)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "ParseErr",
+		}).Error("failed to parse request body")
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusBadRequest,
+		}, nil
+	}
+
+	err = s.insertJob(job)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "CFGErr",
+		}).Error("failed to insert record into DynamoDB")
+
+		return &events.APIGatewayProxyResponse{
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: http.StatusOK,
+	}, nil
+}
+
+func parseBody(body string) (*models.Job, error) {
+	job := new(models.Job)
+
+	err := json.Unmarshal([]byte(body), job)
+	if err != nil {
+		return nil, err
+	}
+
+	job.OrgID2 = "POC-TEST-ORGID-001122" // pk
+	job.DocID = job.ID                   // sk
+	return job, nil
+}
+
+func (s *Shipments) insertJob(job *models.Job) error {
+	_, err := s.Jobs.Put(job)
+	return err
+}
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/models"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBody(t *testing.T) {
+	testPayload, err := os.ReadFile("../../testData/job.json")
+	assert.NoError(t, err)
+
+	job, err := parseBody(string(testPayload))
+	assert.NoError(t, err)
+
+	// just check key fields
+	assert.Equal(t, "SHIPMENT#default_9655995f-c682-44e4-9ebd-888a404b7b15_0e7c5b46-653e-4447-9257-0dd00e333df5_delivery", job.PK)
+	assert.Equal(t, "default_9655995f-c682-44e4-9ebd-888a404b7b15_0e7c5b46-653e-4447-9257-0dd00e333df5_delivery", job.ID)
+	assert.Equal(t, models.Status("unallocated"), job.Status)
+	assert.Equal(t, "POC-TEST-ORGID-001122", job.OrgID2)
+	assert.Equal(t, job.ID, job.DocID)
+}
+
+func TestShipmentsHandle(t *testing.T) {
+	testPayload, err := os.ReadFile("../../testData/job.json")
+	assert.NoError(t, err)
+
+	jobs := db.NewMemoryDDB()
+	assert.NoError(t, jobs.SetTableName("jobs"))
+	shipments := &Shipments{Jobs: jobs}
+
+	resp, err := shipments.Handle(context.Background(), events.APIGatewayProxyRequest{Body: string(testPayload)})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	job := new(models.Job)
+	assert.NoError(t, json.Unmarshal(testPayload, job))
+	item, err := jobs.Get(&db.DDBKey{OrgID: "POC-TEST-ORGID-001122", DocID: job.ID})
+	assert.NoError(t, err)
+	assert.NotNil(t, item)
+
+	resp, err = shipments.Handle(context.Background(), events.APIGatewayProxyRequest{Body: "not json"})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// a table without its name set fails like dynamodb
+	shipments.Jobs = db.NewMemoryDDB()
+	resp, err = shipments.Handle(context.Background(), events.APIGatewayProxyRequest{Body: string(testPayload)})
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
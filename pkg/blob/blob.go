@@ -0,0 +1,28 @@
+package blob
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// Store is a minimal object store used for large artifacts such as exports
+type Store interface {
+	Put(ctx context.Context, key string, body io.ReadSeeker) (string, error) // returns the object location
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+}
+
+// NewStoreFromEnv returns an S3 store when EXPORT_BUCKET is set, otherwise a local filesystem store
+// rooted at EXPORT_DIR (defaults to the os temp dir)
+func NewStoreFromEnv(ctx context.Context) (Store, error) {
+	if bucket := os.Getenv("EXPORT_BUCKET"); bucket != "" {
+		return NewS3Store(ctx, bucket)
+	}
+
+	dir := os.Getenv("EXPORT_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+
+	return NewLocalStore(dir)
+}
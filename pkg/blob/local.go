@@ -0,0 +1,73 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type localStore struct {
+	root string
+}
+
+// NewLocalStore stores objects as plain files under root, handy for local runs and tests
+func NewLocalStore(root string) (Store, error) {
+	if root == "" {
+		return nil, errors.New("empty root directory")
+	}
+
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return nil, err
+	}
+
+	return &localStore{root: abs}, nil
+}
+
+func (ls *localStore) Put(ctx context.Context, key string, body io.ReadSeeker) (string, error) {
+	path, err := ls.path(key)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, body); err != nil {
+		return "", err
+	}
+
+	return "file://" + path, nil
+}
+
+func (ls *localStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := ls.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Open(path)
+}
+
+func (ls *localStore) path(key string) (string, error) {
+	path := filepath.Join(ls.root, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, ls.root+string(filepath.Separator)) {
+		return "", errors.New("invalid object key")
+	}
+
+	return path, nil
+}
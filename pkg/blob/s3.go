@@ -0,0 +1,59 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"poc-ddb-tidb-search/pkg/session"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type s3Store struct {
+	client *s3.Client
+	bucket string
+}
+
+// NewS3Store stores objects in the given bucket
+func NewS3Store(ctx context.Context, bucket string) (Store, error) {
+	if bucket == "" {
+		return nil, errors.New("empty bucket name")
+	}
+
+	cfg, success := session.GetSessionConfig(ctx)
+	if !success {
+		return nil, errors.New("failed to load aws config")
+	}
+
+	return &s3Store{
+		client: s3.NewFromConfig(cfg),
+		bucket: bucket,
+	}, nil
+}
+
+func (ss *s3Store) Put(ctx context.Context, key string, body io.ReadSeeker) (string, error) {
+	_, err := ss.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(ss.bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("s3://%s/%s", ss.bucket, key), nil
+}
+
+func (ss *s3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := ss.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(ss.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return out.Body, nil
+}
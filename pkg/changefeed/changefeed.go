@@ -0,0 +1,72 @@
+package changefeed
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Handler processes a batch of table changes, it has the signature of the stream lambda handler
+// so the stream receiver can be fed by any Feed
+type Handler func(context.Context, events.DynamoDBEvent) (events.DynamoDBEventResponse, error)
+
+// Feed delivers the changes of a table to the handler in order, until the context is done.
+// Like a lambda stream trigger, a failed change and the ones after it are delivered again
+type Feed interface {
+	Run(ctx context.Context, handler Handler) error
+}
+
+const defaultRetryDelay = time.Second
+
+// handle delivers the batch and returns how many of its records are done, every record
+// before the first failure reported by the handler
+func handle(ctx context.Context, handler Handler, records []events.DynamoDBEventRecord) (int, error) {
+	resp, err := handler(ctx, events.DynamoDBEvent{Records: records})
+	if err != nil {
+		return 0, err
+	}
+
+	done := len(records)
+	for _, failure := range resp.BatchItemFailures {
+		i := indexOf(records, failure.ItemIdentifier)
+		if i < 0 {
+			return 0, errors.New("batch item failure without a known sequence number")
+		}
+		if i < done {
+			done = i
+		}
+	}
+
+	if done < len(records) {
+		return done, errors.New("change " + records[done].Change.SequenceNumber + " failed")
+	}
+	return done, nil
+}
+
+func indexOf(records []events.DynamoDBEventRecord, sequenceNumber string) int {
+	for i := range records {
+		if records[i].Change.SequenceNumber == sequenceNumber {
+			return i
+		}
+	}
+	return -1
+}
+
+// wait sleeps for d, false if the context is done first
+func wait(ctx context.Context, d time.Duration) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
@@ -0,0 +1,206 @@
+package changefeed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/stretchr/testify/assert"
+
+	"poc-ddb-tidb-search/pkg/db"
+)
+
+type item struct {
+	OrgID  string `json:"orgID"`
+	DocID  string `json:"docID"`
+	Status string `json:"status"`
+}
+
+// collect handles the changes, failing the ones whose new status is "fail" until allowed
+type collect struct {
+	events    []events.DynamoDBEventRecord
+	allowFail bool
+}
+
+func (c *collect) handle(ctx context.Context, event events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
+	resp := events.DynamoDBEventResponse{}
+	for _, r := range event.Records {
+		if status, ok := r.Change.NewImage["status"]; ok && status.String() == "fail" && !c.allowFail {
+			resp.BatchItemFailures = append(resp.BatchItemFailures, events.DynamoDBBatchItemFailure{ItemIdentifier: r.Change.SequenceNumber})
+			continue
+		}
+		c.events = append(c.events, r)
+	}
+	return resp, nil
+}
+
+func TestTableFeedsOutbox(t *testing.T) {
+	outbox := NewOutbox()
+	ddb := db.NewMemoryDDB()
+	assert.NoError(t, ddb.SetTableName("jobs"))
+	table := NewTable(ddb, outbox)
+
+	_, err := table.Put(&item{OrgID: "org1", DocID: "job1", Status: "new"})
+	assert.NoError(t, err)
+	_, err = table.Put(&item{OrgID: "org1", DocID: "job1", Status: "done"})
+	assert.NoError(t, err)
+	assert.NoError(t, table.Delete(&db.DDBKey{OrgID: "org1", DocID: "job1"}))
+	assert.NoError(t, table.Delete(&db.DDBKey{OrgID: "org1", DocID: "missing"}))
+	_, err = table.Put(&item{Status: "no keys"})
+	assert.Error(t, err)
+
+	assert.Equal(t, 3, outbox.Pending())
+
+	c := &collect{}
+	assert.NoError(t, outbox.Drain(context.Background(), c.handle))
+	assert.Equal(t, 0, outbox.Pending())
+	assert.Len(t, c.events, 3)
+
+	insert, modify, remove := c.events[0], c.events[1], c.events[2]
+	assert.Equal(t, "INSERT", insert.EventName)
+	assert.Nil(t, insert.Change.OldImage)
+	assert.Equal(t, "new", insert.Change.NewImage["status"].String())
+	assert.Equal(t, "job1", insert.Change.Keys["docID"].String())
+	assert.NotContains(t, insert.Change.Keys, "status")
+
+	assert.Equal(t, "MODIFY", modify.EventName)
+	assert.Equal(t, "new", modify.Change.OldImage["status"].String())
+	assert.Equal(t, "done", modify.Change.NewImage["status"].String())
+
+	assert.Equal(t, "REMOVE", remove.EventName)
+	assert.Equal(t, "done", remove.Change.OldImage["status"].String())
+	assert.Nil(t, remove.Change.NewImage)
+	assert.Equal(t, "org1", remove.Change.Keys["orgID"].String())
+
+	assert.True(t, insert.Change.SequenceNumber < modify.Change.SequenceNumber)
+	assert.True(t, modify.Change.SequenceNumber < remove.Change.SequenceNumber)
+}
+
+func TestOutboxRetriesFromFailedChange(t *testing.T) {
+	outbox := NewOutbox()
+	outbox.BatchSize = 2
+	for _, status := range []string{"a", "fail", "b"} {
+		image := map[string]types.AttributeValue{"status": &types.AttributeValueMemberS{Value: status}}
+		assert.NoError(t, outbox.Append("INSERT", nil, nil, image))
+	}
+
+	c := &collect{}
+	assert.Error(t, outbox.Drain(context.Background(), c.handle))
+	assert.Len(t, c.events, 1)
+	assert.Equal(t, 2, outbox.Pending(), "the failed change and the ones after it stay pending")
+
+	c.allowFail = true
+	assert.NoError(t, outbox.Drain(context.Background(), c.handle))
+	assert.Len(t, c.events, 3)
+	assert.Equal(t, "fail", c.events[1].Change.NewImage["status"].String())
+	assert.Equal(t, "b", c.events[2].Change.NewImage["status"].String())
+}
+
+func TestOutboxRun(t *testing.T) {
+	outbox := NewOutbox()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	handled := make(chan string, 1)
+	done := make(chan error)
+	go func() {
+		done <- outbox.Run(ctx, func(ctx context.Context, event events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
+			for _, r := range event.Records {
+				handled <- r.EventName
+			}
+			return events.DynamoDBEventResponse{}, nil
+		})
+	}()
+
+	assert.NoError(t, outbox.Append("INSERT", nil, nil, nil))
+	select {
+	case name := <-handled:
+		assert.Equal(t, "INSERT", name)
+	case <-time.After(time.Second):
+		t.Fatal("change was not handled")
+	}
+
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+// fakeStreams serves one shard, every GetRecords returns the records from the iterator position
+type fakeStreams struct {
+	records   []streamtypes.Record
+	iterators []string
+}
+
+func (f *fakeStreams) DescribeStream(ctx context.Context, in *dynamodbstreams.DescribeStreamInput, _ ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error) {
+	return &dynamodbstreams.DescribeStreamOutput{StreamDescription: &streamtypes.StreamDescription{
+		Shards: []streamtypes.Shard{{ShardId: aws.String("shard1")}},
+	}}, nil
+}
+
+func (f *fakeStreams) GetShardIterator(ctx context.Context, in *dynamodbstreams.GetShardIteratorInput, _ ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	pos := "0"
+	if in.ShardIteratorType == streamtypes.ShardIteratorTypeAtSequenceNumber {
+		pos = *in.SequenceNumber
+	}
+	f.iterators = append(f.iterators, string(in.ShardIteratorType)+":"+pos)
+	return &dynamodbstreams.GetShardIteratorOutput{ShardIterator: aws.String(pos)}, nil
+}
+
+func (f *fakeStreams) GetRecords(ctx context.Context, in *dynamodbstreams.GetRecordsInput, _ ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error) {
+	out := &dynamodbstreams.GetRecordsOutput{NextShardIterator: aws.String("3")}
+	for _, r := range f.records {
+		if *r.Dynamodb.SequenceNumber >= *in.ShardIterator {
+			out.Records = append(out.Records, r)
+		}
+	}
+	return out, nil
+}
+
+func streamRecord(seq, status string) streamtypes.Record {
+	created := time.Unix(1680000000, 0)
+	return streamtypes.Record{
+		EventID:   aws.String("ev" + seq),
+		EventName: streamtypes.OperationTypeModify,
+		Dynamodb: &streamtypes.StreamRecord{
+			ApproximateCreationDateTime: &created,
+			SequenceNumber:              aws.String(seq),
+			Keys:                        map[string]streamtypes.AttributeValue{"docID": &streamtypes.AttributeValueMemberS{Value: "job" + seq}},
+			NewImage: map[string]streamtypes.AttributeValue{
+				"status": &streamtypes.AttributeValueMemberS{Value: status},
+				"tags":   &streamtypes.AttributeValueMemberSS{Value: []string{"x"}},
+				"nested": &streamtypes.AttributeValueMemberM{Value: map[string]streamtypes.AttributeValue{
+					"n": &streamtypes.AttributeValueMemberN{Value: "1"},
+				}},
+			},
+		},
+	}
+}
+
+func TestStreamFeedRewindsToFailedRecord(t *testing.T) {
+	client := &fakeStreams{records: []streamtypes.Record{streamRecord("1", "a"), streamRecord("2", "fail")}}
+	feed := &StreamFeed{Client: client, StreamARN: "arn", IteratorType: streamtypes.ShardIteratorTypeTrimHorizon, BatchSize: 10}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &collect{}
+	err := feed.Run(ctx, func(ctx context.Context, event events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
+		resp, err := c.handle(ctx, event)
+		c.allowFail = true
+		if len(c.events) == 2 {
+			cancel()
+		}
+		return resp, err
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, []string{"TRIM_HORIZON:0", "AT_SEQUENCE_NUMBER:2"}, client.iterators)
+	assert.Len(t, c.events, 2)
+	assert.Equal(t, "1", c.events[0].Change.SequenceNumber)
+	assert.Equal(t, "2", c.events[1].Change.SequenceNumber)
+	assert.Equal(t, "job2", c.events[1].Change.Keys["docID"].String())
+	assert.Equal(t, []string{"x"}, c.events[1].Change.NewImage["tags"].StringSet())
+	assert.Equal(t, "1", c.events[1].Change.NewImage["nested"].Map()["n"].Number())
+	assert.Equal(t, int64(1680000000), c.events[1].Change.ApproximateCreationDateTime.Unix())
+}
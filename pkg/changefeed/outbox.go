@@ -0,0 +1,237 @@
+package changefeed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/ddbstream"
+)
+
+// Outbox is an in-process change feed, the changes appended to it are delivered as stream
+// records of a NEW_AND_OLD_IMAGES stream. It lets the whole sync run locally without a stream
+type Outbox struct {
+	BatchSize  int
+	RetryDelay time.Duration
+	Now        func() time.Time
+
+	mu      sync.Mutex
+	records []events.DynamoDBEventRecord
+	seq     int64
+	signal  chan struct{}
+}
+
+func NewOutbox() *Outbox {
+	return &Outbox{
+		BatchSize:  100,
+		RetryDelay: defaultRetryDelay,
+		Now:        time.Now,
+		signal:     make(chan struct{}, 1),
+	}
+}
+
+// Append records a change of an item, INSERT has no old image and REMOVE no new image
+func (o *Outbox) Append(eventName string, keys, oldImage, newImage map[string]types.AttributeValue) error {
+	record := events.DynamoDBEventRecord{
+		EventName:    eventName,
+		EventSource:  "aws:dynamodb",
+		EventVersion: "1.1",
+	}
+
+	var err error
+	if record.Change.Keys, err = ddbstream.ToStreamImage(keys); err != nil {
+		return err
+	}
+	if record.Change.OldImage, err = ddbstream.ToStreamImage(oldImage); err != nil {
+		return err
+	}
+	if record.Change.NewImage, err = ddbstream.ToStreamImage(newImage); err != nil {
+		return err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.seq++
+	record.EventID = strconv.FormatInt(o.seq, 10)
+	record.Change.SequenceNumber = fmt.Sprintf("%021d", o.seq)
+	record.Change.StreamViewType = string(events.DynamoDBStreamViewTypeNewAndOldImages)
+	record.Change.ApproximateCreationDateTime = events.SecondsEpochTime{Time: o.Now().UTC().Truncate(time.Second)}
+	o.records = append(o.records, record)
+
+	select {
+	case o.signal <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Pending returns the number of changes not handled yet
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.records)
+}
+
+// Drain delivers the pending changes in batches until none are left, stopping at the first
+// failed change which stays pending
+func (o *Outbox) Drain(ctx context.Context, handler Handler) error {
+	for {
+		batch := o.batch()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		done, err := handle(ctx, handler, batch)
+		o.mu.Lock()
+		o.records = o.records[done:]
+		o.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Run drains the outbox every time changes are appended, retrying failures after RetryDelay
+func (o *Outbox) Run(ctx context.Context, handler Handler) error {
+	for {
+		if err := o.Drain(ctx, handler); err != nil {
+			if !wait(ctx, o.RetryDelay) {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-o.signal:
+		}
+	}
+}
+
+func (o *Outbox) batch() []events.DynamoDBEventRecord {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := len(o.records)
+	if o.BatchSize > 0 && n > o.BatchSize {
+		n = o.BatchSize
+	}
+	return append([]events.DynamoDBEventRecord(nil), o.records[:n]...)
+}
+
+// table feeds the outbox with the writes of a ddb table, the way the table stream would
+type table struct {
+	db.DB
+	outbox *Outbox
+	mu     sync.Mutex
+}
+
+// NewTable wraps a ddb table so every Put and Delete appends its change to the outbox. The table
+// Get must return the item attributes like the dynamodb implementation
+func NewTable(ddb db.DB, outbox *Outbox) db.DB {
+	return &table{DB: ddb, outbox: outbox}
+}
+
+func (t *table) Put(input ...any) (any, error) {
+	if len(input) == 0 {
+		return nil, nil
+	}
+
+	item, err := db.MarshalDDBItem(input[0])
+	if err != nil {
+		return nil, err
+	}
+	keys, key, err := itemKeys(item)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	old, err := t.item(key)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := t.DB.Put(input...)
+	if err != nil {
+		return nil, err
+	}
+
+	eventName := string(events.DynamoDBOperationTypeInsert)
+	if old != nil {
+		eventName = string(events.DynamoDBOperationTypeModify)
+	}
+	return out, t.outbox.Append(eventName, keys, old, item)
+}
+
+func (t *table) Delete(input any) error {
+	key, ok := input.(*db.DDBKey)
+	if !ok || key == nil {
+		return fmt.Errorf("unsupported ddb key %T", input)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	old, err := t.item(key)
+	if err != nil {
+		return err
+	}
+
+	if err := t.DB.Delete(key); err != nil {
+		return err
+	}
+	if old == nil {
+		return nil // nothing was removed, the stream has no record either
+	}
+
+	keys, _, err := itemKeys(old)
+	if err != nil {
+		return err
+	}
+	return t.outbox.Append(string(events.DynamoDBOperationTypeRemove), keys, old, nil)
+}
+
+func (t *table) item(key *db.DDBKey) (map[string]types.AttributeValue, error) {
+	out, err := t.DB.Get(key)
+	if err != nil || out == nil {
+		return nil, err
+	}
+
+	item, ok := out.(map[string]types.AttributeValue)
+	if !ok {
+		return nil, fmt.Errorf("unexpected item type %T", out)
+	}
+	if len(item) == 0 {
+		return nil, nil
+	}
+	return item, nil
+}
+
+// itemKeys returns the orgID and docID key attributes of the item
+func itemKeys(item map[string]types.AttributeValue) (map[string]types.AttributeValue, *db.DDBKey, error) {
+	key := new(db.DDBKey)
+	if err := db.UnmarshalDDBItem(item, key); err != nil {
+		return nil, nil, err
+	}
+	if key.OrgID == "" || key.DocID == "" {
+		return nil, nil, errors.New("item is missing its orgID or docID key")
+	}
+
+	return map[string]types.AttributeValue{
+		"orgID": item["orgID"],
+		"docID": item["docID"],
+	}, key, nil
+}
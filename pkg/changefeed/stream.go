@@ -0,0 +1,288 @@
+package changefeed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+
+	"poc-ddb-tidb-search/pkg/session"
+)
+
+type StreamsClient interface {
+	DescribeStream(context.Context, *dynamodbstreams.DescribeStreamInput, ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error)
+	GetShardIterator(context.Context, *dynamodbstreams.GetShardIteratorInput, ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error)
+	GetRecords(context.Context, *dynamodbstreams.GetRecordsInput, ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error)
+}
+
+// StreamFeed polls the shards of a table stream, what the lambda event source mapping does in
+// the deployed stack. Child shards are read once their parent is finished
+type StreamFeed struct {
+	Client       StreamsClient
+	StreamARN    string
+	IteratorType types.ShardIteratorType // where to start reading the shards open at startup
+	BatchSize    int32
+	PollInterval time.Duration
+	RetryDelay   time.Duration
+}
+
+func NewStreamFeed(ctx context.Context, streamARN string) (*StreamFeed, error) {
+	cfg, success := session.GetSessionConfig(ctx)
+	if !success {
+		return nil, errors.New("failed to load aws config")
+	}
+
+	return &StreamFeed{
+		Client:       dynamodbstreams.NewFromConfig(cfg),
+		StreamARN:    streamARN,
+		IteratorType: types.ShardIteratorTypeLatest,
+		BatchSize:    100,
+		PollInterval: time.Second,
+		RetryDelay:   defaultRetryDelay,
+	}, nil
+}
+
+type shardReader struct {
+	iterator *string
+}
+
+func (sf *StreamFeed) Run(ctx context.Context, handler Handler) error {
+	readers := make(map[string]*shardReader)
+	finished := make(map[string]bool)
+
+	if err := sf.discover(ctx, readers, finished, sf.IteratorType); err != nil {
+		return err
+	}
+
+	for {
+		closed := false
+		for shardID, r := range readers {
+			if err := sf.poll(ctx, handler, shardID, r); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				if !wait(ctx, sf.RetryDelay) {
+					return ctx.Err()
+				}
+				continue
+			}
+
+			if r.iterator == nil {
+				delete(readers, shardID)
+				finished[shardID] = true
+				closed = true
+			}
+		}
+
+		// the children of a finished shard are read from their first record
+		if closed || len(readers) == 0 {
+			if err := sf.discover(ctx, readers, finished, types.ShardIteratorTypeTrimHorizon); err != nil {
+				return err
+			}
+		}
+
+		if !wait(ctx, sf.PollInterval) {
+			return ctx.Err()
+		}
+	}
+}
+
+// poll handles the next records of the shard, a failure moves its iterator back to the failed record
+func (sf *StreamFeed) poll(ctx context.Context, handler Handler, shardID string, r *shardReader) error {
+	out, err := sf.Client.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{
+		ShardIterator: r.iterator,
+		Limit:         aws.Int32(sf.BatchSize),
+	})
+	if err != nil {
+		return err
+	}
+
+	records, err := ConvertStreamRecords(out.Records)
+	if err != nil {
+		return err
+	}
+
+	if len(records) > 0 {
+		done, err := handle(ctx, handler, records)
+		if err != nil {
+			return sf.rewind(ctx, shardID, r, records[done].Change.SequenceNumber)
+		}
+	}
+
+	r.iterator = out.NextShardIterator
+	return nil
+}
+
+func (sf *StreamFeed) rewind(ctx context.Context, shardID string, r *shardReader, sequenceNumber string) error {
+	out, err := sf.Client.GetShardIterator(ctx, &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         aws.String(sf.StreamARN),
+		ShardId:           aws.String(shardID),
+		ShardIteratorType: types.ShardIteratorTypeAtSequenceNumber,
+		SequenceNumber:    aws.String(sequenceNumber),
+	})
+	if err != nil {
+		return err
+	}
+
+	r.iterator = out.ShardIterator
+	return fmt.Errorf("change %s failed", sequenceNumber)
+}
+
+// discover starts reading the shards that are not read yet and whose parent, if still in the
+// stream, is finished
+func (sf *StreamFeed) discover(ctx context.Context, readers map[string]*shardReader, finished map[string]bool, iteratorType types.ShardIteratorType) error {
+	shards := make([]types.Shard, 0)
+	known := make(map[string]bool)
+
+	input := &dynamodbstreams.DescribeStreamInput{StreamArn: aws.String(sf.StreamARN)}
+	for {
+		out, err := sf.Client.DescribeStream(ctx, input)
+		if err != nil {
+			return err
+		}
+		for _, shard := range out.StreamDescription.Shards {
+			shards = append(shards, shard)
+			known[aws.ToString(shard.ShardId)] = true
+		}
+
+		if out.StreamDescription.LastEvaluatedShardId == nil {
+			break
+		}
+		input.ExclusiveStartShardId = out.StreamDescription.LastEvaluatedShardId
+	}
+
+	for _, shard := range shards {
+		shardID := aws.ToString(shard.ShardId)
+		if readers[shardID] != nil || finished[shardID] {
+			continue
+		}
+
+		parent := aws.ToString(shard.ParentShardId)
+		if parent != "" && known[parent] && !finished[parent] {
+			continue
+		}
+
+		// closed shards left from before startup only matter when reading from the start
+		if iteratorType == types.ShardIteratorTypeLatest && shard.SequenceNumberRange != nil && shard.SequenceNumberRange.EndingSequenceNumber != nil {
+			finished[shardID] = true
+			continue
+		}
+
+		out, err := sf.Client.GetShardIterator(ctx, &dynamodbstreams.GetShardIteratorInput{
+			StreamArn:         aws.String(sf.StreamARN),
+			ShardId:           aws.String(shardID),
+			ShardIteratorType: iteratorType,
+		})
+		if err != nil {
+			return err
+		}
+		readers[shardID] = &shardReader{iterator: out.ShardIterator}
+	}
+
+	return nil
+}
+
+// ConvertStreamRecords converts the records read from the streams api to the lambda event records
+func ConvertStreamRecords(records []types.Record) ([]events.DynamoDBEventRecord, error) {
+	out := make([]events.DynamoDBEventRecord, 0, len(records))
+
+	for _, r := range records {
+		record := events.DynamoDBEventRecord{
+			AWSRegion:    aws.ToString(r.AwsRegion),
+			EventID:      aws.ToString(r.EventID),
+			EventName:    string(r.EventName),
+			EventSource:  aws.ToString(r.EventSource),
+			EventVersion: aws.ToString(r.EventVersion),
+		}
+
+		if sr := r.Dynamodb; sr != nil {
+			change := events.DynamoDBStreamRecord{
+				SequenceNumber: aws.ToString(sr.SequenceNumber),
+				SizeBytes:      aws.ToInt64(sr.SizeBytes),
+				StreamViewType: string(sr.StreamViewType),
+			}
+			if sr.ApproximateCreationDateTime != nil {
+				change.ApproximateCreationDateTime = events.SecondsEpochTime{Time: *sr.ApproximateCreationDateTime}
+			}
+
+			var err error
+			if change.Keys, err = convertImage(sr.Keys); err != nil {
+				return nil, err
+			}
+			if change.OldImage, err = convertImage(sr.OldImage); err != nil {
+				return nil, err
+			}
+			if change.NewImage, err = convertImage(sr.NewImage); err != nil {
+				return nil, err
+			}
+			record.Change = change
+		}
+
+		out = append(out, record)
+	}
+
+	return out, nil
+}
+
+func convertImage(item map[string]types.AttributeValue) (map[string]events.DynamoDBAttributeValue, error) {
+	if item == nil {
+		return nil, nil
+	}
+
+	image := make(map[string]events.DynamoDBAttributeValue, len(item))
+	for k, v := range item {
+		sv, err := convertAttribute(v)
+		if err != nil {
+			return nil, err
+		}
+		image[k] = sv
+	}
+	return image, nil
+}
+
+func convertAttribute(av types.AttributeValue) (events.DynamoDBAttributeValue, error) {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberB:
+		return events.NewBinaryAttribute(v.Value), nil
+	case *types.AttributeValueMemberBOOL:
+		return events.NewBooleanAttribute(v.Value), nil
+	case *types.AttributeValueMemberBS:
+		return events.NewBinarySetAttribute(v.Value), nil
+	case *types.AttributeValueMemberL:
+		list := make([]events.DynamoDBAttributeValue, 0, len(v.Value))
+		for _, lv := range v.Value {
+			o, err := convertAttribute(lv)
+			if err != nil {
+				return events.DynamoDBAttributeValue{}, err
+			}
+			list = append(list, o)
+		}
+		return events.NewListAttribute(list), nil
+	case *types.AttributeValueMemberM:
+		m, err := convertImage(v.Value)
+		if err != nil {
+			return events.DynamoDBAttributeValue{}, err
+		}
+		if m == nil {
+			m = make(map[string]events.DynamoDBAttributeValue)
+		}
+		return events.NewMapAttribute(m), nil
+	case *types.AttributeValueMemberN:
+		return events.NewNumberAttribute(v.Value), nil
+	case *types.AttributeValueMemberNS:
+		return events.NewNumberSetAttribute(v.Value), nil
+	case *types.AttributeValueMemberNULL:
+		return events.NewNullAttribute(), nil
+	case *types.AttributeValueMemberS:
+		return events.NewStringAttribute(v.Value), nil
+	case *types.AttributeValueMemberSS:
+		return events.NewStringSetAttribute(v.Value), nil
+	}
+
+	return events.DynamoDBAttributeValue{}, fmt.Errorf("unhandled attribute %T", av)
+}
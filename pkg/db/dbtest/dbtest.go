@@ -0,0 +1,29 @@
+// Package dbtest runs an in-process mysql compatible server for tests of the TiDB statements
+package dbtest
+
+import (
+	"database/sql"
+	"testing"
+
+	"poc-ddb-tidb-search/pkg/db/localsql"
+)
+
+// NewMySQL starts a server with an empty database and returns a connection to it, the statements
+// go through the mysql driver like they do against TiDB. The server stops with the test
+func NewMySQL(t testing.TB, database string) *sql.DB {
+	t.Helper()
+
+	dsn, stop, err := localsql.Start(database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(stop)
+
+	conn, err := sql.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	logger "github.com/sirupsen/logrus"
 )
 
@@ -20,6 +22,18 @@ type dynamoDB struct {
 type ddbResult struct {
 }
 
+// DDBKey addresses an item by its orgID partition key and docID sort key
+type DDBKey struct {
+	OrgID string `json:"orgID"`
+	DocID string `json:"docID"`
+}
+
+// DDBQuery lists the items of an org whose docID starts with DocIDPrefix
+type DDBQuery struct {
+	OrgID       string
+	DocIDPrefix string
+}
+
 func NewDDB(ctx context.Context) DB {
 	client := getDDBClient(ctx)
 	return &dynamoDB{
@@ -44,9 +58,7 @@ func (ddb *dynamoDB) Put(input ...any) (any, error) {
 		return nil, errors.New("no table specified")
 	}
 
-	av, err := attributevalue.MarshalMapWithOptions(input[0], func(opt *attributevalue.EncoderOptions) {
-		opt.TagKey = "json" // should have dynamodbav tags so we dont need to pass options
-	})
+	av, err := MarshalDDBItem(input[0])
 	if err != nil {
 		logger.WithFields(logger.Fields{
 			"error": err.Error(),
@@ -70,19 +82,123 @@ func (ddb *dynamoDB) Put(input ...any) (any, error) {
 	return nil, nil
 }
 
+// Get fetches the item of a *DDBKey, nil if it does not exist. See UnmarshalDDBItem
 func (ddb *dynamoDB) Get(input any) (any, error) {
+	key, err := ddb.marshalKey(input)
+	if err != nil {
+		return nil, err
+	}
 
-	return nil, nil
+	out, err := ddb.client.GetItem(ddb.ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(ddb.tableName),
+		Key:       key,
+	})
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "DDBGetErr",
+		}).Error("failed to get item from ddb")
+		return nil, err
+	}
+
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+	return out.Item, nil
 }
 
+// Delete removes the item of a *DDBKey
 func (ddb *dynamoDB) Delete(input any) error {
+	key, err := ddb.marshalKey(input)
+	if err != nil {
+		return err
+	}
+
+	_, err = ddb.client.DeleteItem(ddb.ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(ddb.tableName),
+		Key:       key,
+	})
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "DDBDeleteErr",
+		}).Error("failed to delete item from ddb")
+		return err
+	}
 
 	return nil
 }
 
+// Search queries the items of a *DDBQuery, following the pages until all items are read
 func (ddb *dynamoDB) Search(input ...any) (any, error) {
+	if len(input) == 0 {
+		return nil, errors.New("no query specified")
+	}
+	if ddb.tableName == "" {
+		return nil, errors.New("no table specified")
+	}
 
-	return nil, nil
+	q, ok := input[0].(*DDBQuery)
+	if !ok {
+		return nil, fmt.Errorf("unsupported ddb query %T", input[0])
+	}
+
+	keyCond := "orgID = :orgID"
+	values := map[string]types.AttributeValue{":orgID": &types.AttributeValueMemberS{Value: q.OrgID}}
+	if q.DocIDPrefix != "" {
+		keyCond += " and begins_with(docID, :prefix)"
+		values[":prefix"] = &types.AttributeValueMemberS{Value: q.DocIDPrefix}
+	}
+
+	items := make([]map[string]types.AttributeValue, 0)
+	paginator := dynamodb.NewQueryPaginator(ddb.client, &dynamodb.QueryInput{
+		TableName:                 aws.String(ddb.tableName),
+		KeyConditionExpression:    aws.String(keyCond),
+		ExpressionAttributeValues: values,
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ddb.ctx)
+		if err != nil {
+			logger.WithFields(logger.Fields{
+				"error": err.Error(),
+				"code":  "DDBQueryErr",
+			}).Error("failed to query ddb")
+			return nil, err
+		}
+		items = append(items, page.Items...)
+	}
+
+	return items, nil
+}
+
+func (ddb *dynamoDB) marshalKey(input any) (map[string]types.AttributeValue, error) {
+	if ddb.tableName == "" {
+		return nil, errors.New("no table specified")
+	}
+
+	key, ok := input.(*DDBKey)
+	if !ok || key == nil {
+		return nil, fmt.Errorf("unsupported ddb key %T", input)
+	}
+
+	return attributevalue.MarshalMapWithOptions(key, func(opt *attributevalue.EncoderOptions) {
+		opt.TagKey = "json"
+	})
+}
+
+// MarshalDDBItem encodes an item the way Put stores it
+func MarshalDDBItem(in any) (map[string]types.AttributeValue, error) {
+	return attributevalue.MarshalMapWithOptions(in, func(opt *attributevalue.EncoderOptions) {
+		opt.TagKey = "json" // should have dynamodbav tags so we dont need to pass options
+	})
+}
+
+// UnmarshalDDBItem decodes an item returned by Get or Search into out, using the json tags like Put
+func UnmarshalDDBItem(item map[string]types.AttributeValue, out any) error {
+	return attributevalue.UnmarshalMapWithOptions(item, out, func(opt *attributevalue.DecoderOptions) {
+		opt.TagKey = "json"
+	})
 }
 
 func (ddb *dynamoDB) Close() error {
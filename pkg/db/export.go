@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type ExportStatus string
+
+const (
+	ExportStatusQueued    ExportStatus = "queued"
+	ExportStatusRunning   ExportStatus = "running"
+	ExportStatusCompleted ExportStatus = "completed"
+	ExportStatusFailed    ExportStatus = "failed"
+)
+
+// ExportJob tracks an asynchronous export request in the export_jobs table
+type ExportJob struct {
+	ID         string       `json:"id"`
+	OrgID      string       `json:"org_id"`
+	Format     string       `json:"format"`
+	Params     string       `json:"-"` // json encoded query.JobSearchParams
+	Status     ExportStatus `json:"status"`
+	Location   string       `json:"location,omitempty"`
+	TotalItems int          `json:"total_items"`
+	Error      string       `json:"error,omitempty"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+var ErrExportJobNotFound = errors.New("export job not found")
+
+// SaveExportJob inserts the export job or updates its progress if it already exists
+func SaveExportJob(tiDB DB, job *ExportJob) error {
+	q := fmt.Sprintf("Insert into %s.export_jobs (`id`,`org_id`,`format`,`params`,`status`,`location`,`total_items`,`error`) values (?,?,?,?,?,?,?,?) "+
+		"on duplicate key update `status`=values(`status`), `location`=values(`location`), `total_items`=values(`total_items`), `error`=values(`error`)", TiDB_DatabaseName)
+
+	_, err := tiDB.GetTiDBConn().ExecContext(context.Background(), q,
+		job.ID, job.OrgID, job.Format, job.Params, job.Status, job.Location, job.TotalItems, job.Error)
+	return err
+}
+
+// GetExportJob fetches an export job, scoped to the org that requested it
+func GetExportJob(tiDB DB, orgID, id string) (*ExportJob, error) {
+	q := fmt.Sprintf("Select `id`,`org_id`,`format`,`params`,`status`,`location`,`total_items`,`error`,`created_at`,`updated_at` from %s.export_jobs where org_id=? and id=?", TiDB_DatabaseName)
+
+	job := new(ExportJob)
+	err := tiDB.GetTiDBConn().QueryRowContext(context.Background(), q, orgID, id).Scan(&job.ID, &job.OrgID, &job.Format, &job.Params,
+		&job.Status, &job.Location, &job.TotalItems, &job.Error, &job.CreatedAt, &job.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrExportJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
@@ -0,0 +1,171 @@
+package db
+
+import (
+	"fmt"
+	"poc-ddb-tidb-search/pkg/query"
+	"strings"
+)
+
+// SQLStatement is a parameterized query, Search runs it like the plain string statements
+type SQLStatement struct {
+	SQL  string
+	Args []any
+}
+
+// filterColumns maps the query.FilterFields to their columns, jobs is aliased a and jobs_reference b
+var filterColumns = map[string]string{
+	"shipment_id":           "a.shipment_id",
+	"order_id":              "a.order_id",
+	"job_id":                "a.job_id",
+	"status":                "a.status",
+	"start_time":            "a.start_time",
+	"commit_time":           "a.commit_time",
+	"completed_time":        "a.completed_time",
+	"cod_amount":            "a.cod_amount",
+	"vendor_name":           "b.assigned_vendor",
+	"facility_name":         "b.assigned_facility",
+	"sender_name":           "b.sender_name",
+	"consignee_name":        "b.consignee_name",
+	"customer_account_name": "b.customer_account_name",
+	"driver_id":             "b.driver_id",
+	"driver_name":           "b.driver_name",
+	"vehicle_number":        "b.vehicle_number",
+	"tracking_id":           "b.tracking_id",
+	"client_order_code":     "b.client_order_code",
+	"order_label":           "b.order_label",
+	"shipment_label":        "b.shipment_label",
+	"package_label":         "b.package_label",
+	"pickup_postcode":       "b.pickup_postal_code",
+	"pickup_city":           "b.pickup_city",
+	"pickup_state":          "b.pickup_state",
+	"pickup_country":        "b.pickup_country",
+	"delivery_postcode":     "b.delivery_postal_code",
+	"delivery_city":         "b.delivery_city",
+	"delivery_state":        "b.delivery_state",
+	"delivery_country":      "b.delivery_country",
+}
+
+// filterTables are the child tables of the list fields, as table and value column
+var filterTables = map[string][2]string{
+	"shipment_tags": {"job_tags", "tag"},
+	"order_tags":    {"order_tags", "tag"},
+	"customer_ref":  {"job_customer_refs", "ref"},
+}
+
+// MakeFilterSearchSQLStatements returns the page and total count queries of a parsed filter search.
+// Only whitelisted columns end up in the sql, every value is a placeholder argument
+func MakeFilterSearchSQLStatements(fs *query.FilterSearch, orgID string) ([]*SQLStatement, error) {
+	cond, args, err := compileFilter(fs.Root, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	from := fmt.Sprintf("%s.jobs a left join %s.jobs_reference b on a.uuid = b.uuid", TiDB_DatabaseName, TiDB_DatabaseName)
+	where := "a.org_id=? and " + cond
+	args = append([]any{orgID}, args...)
+
+	q := fmt.Sprintf("Select a.uuid, a.detail from %s where %s order by a.uuid limit %d, %d", from, where, fs.PageNumber*fs.PageSize, fs.PageSize)
+	q2 := fmt.Sprintf("Select count(*) as totalrec from %s where %s", from, where)
+
+	return []*SQLStatement{{SQL: q, Args: args}, {SQL: q2, Args: args}}, nil
+}
+
+// compileFilter turns the filter AST into a where condition and its arguments
+func compileFilter(n query.Node, orgID string) (string, []any, error) {
+	switch node := n.(type) {
+	case *query.AndNode:
+		return compileChildren(node.Children, " and ", orgID)
+	case *query.OrNode:
+		return compileChildren(node.Children, " or ", orgID)
+	case *query.NotNode:
+		cond, args, err := compileFilter(node.Child, orgID)
+		if err != nil {
+			return "", nil, err
+		}
+		return "not (" + cond + ")", args, nil
+	case *query.CompareNode:
+		return compileCompare(node, orgID)
+	case *query.RangeNode:
+		return compileRange(node)
+	}
+
+	return "", nil, fmt.Errorf("unsupported filter node %T", n)
+}
+
+func compileChildren(children []query.Node, sep, orgID string) (string, []any, error) {
+	conds := make([]string, 0, len(children))
+	args := make([]any, 0)
+
+	for _, child := range children {
+		cond, childArgs, err := compileFilter(child, orgID)
+		if err != nil {
+			return "", nil, err
+		}
+		conds = append(conds, cond)
+		args = append(args, childArgs...)
+	}
+
+	return "(" + strings.Join(conds, sep) + ")", args, nil
+}
+
+func compileCompare(node *query.CompareNode, orgID string) (string, []any, error) {
+	args := make([]any, 0, len(node.Values))
+	for _, v := range node.Values {
+		args = append(args, v)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(args)), ",")
+
+	if node.Type == query.FieldList {
+		t, ok := filterTables[node.Field]
+		if !ok {
+			return "", nil, fmt.Errorf("unsupported filter field %q", node.Field)
+		}
+		return fmt.Sprintf("a.uuid in (Select uuid from %s.%s where org_id=? and %s in (%s))", TiDB_DatabaseName, t[0], t[1], placeholders),
+			append([]any{orgID}, args...), nil
+	}
+
+	col, ok := filterColumns[node.Field]
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported filter field %q", node.Field)
+	}
+	if node.Type == query.FieldDate {
+		col = fmt.Sprintf("cast(%s as date)", col) // same as the start_time and commit_time search params
+	}
+
+	switch node.Op {
+	case query.OpEq:
+		return col + "=?", args, nil
+	case query.OpIn:
+		return fmt.Sprintf("%s in (%s)", col, placeholders), args, nil
+	case query.OpPrefix:
+		return col + " like ?", []any{escapeLike(node.Values[0]) + "%"}, nil
+	case query.OpContains:
+		return col + " like ?", []any{"%" + escapeLike(node.Values[0]) + "%"}, nil
+	}
+
+	return "", nil, fmt.Errorf("unsupported filter op %q", node.Op)
+}
+
+func compileRange(node *query.RangeNode) (string, []any, error) {
+	col, ok := filterColumns[node.Field]
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported filter field %q", node.Field)
+	}
+
+	if node.Type == query.FieldDate {
+		// whole days like eq, lte includes the day as the report to does
+		col = fmt.Sprintf("cast(%s as date)", col)
+	}
+
+	conds := make([]string, 0, 2)
+	args := make([]any, 0, 2)
+	for _, b := range []struct{ op, v string }{{">=", node.Gte}, {">", node.Gt}, {"<=", node.Lte}, {"<", node.Lt}} {
+		if b.v == "" {
+			continue
+		}
+		conds = append(conds, fmt.Sprintf("%s %s ?", col, b.op))
+		args = append(args, b.v)
+	}
+
+	return "(" + strings.Join(conds, " and ") + ")", args, nil
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"poc-ddb-tidb-search/pkg/query"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMakeFilterSearchSQLStatements(t *testing.T) {
+	body := `{
+		"filter": {"and": [
+			{"or": [
+				{"field": "status", "op": "in", "value": ["failed", "cancelled"]},
+				{"field": "vendor_name", "op": "prefix", "value": "Acme_"}
+			]},
+			{"not": {"field": "shipment_tags", "op": "eq", "value": "fragile"}},
+			{"field": "cod_amount", "op": "range", "gte": 10, "lt": 100.5}
+		]},
+		"page_size": 10,
+		"page_number": 2
+	}`
+
+	fs, err := query.FilterSearchFromRequest(&events.APIGatewayProxyRequest{Body: body})
+	assert.NoError(t, err)
+
+	stmts, err := MakeFilterSearchSQLStatements(fs, "org1")
+	assert.NoError(t, err)
+	assert.Len(t, stmts, 2)
+
+	where := "a.org_id=? and ((a.status in (?,?) or b.assigned_vendor like ?) and " +
+		"not (a.uuid in (Select uuid from dispatchDB.job_tags where org_id=? and tag in (?))) and " +
+		"(a.cod_amount >= ? and a.cod_amount < ?))"
+	from := "dispatchDB.jobs a left join dispatchDB.jobs_reference b on a.uuid = b.uuid"
+
+	assert.Equal(t, "Select a.uuid, a.detail from "+from+" where "+where+" order by a.uuid limit 20, 10", stmts[0].SQL)
+	assert.Equal(t, "Select count(*) as totalrec from "+from+" where "+where, stmts[1].SQL)
+	assert.Equal(t, []any{"org1", "failed", "cancelled", `Acme\_%`, "org1", "fragile", "10", "100.5"}, stmts[0].Args)
+}
+
+func TestFilterSearchRejectsInvalidFilters(t *testing.T) {
+	bodies := []string{
+		`{}`,
+		`{"filter": {"field": "detail", "op": "eq", "value": "x"}}`,
+		`{"filter": {"field": "status", "op": "like", "value": "x"}}`,
+		`{"filter": {"field": "status", "op": "range", "gte": "a"}}`,
+		`{"filter": {"field": "start_time", "op": "eq", "value": "yesterday"}}`,
+		`{"filter": {"field": "order_tags", "op": "prefix", "value": "x"}}`,
+		`{"filter": {"field": "status", "op": "in", "value": []}}`,
+		`{"filter": {"and": []}}`,
+		`{"filter": {"and": [{"field": "status", "op": "eq", "value": "x"}], "field": "status"}}`,
+	}
+
+	for _, body := range bodies {
+		_, err := query.FilterSearchFromRequest(&events.APIGatewayProxyRequest{Body: body})
+		assert.Error(t, err, body)
+	}
+}
+
+func TestFilterColumnsCoverFilterFields(t *testing.T) {
+	for field, fieldType := range query.FilterFields {
+		if fieldType == query.FieldList {
+			assert.Contains(t, filterTables, field)
+			continue
+		}
+		assert.Contains(t, filterColumns, field)
+	}
+}
+
+func TestFilterSearchDates(t *testing.T) {
+	tidb := newTestTiDB(t)
+	seedSearchFixtures(t, tidb)
+
+	cases := []struct {
+		name   string
+		filter string
+		want   int
+	}{
+		{"eq date", `{"field": "start_time", "op": "eq", "value": "2023-03-04"}`, 1},
+		{"eq rfc3339 is its day", `{"field": "start_time", "op": "eq", "value": "2023-03-04T00:00:00+08:00"}`, 1},
+		{"lte includes the day", `{"field": "start_time", "op": "range", "lte": "2023-03-03"}`, 1},
+		{"lt excludes the day", `{"field": "start_time", "op": "range", "lt": "2023-03-03"}`, 0},
+		{"gt rfc3339 starts the next day", `{"field": "start_time", "op": "range", "gt": "2023-03-03T23:00:00Z"}`, 1},
+		{"range of both days", `{"field": "start_time", "op": "range", "gte": "2023-03-03", "lte": "2023-03-04"}`, 2},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			fs, err := query.FilterSearchFromRequest(&events.APIGatewayProxyRequest{Body: `{"filter": ` + tc.filter + `}`})
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			stmts, err := MakeFilterSearchSQLStatements(fs, "org1")
+			assert.NoError(t, err)
+			res, err := tidb.Search(stmts[0], stmts[1])
+			if !assert.NoError(t, err, stmts[0].SQL) {
+				return
+			}
+			assert.Equal(t, tc.want, res.(*TiDBResult).TotalItems, stmts[0].SQL)
+		})
+	}
+}
+
+func TestFilterSearchPageSize(t *testing.T) {
+	filter := `"filter": {"field": "status", "op": "eq", "value": "x"}`
+
+	_, err := query.FilterSearchFromRequest(&events.APIGatewayProxyRequest{Body: `{` + filter + `, "page_size": 101}`})
+	assert.ErrorContains(t, err, "page size")
+
+	fs, err := query.FilterSearchFromRequest(&events.APIGatewayProxyRequest{Body: `{` + filter + `, "page_size": 100}`})
+	assert.NoError(t, err)
+	assert.Equal(t, 100, fs.PageSize)
+}
@@ -0,0 +1,31 @@
+// Package localsql runs an in-process mysql compatible server standing in for TiDB, for the dev
+// server and the tests of the TiDB statements
+package localsql
+
+import (
+	"fmt"
+
+	sqle "github.com/dolthub/go-mysql-server"
+	"github.com/dolthub/go-mysql-server/memory"
+	"github.com/dolthub/go-mysql-server/server"
+	gmssql "github.com/dolthub/go-mysql-server/sql"
+	"github.com/dolthub/go-mysql-server/sql/information_schema"
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// Start starts a server with an empty database and returns the dsn to open connections with, stop
+// closes the server. The data is lost when it stops
+func Start(database string) (dsn string, stop func(), err error) {
+	engine := sqle.NewDefault(gmssql.NewDatabaseProvider(
+		memory.NewDatabase(database),
+		information_schema.NewInformationSchemaDatabase(),
+	))
+	srv, err := server.NewDefaultServer(server.Config{Protocol: "tcp", Address: "127.0.0.1:0"}, engine)
+	if err != nil {
+		return "", nil, err
+	}
+	go func() { _ = srv.Start() }()
+
+	dsn = fmt.Sprintf("root@tcp(%s)/%s?parseTime=true", srv.Listener.Addr(), database)
+	return dsn, func() { _ = srv.Close() }, nil
+}
@@ -0,0 +1,223 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// memoryDDB is an in-memory table with the semantics of the dynamodb implementation: items are
+// keyed by orgID and docID, Get and Delete take a *DDBKey and Search a *DDBQuery
+type memoryDDB struct {
+	mu        sync.RWMutex
+	tableName string
+	items     map[DDBKey]map[string]types.AttributeValue
+}
+
+// NewMemoryDDB returns an empty in-memory table, for tests and local runs
+func NewMemoryDDB() DB {
+	return &memoryDDB{items: make(map[DDBKey]map[string]types.AttributeValue)}
+}
+
+func (m *memoryDDB) SetTableName(name string) error {
+	if name == "" {
+		return errors.New("empty table name")
+	}
+	m.tableName = name
+	return nil
+}
+
+func (m *memoryDDB) Put(input ...any) (any, error) {
+	if len(input) == 0 {
+		return nil, nil
+	}
+	if m.tableName == "" {
+		return nil, errors.New("no table specified")
+	}
+
+	item, err := MarshalDDBItem(input[0])
+	if err != nil {
+		return nil, err
+	}
+
+	key := DDBKey{}
+	if err := UnmarshalDDBItem(item, &key); err != nil {
+		return nil, err
+	}
+	if key.OrgID == "" || key.DocID == "" {
+		return nil, errors.New("item is missing its orgID or docID key")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.items[key] = item
+	return nil, nil
+}
+
+// Get returns the item of a *DDBKey, nil if it does not exist
+func (m *memoryDDB) Get(input any) (any, error) {
+	key, err := m.key(input)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	item, ok := m.items[*key]
+	if !ok {
+		return nil, nil
+	}
+	return copyItem(item), nil
+}
+
+func (m *memoryDDB) Delete(input any) error {
+	key, err := m.key(input)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.items, *key)
+	return nil
+}
+
+// Search returns the items of a *DDBQuery in docID order, like a query on the sort key
+func (m *memoryDDB) Search(input ...any) (any, error) {
+	if len(input) == 0 {
+		return nil, errors.New("no query specified")
+	}
+	if m.tableName == "" {
+		return nil, errors.New("no table specified")
+	}
+
+	q, ok := input[0].(*DDBQuery)
+	if !ok {
+		return nil, fmt.Errorf("unsupported ddb query %T", input[0])
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	keys := make([]DDBKey, 0)
+	for k := range m.items {
+		if k.OrgID == q.OrgID && strings.HasPrefix(k.DocID, q.DocIDPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].DocID < keys[j].DocID })
+
+	items := make([]map[string]types.AttributeValue, 0, len(keys))
+	for _, k := range keys {
+		items = append(items, copyItem(m.items[k]))
+	}
+	return items, nil
+}
+
+func (m *memoryDDB) key(input any) (*DDBKey, error) {
+	if m.tableName == "" {
+		return nil, errors.New("no table specified")
+	}
+
+	key, ok := input.(*DDBKey)
+	if !ok || key == nil {
+		return nil, fmt.Errorf("unsupported ddb key %T", input)
+	}
+	return key, nil
+}
+
+// copyItem copies the top level attributes, so callers changing the map do not change the table
+func copyItem(item map[string]types.AttributeValue) map[string]types.AttributeValue {
+	out := make(map[string]types.AttributeValue, len(item))
+	for k, v := range item {
+		out[k] = v
+	}
+	return out
+}
+
+func (m *memoryDDB) Close() error {
+	return nil
+}
+
+func (m *memoryDDB) GetTiDBConn() *sql.DB {
+	return nil
+}
+
+// RecordingTiDB stands in for TiDB in tests of what is sent to it. It records the statements given
+// to Put and Search without running them, and answers searches with SearchFunc, an empty result
+// when it is not set. Tests of the search results run the statements with NewTiDBFromConn on a
+// dbtest server
+type RecordingTiDB struct {
+	SearchFunc func(input ...any) (*TiDBResult, error)
+	PutErr     error
+
+	mu       sync.Mutex
+	puts     [][]any
+	searches [][]any
+}
+
+func (m *RecordingTiDB) SetTableName(name string) error {
+	if name == "" {
+		return errors.New("empty table name")
+	}
+	return nil
+}
+
+// Put records the statements of the transaction, nothing is recorded when PutErr is set
+func (m *RecordingTiDB) Put(input ...any) (any, error) {
+	if m.PutErr != nil {
+		return nil, m.PutErr
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.puts = append(m.puts, input)
+	return nil, nil
+}
+
+func (m *RecordingTiDB) Get(input any) (any, error) {
+	return nil, nil
+}
+
+func (m *RecordingTiDB) Delete(input any) error {
+	return nil
+}
+
+func (m *RecordingTiDB) Search(input ...any) (any, error) {
+	m.mu.Lock()
+	m.searches = append(m.searches, input)
+	m.mu.Unlock()
+
+	if m.SearchFunc == nil {
+		return &TiDBResult{Details: make([]*TiDBRow, 0)}, nil
+	}
+	return m.SearchFunc(input...)
+}
+
+// Puts returns the statements of every Put, in order
+func (m *RecordingTiDB) Puts() [][]any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([][]any(nil), m.puts...)
+}
+
+// Searches returns the inputs of every Search, in order
+func (m *RecordingTiDB) Searches() [][]any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([][]any(nil), m.searches...)
+}
+
+func (m *RecordingTiDB) Close() error {
+	return nil
+}
+
+func (m *RecordingTiDB) GetTiDBConn() *sql.DB {
+	return nil
+}
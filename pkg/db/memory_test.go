@@ -0,0 +1,89 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+
+	"poc-ddb-tidb-search/pkg/models"
+	"poc-ddb-tidb-search/pkg/query"
+)
+
+func TestMemoryDDB(t *testing.T) {
+	ddb := NewMemoryDDB()
+
+	_, err := ddb.Put(&models.Job{})
+	assert.Error(t, err, "the table must be set like dynamodb")
+	assert.NoError(t, ddb.SetTableName("jobs"))
+
+	_, err = ddb.Put(&models.Job{ID: "no keys"})
+	assert.Error(t, err)
+
+	for _, id := range []string{"job2", "job1", "other"} {
+		_, err := ddb.Put(&models.Job{OrgID2: "org1", DocID: id, ID: id, Status: models.StatusNew})
+		assert.NoError(t, err)
+	}
+	_, err = ddb.Put(&models.Job{OrgID2: "org2", DocID: "job1", ID: "job1"})
+	assert.NoError(t, err)
+
+	// replacing the item
+	_, err = ddb.Put(&models.Job{OrgID2: "org1", DocID: "job1", ID: "job1", Status: models.StatusCompleted})
+	assert.NoError(t, err)
+
+	item, err := ddb.Get(&DDBKey{OrgID: "org1", DocID: "job1"})
+	assert.NoError(t, err)
+	job := new(models.Job)
+	assert.NoError(t, UnmarshalDDBItem(item.(map[string]types.AttributeValue), job))
+	assert.Equal(t, models.StatusCompleted, job.Status)
+
+	item, err = ddb.Get(&DDBKey{OrgID: "org1", DocID: "missing"})
+	assert.NoError(t, err)
+	assert.Nil(t, item)
+
+	_, err = ddb.Get("org1")
+	assert.Error(t, err)
+
+	res, err := ddb.Search(&DDBQuery{OrgID: "org1", DocIDPrefix: "job"})
+	assert.NoError(t, err)
+	items := res.([]map[string]types.AttributeValue)
+	assert.Len(t, items, 2)
+	assert.Equal(t, "job1", items[0]["docID"].(*types.AttributeValueMemberS).Value)
+	assert.Equal(t, "job2", items[1]["docID"].(*types.AttributeValueMemberS).Value)
+
+	assert.NoError(t, ddb.Delete(&DDBKey{OrgID: "org1", DocID: "job1"}))
+	res, err = ddb.Search(&DDBQuery{OrgID: "org1"})
+	assert.NoError(t, err)
+	assert.Len(t, res, 2)
+}
+
+func TestSavedSearchesInMemory(t *testing.T) {
+	ddb := NewMemoryDDB()
+	assert.NoError(t, ddb.SetTableName("saved"))
+
+	params := &query.JobSearchParams{Status: "failed", PageSize: 10}
+	assert.NoError(t, SaveSavedSearch(ddb, &SavedSearch{OrgID: "org1", UserID: "u1", ID: "s1", Name: "failed", Params: params}))
+	assert.NoError(t, SaveSavedSearch(ddb, &SavedSearch{OrgID: "org1", UserID: "u1", ID: "s2", Name: "watched", Params: params, Watch: &SearchWatch{Sink: WatchSinkSQS}}))
+	assert.NoError(t, SaveSavedSearch(ddb, &SavedSearch{OrgID: "org1", UserID: "u2", ID: "s3", Name: "other user", Params: params}))
+
+	s, err := GetSavedSearch(ddb, "org1", "u1", "s1")
+	assert.NoError(t, err)
+	assert.Equal(t, "failed", s.Name)
+	assert.Equal(t, "failed", s.Params.Status)
+
+	_, err = GetSavedSearch(ddb, "org1", "u2", "s1")
+	assert.ErrorIs(t, err, ErrSavedSearchNotFound)
+
+	list, err := ListSavedSearches(ddb, "org1", "u1")
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	watched, err := ListWatchedSearches(ddb, "org1")
+	assert.NoError(t, err)
+	assert.Len(t, watched, 1)
+	assert.Equal(t, "s2", watched[0].ID)
+
+	assert.NoError(t, DeleteSavedSearch(ddb, "org1", "u1", "s1"))
+	_, err = GetSavedSearch(ddb, "org1", "u1", "s1")
+	assert.ErrorIs(t, err, ErrSavedSearchNotFound)
+}
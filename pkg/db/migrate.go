@@ -0,0 +1,322 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+const createMigrationsTableSQL = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version BIGINT PRIMARY KEY,
+	name Varchar(200),
+	dirty BOOLEAN DEFAULT FALSE,
+	applied_at DATETIME DEFAULT CURRENT_TIMESTAMP
+)`
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration is a numbered schema change, read from <version>_<name>.up.sql and <version>_<name>.down.sql
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells whether a migration is applied. Dirty migrations failed halfway, TiDB does not
+// roll back ddl, so the schema has to be fixed by hand before the migration is forced
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	Applied   bool
+	Dirty     bool
+	AppliedAt time.Time
+}
+
+// Migrations returns the migrations of the search tables in pkg/db/migrations
+func Migrations() ([]*Migration, error) {
+	sub, err := fs.Sub(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return LoadMigrations(sub)
+}
+
+// LoadMigrations reads the migration files of the directory in version order, every version needs
+// an up and a down file
+func LoadMigrations(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+			continue
+		}
+
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s, want <version>_<name>.up.sql or .down.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+
+		content, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.Up = string(content)
+		} else {
+			m.Down = string(content)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			return nil, fmt.Errorf("migration %d_%s needs an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// SplitSQLStatements splits a migration file into single statements, so the migrations run without
+// tidb_multi_statement_mode. Lines starting with -- are comments, values must not contain semicolons
+func SplitSQLStatements(script string) []string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(script, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+
+	stmts := make([]string, 0)
+	for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
+
+// Migrator applies migrations to the database of the connection and records them in schema_migrations
+type Migrator struct {
+	DB         *sql.DB
+	Migrations []*Migration
+}
+
+// NewMigrator returns a migrator of the search table migrations
+func NewMigrator(conn *sql.DB) (*Migrator, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{DB: conn, Migrations: migrations}, nil
+}
+
+// Status returns every migration with its applied state, in version order
+func (m *Migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]*MigrationStatus, 0, len(m.Migrations))
+	for _, mig := range m.Migrations {
+		status := &MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if row, ok := applied[mig.Version]; ok {
+			status.Applied = true
+			status.Dirty = row.Dirty
+			status.AppliedAt = row.AppliedAt
+			delete(applied, mig.Version)
+		}
+		statuses = append(statuses, status)
+	}
+
+	// versions recorded by a newer build than this one
+	for _, row := range applied {
+		statuses = append(statuses, row)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+
+	return statuses, nil
+}
+
+// Up applies the pending migrations in version order, at most n of them when n > 0
+func (m *Migrator) Up(ctx context.Context, n int) ([]*Migration, error) {
+	applied, err := m.clean(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]*Migration, 0)
+	for _, mig := range m.Migrations {
+		if n > 0 && len(done) == n {
+			break
+		}
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+
+		// the dirty row goes in first, a concurrent run fails on the primary key
+		if _, err := m.DB.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, dirty) VALUES (?, ?, true)", mig.Version, mig.Name); err != nil {
+			return done, fmt.Errorf("failed to record migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		if err := m.exec(ctx, mig, mig.Up); err != nil {
+			return done, err
+		}
+		if _, err := m.DB.ExecContext(ctx, "UPDATE schema_migrations SET dirty=false, applied_at=CURRENT_TIMESTAMP WHERE version=?", mig.Version); err != nil {
+			return done, err
+		}
+
+		done = append(done, mig)
+	}
+
+	return done, nil
+}
+
+// Down reverts the last n applied migrations, newest first
+func (m *Migrator) Down(ctx context.Context, n int) ([]*Migration, error) {
+	applied, err := m.clean(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]int, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+	done := make([]*Migration, 0)
+	for _, v := range versions {
+		if len(done) == n {
+			break
+		}
+
+		mig := m.migration(v)
+		if mig == nil {
+			return done, fmt.Errorf("migration %d is applied but has no files in this build", v)
+		}
+
+		if _, err := m.DB.ExecContext(ctx, "UPDATE schema_migrations SET dirty=true WHERE version=?", v); err != nil {
+			return done, err
+		}
+		if err := m.exec(ctx, mig, mig.Down); err != nil {
+			return done, err
+		}
+		if _, err := m.DB.ExecContext(ctx, "DELETE FROM schema_migrations WHERE version=?", v); err != nil {
+			return done, err
+		}
+
+		done = append(done, mig)
+	}
+
+	return done, nil
+}
+
+// Force marks the migration as applied and clean, after a failed migration was fixed by hand
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	mig := m.migration(version)
+	if mig == nil {
+		return fmt.Errorf("unknown migration %d", version)
+	}
+	if _, err := m.DB.ExecContext(ctx, createMigrationsTableSQL); err != nil {
+		return err
+	}
+
+	res, err := m.DB.ExecContext(ctx, "UPDATE schema_migrations SET dirty=false WHERE version=?", version)
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected > 0 {
+		return nil
+	}
+
+	_, err = m.DB.ExecContext(ctx, "INSERT INTO schema_migrations (version, name, dirty) VALUES (?, ?, false)", mig.Version, mig.Name)
+	return err
+}
+
+func (m *Migrator) exec(ctx context.Context, mig *Migration, script string) error {
+	for i, stmt := range SplitSQLStatements(script) {
+		if _, err := m.DB.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("migration %d_%s failed at statement %d, fix the schema and force the version: %w", mig.Version, mig.Name, i+1, err)
+		}
+	}
+	return nil
+}
+
+// clean returns the applied migrations, it fails if one of them is dirty
+func (m *Migrator) clean(ctx context.Context) (map[int]*MigrationStatus, error) {
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range applied {
+		if row.Dirty {
+			return nil, fmt.Errorf("migration %d_%s is dirty, fix the schema and force the version", row.Version, row.Name)
+		}
+	}
+	return applied, nil
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int]*MigrationStatus, error) {
+	if m.DB == nil {
+		return nil, errors.New("no database connection")
+	}
+	if _, err := m.DB.ExecContext(ctx, createMigrationsTableSQL); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.DB.QueryContext(ctx, "SELECT version, name, dirty, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]*MigrationStatus)
+	for rows.Next() {
+		row := &MigrationStatus{Applied: true}
+		if err := rows.Scan(&row.Version, &row.Name, &row.Dirty, &row.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied[row.Version] = row
+	}
+	return applied, rows.Err()
+}
+
+func (m *Migrator) migration(version int) *Migration {
+	for _, mig := range m.Migrations {
+		if mig.Version == version {
+			return mig
+		}
+	}
+	return nil
+}
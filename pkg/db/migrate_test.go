@@ -0,0 +1,218 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tableExists(t *testing.T, conn *sql.DB, table string) bool {
+	var n int
+	err := conn.QueryRow("SELECT count(*) FROM information_schema.tables WHERE table_schema=? AND table_name=?", TiDB_DatabaseName, table).Scan(&n)
+	assert.NoError(t, err)
+	return n > 0
+}
+
+func indexColumns(t *testing.T, conn *sql.DB, table, index string) []string {
+	rows, err := conn.Query("SELECT column_name FROM information_schema.statistics WHERE table_schema=? AND table_name=? AND index_name=? ORDER BY seq_in_index",
+		TiDB_DatabaseName, table, index)
+	assert.NoError(t, err)
+	defer rows.Close()
+
+	columns := make([]string, 0)
+	for rows.Next() {
+		var column string
+		assert.NoError(t, rows.Scan(&column))
+		columns = append(columns, column)
+	}
+	return columns
+}
+
+func indexExists(t *testing.T, conn *sql.DB, table, index string) bool {
+	return len(indexColumns(t, conn, table, index)) > 0
+}
+
+// testMigrations are the search table migrations and a change of jobs_reference on top
+func testMigrations(t *testing.T) []*Migration {
+	migrations, err := Migrations()
+	assert.NoError(t, err)
+
+	return append(migrations, &Migration{
+		Version: 100,
+		Name:    "street_idx_with_org",
+		Up:      "DROP INDEX dateStreet_idx ON jobs_reference;\nCREATE INDEX dateStreet_idx ON jobs_reference (org_id,updated_at,job_street);",
+		Down:    "DROP INDEX dateStreet_idx ON jobs_reference;\nCREATE INDEX dateStreet_idx ON jobs_reference (updated_at,job_street);",
+	})
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, migrations[0].Version)
+	assert.Equal(t, "search_tables", migrations[0].Name)
+	assert.Len(t, SplitSQLStatements(migrations[0].Up), 2)
+	assert.Len(t, SplitSQLStatements(migrations[0].Down), 2)
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version, "no gaps in the versions")
+	}
+
+	migrations, err = LoadMigrations(fstest.MapFS{
+		"0010_b.up.sql":   {Data: []byte("SELECT 10")},
+		"0010_b.down.sql": {Data: []byte("SELECT -10")},
+		"0002_a.up.sql":   {Data: []byte("-- comment; not a statement\nSELECT 2;\nSELECT 3;")},
+		"0002_a.down.sql": {Data: []byte("SELECT -2")},
+		"README.md":       {Data: []byte("ignored")},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, migrations[0].Version)
+	assert.Equal(t, 10, migrations[1].Version)
+	assert.Equal(t, []string{"SELECT 2", "SELECT 3"}, SplitSQLStatements(migrations[0].Up))
+
+	_, err = LoadMigrations(fstest.MapFS{"0003_c.up.sql": {Data: []byte("SELECT 3")}})
+	assert.Error(t, err, "missing down file")
+
+	_, err = LoadMigrations(fstest.MapFS{"3-c.sql": {Data: []byte("SELECT 3")}})
+	assert.Error(t, err, "invalid file name")
+
+	_, err = LoadMigrations(fstest.MapFS{
+		"0004_d.up.sql":   {Data: []byte("SELECT 4")},
+		"0004_e.down.sql": {Data: []byte("SELECT -4")},
+	})
+	assert.Error(t, err, "two names for one version")
+}
+
+func TestMigratorUpDown(t *testing.T) {
+	ctx := context.Background()
+	conn := newTestMySQL(t)
+	migrations := testMigrations(t)
+	migrator := &Migrator{DB: conn, Migrations: migrations}
+
+	statuses, err := migrator.Status(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, len(migrations))
+	assert.False(t, statuses[0].Applied)
+
+	done, err := migrator.Up(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, done, 1)
+	assert.True(t, tableExists(t, conn, "jobs_reference"))
+	assert.False(t, tableExists(t, conn, "job_tags"), "added by a later migration")
+	assert.Equal(t, []string{"updated_at", "job_street"}, indexColumns(t, conn, "jobs_reference", "dateStreet_idx"))
+
+	done, err = migrator.Up(ctx, len(migrations)-2)
+	assert.NoError(t, err)
+	assert.Len(t, done, len(migrations)-2)
+	assert.True(t, tableExists(t, conn, "job_tags"))
+	assert.Equal(t, []string{"org_id", "delivery_country", "delivery_state"}, indexColumns(t, conn, "jobs_reference", "deliveryRegion_idx"))
+
+	done, err = migrator.Up(ctx, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, done[0].Version)
+	assert.Equal(t, []string{"org_id", "updated_at", "job_street"}, indexColumns(t, conn, "jobs_reference", "dateStreet_idx"))
+
+	done, err = migrator.Up(ctx, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, done, "nothing pending")
+
+	statuses, err = migrator.Status(ctx)
+	assert.NoError(t, err)
+	for _, s := range statuses {
+		assert.True(t, s.Applied)
+		assert.False(t, s.Dirty)
+		assert.False(t, s.AppliedAt.IsZero())
+	}
+
+	done, err = migrator.Down(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, done[0].Version)
+	assert.Equal(t, []string{"updated_at", "job_street"}, indexColumns(t, conn, "jobs_reference", "dateStreet_idx"))
+
+	done, err = migrator.Down(ctx, 100)
+	assert.NoError(t, err)
+	assert.Len(t, done, len(migrations)-1)
+	assert.False(t, tableExists(t, conn, "jobs"))
+	assert.False(t, tableExists(t, conn, "export_jobs"))
+
+	statuses, err = migrator.Status(ctx)
+	assert.NoError(t, err)
+	for _, s := range statuses {
+		assert.False(t, s.Applied)
+	}
+}
+
+func TestMigratorBaselineOnExistingSchema(t *testing.T) {
+	ctx := context.Background()
+	conn := newTestMySQL(t)
+
+	// a database set up before the migrations has the tables but no schema_migrations
+	migrations, err := Migrations()
+	assert.NoError(t, err)
+	for _, stmt := range SplitSQLStatements(migrations[0].Up) {
+		_, err := conn.Exec(stmt)
+		assert.NoError(t, err)
+	}
+	_, err = conn.Exec(`Insert into jobs (uuid, org_id) values ("u1", "org1")`)
+	assert.NoError(t, err)
+
+	// such databases are marked migrated instead of running the baseline
+	migrator := &Migrator{DB: conn, Migrations: migrations}
+	assert.NoError(t, migrator.Force(ctx, 1))
+
+	done, err := migrator.Up(ctx, 0)
+	assert.NoError(t, err)
+	assert.Len(t, done, len(migrations)-1, "the changes after the baseline are applied")
+	assert.True(t, tableExists(t, conn, "job_locations"))
+
+	var n int
+	assert.NoError(t, conn.QueryRow("Select count(*) from jobs").Scan(&n))
+	assert.Equal(t, 1, n, "the baseline keeps the existing rows")
+	assert.NoError(t, conn.QueryRow("Select count(*) from jobs where cod_amount = 0").Scan(&n))
+	assert.Equal(t, 1, n, "the added columns have their defaults")
+}
+
+func TestMigratorDirty(t *testing.T) {
+	ctx := context.Background()
+	conn := newTestMySQL(t)
+
+	broken := &Migration{
+		Version: 100,
+		Name:    "broken",
+		Up:      "CREATE INDEX status_idx ON jobs (org_id,status);\nCREATE INDEX nope_idx ON nope (id);",
+		Down:    "DROP INDEX status_idx ON jobs;",
+	}
+	migrations, err := Migrations()
+	assert.NoError(t, err)
+	migrator := &Migrator{DB: conn, Migrations: append(migrations, broken)}
+
+	done, err := migrator.Up(ctx, 0)
+	assert.Error(t, err)
+	assert.Len(t, done, len(migrations), "the search table migrations went through")
+	assert.True(t, indexExists(t, conn, "jobs", "status_idx"), "ddl is not rolled back")
+
+	statuses, err := migrator.Status(ctx)
+	assert.NoError(t, err)
+	last := len(statuses) - 1
+	assert.True(t, statuses[last].Dirty)
+
+	_, err = migrator.Up(ctx, 0)
+	assert.ErrorContains(t, err, "dirty")
+	_, err = migrator.Down(ctx, 1)
+	assert.ErrorContains(t, err, "dirty")
+
+	// fixed by hand, then forced
+	assert.NoError(t, migrator.Force(ctx, 100))
+	statuses, err = migrator.Status(ctx)
+	assert.NoError(t, err)
+	assert.True(t, statuses[last].Applied)
+	assert.False(t, statuses[last].Dirty)
+
+	done, err = migrator.Down(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, done[0].Version)
+	assert.False(t, indexExists(t, conn, "jobs", "status_idx"))
+
+	assert.Error(t, migrator.Force(ctx, 99))
+}
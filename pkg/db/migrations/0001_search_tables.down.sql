@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS jobs_reference;
+DROP TABLE IF EXISTS jobs;
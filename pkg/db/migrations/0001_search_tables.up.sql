@@ -0,0 +1,49 @@
+-- baseline of the search tables, the tables and indices the old setup_tidb script created.
+-- databases set up with that script are marked with `migrate force 1` and get the later ones with `up`
+
+CREATE TABLE IF NOT EXISTS jobs (
+	uuid Varchar(36) PRIMARY KEY,
+	org_id Varchar(50),
+	shipment_id Varchar(100),
+	job_id Varchar(100),
+	order_id Varchar(100),
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	status Varchar(50),
+	start_time DATETIME,
+	commit_time DATETIME,
+	detail MEDIUMBLOB,
+	INDEX shpID_idx (org_id,shipment_id),
+	INDEX jobID_idx (org_id,job_id),
+	INDEX orderID_idx (org_id,order_id),
+	INDEX dateStatus_idx (org_id,updated_at,status),
+	INDEX start_time_idx (org_id,start_time),
+	INDEX commit_time_idx (org_id,commit_time)
+);
+
+CREATE TABLE IF NOT EXISTS jobs_reference (
+	uuid Varchar(36) PRIMARY KEY,
+	org_id Varchar(50),
+	shipment_tags Varchar(500),
+	order_refids Varchar(100),
+	shipment_ref_ids Varchar(100),
+	assigned_vendor Varchar(500),
+	assigned_facility Varchar(500),
+	job_postal_code Varchar(100),
+	job_city Varchar(500),
+	job_street Varchar(500),
+	customer_account_name Varchar(500),
+	sender_name Varchar(500),
+	consignee_name Varchar(500),
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	INDEX shpTags_idx (org_id,shipment_tags),
+	INDEX ordRefs_idx (org_id,order_refids),
+	INDEX shpRefs_idx (org_id,shipment_ref_ids),
+	INDEX dateVendor_idx (org_id,updated_at,assigned_vendor),
+	INDEX dateFacility_idx (org_id,updated_at,assigned_facility),
+	INDEX datePostal_idx (org_id,updated_at,job_postal_code),
+	INDEX dateCity_idx (org_id,updated_at,job_city),
+	INDEX dateStreet_idx (updated_at,job_street),
+	INDEX dateAccountName_idx (org_id,updated_at,customer_account_name),
+	INDEX dateSender_idx (org_id,updated_at,sender_name),
+	INDEX dateConsignee_idx (org_id,updated_at,consignee_name)
+);
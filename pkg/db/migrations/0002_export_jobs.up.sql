@@ -0,0 +1,15 @@
+-- export jobs of the asynchronous job exports
+
+CREATE TABLE IF NOT EXISTS export_jobs (
+	id Varchar(36) PRIMARY KEY,
+	org_id Varchar(50),
+	format Varchar(20),
+	params TEXT,
+	status Varchar(20),
+	location Varchar(1000) DEFAULT '',
+	total_items INT DEFAULT 0,
+	error TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+	INDEX orgID_idx (org_id, id)
+);
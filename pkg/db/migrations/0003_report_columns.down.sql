@@ -0,0 +1,2 @@
+ALTER TABLE jobs DROP COLUMN cod_amount;
+ALTER TABLE jobs DROP COLUMN completed_time;
@@ -0,0 +1,4 @@
+-- completion time and cod amount of the jobs for the report metrics
+
+ALTER TABLE jobs ADD COLUMN completed_time DATETIME;
+ALTER TABLE jobs ADD COLUMN cod_amount DECIMAL(12,2) DEFAULT 0;
@@ -0,0 +1,10 @@
+-- trigrams of the job text for the free text search
+
+CREATE TABLE IF NOT EXISTS jobs_keywords (
+	org_id Varchar(50),
+	token Varchar(60),
+	uuid Varchar(36),
+	weight INT DEFAULT 1,
+	PRIMARY KEY (org_id, token, uuid),
+	INDEX uuid_idx (uuid)
+);
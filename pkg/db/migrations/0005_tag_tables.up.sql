@@ -0,0 +1,17 @@
+-- a row per job and order tag for the exact tag filters
+
+CREATE TABLE IF NOT EXISTS job_tags (
+	org_id Varchar(50),
+	tag Varchar(200),
+	uuid Varchar(36),
+	PRIMARY KEY (org_id, tag, uuid),
+	INDEX uuid_idx (uuid)
+);
+
+CREATE TABLE IF NOT EXISTS order_tags (
+	org_id Varchar(50),
+	tag Varchar(200),
+	uuid Varchar(36),
+	PRIMARY KEY (org_id, tag, uuid),
+	INDEX uuid_idx (uuid)
+);
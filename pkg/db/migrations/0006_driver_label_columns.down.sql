@@ -0,0 +1,19 @@
+DROP TABLE IF EXISTS job_customer_refs;
+
+DROP INDEX packageLabel_idx ON jobs_reference;
+DROP INDEX shipmentLabel_idx ON jobs_reference;
+DROP INDEX orderLabel_idx ON jobs_reference;
+DROP INDEX clientOrderCode_idx ON jobs_reference;
+DROP INDEX trackingID_idx ON jobs_reference;
+DROP INDEX vehicleNumber_idx ON jobs_reference;
+DROP INDEX driverName_idx ON jobs_reference;
+DROP INDEX driverID_idx ON jobs_reference;
+
+ALTER TABLE jobs_reference DROP COLUMN package_label;
+ALTER TABLE jobs_reference DROP COLUMN shipment_label;
+ALTER TABLE jobs_reference DROP COLUMN order_label;
+ALTER TABLE jobs_reference DROP COLUMN client_order_code;
+ALTER TABLE jobs_reference DROP COLUMN tracking_id;
+ALTER TABLE jobs_reference DROP COLUMN vehicle_number;
+ALTER TABLE jobs_reference DROP COLUMN driver_name;
+ALTER TABLE jobs_reference DROP COLUMN driver_id;
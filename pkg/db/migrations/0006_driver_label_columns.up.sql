@@ -0,0 +1,27 @@
+-- driver, vehicle and label columns and a row per customer reference
+
+ALTER TABLE jobs_reference ADD COLUMN driver_id Varchar(100);
+ALTER TABLE jobs_reference ADD COLUMN driver_name Varchar(500);
+ALTER TABLE jobs_reference ADD COLUMN vehicle_number Varchar(100);
+ALTER TABLE jobs_reference ADD COLUMN tracking_id Varchar(100);
+ALTER TABLE jobs_reference ADD COLUMN client_order_code Varchar(100);
+ALTER TABLE jobs_reference ADD COLUMN order_label Varchar(100);
+ALTER TABLE jobs_reference ADD COLUMN shipment_label Varchar(100);
+ALTER TABLE jobs_reference ADD COLUMN package_label Varchar(100);
+
+CREATE INDEX driverID_idx ON jobs_reference (org_id,driver_id);
+CREATE INDEX driverName_idx ON jobs_reference (org_id,driver_name);
+CREATE INDEX vehicleNumber_idx ON jobs_reference (org_id,vehicle_number);
+CREATE INDEX trackingID_idx ON jobs_reference (org_id,tracking_id);
+CREATE INDEX clientOrderCode_idx ON jobs_reference (org_id,client_order_code);
+CREATE INDEX orderLabel_idx ON jobs_reference (org_id,order_label);
+CREATE INDEX shipmentLabel_idx ON jobs_reference (org_id,shipment_label);
+CREATE INDEX packageLabel_idx ON jobs_reference (org_id,package_label);
+
+CREATE TABLE IF NOT EXISTS job_customer_refs (
+	org_id Varchar(50),
+	ref Varchar(200),
+	uuid Varchar(36),
+	PRIMARY KEY (org_id, ref, uuid),
+	INDEX uuid_idx (uuid)
+);
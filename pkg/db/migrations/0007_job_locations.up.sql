@@ -0,0 +1,13 @@
+-- grid cells of the pickup and delivery locations for the geo search
+
+CREATE TABLE IF NOT EXISTS job_locations (
+	org_id Varchar(50),
+	leg Varchar(20),
+	cell BIGINT,
+	uuid Varchar(36),
+	lat DOUBLE,
+	lon DOUBLE,
+	PRIMARY KEY (org_id, leg, cell, uuid),
+	INDEX latLon_idx (org_id, leg, lat, lon),
+	INDEX uuid_idx (uuid)
+);
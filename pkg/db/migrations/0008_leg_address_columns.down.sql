@@ -0,0 +1,15 @@
+DROP INDEX deliveryRegion_idx ON jobs_reference;
+DROP INDEX deliveryCity_idx ON jobs_reference;
+DROP INDEX deliveryPostal_idx ON jobs_reference;
+DROP INDEX pickupRegion_idx ON jobs_reference;
+DROP INDEX pickupCity_idx ON jobs_reference;
+DROP INDEX pickupPostal_idx ON jobs_reference;
+
+ALTER TABLE jobs_reference DROP COLUMN delivery_country;
+ALTER TABLE jobs_reference DROP COLUMN delivery_state;
+ALTER TABLE jobs_reference DROP COLUMN delivery_city;
+ALTER TABLE jobs_reference DROP COLUMN delivery_postal_code;
+ALTER TABLE jobs_reference DROP COLUMN pickup_country;
+ALTER TABLE jobs_reference DROP COLUMN pickup_state;
+ALTER TABLE jobs_reference DROP COLUMN pickup_city;
+ALTER TABLE jobs_reference DROP COLUMN pickup_postal_code;
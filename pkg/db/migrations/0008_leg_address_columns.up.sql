@@ -0,0 +1,17 @@
+-- postcode, city, state and country of both legs
+
+ALTER TABLE jobs_reference ADD COLUMN pickup_postal_code Varchar(100);
+ALTER TABLE jobs_reference ADD COLUMN pickup_city Varchar(500);
+ALTER TABLE jobs_reference ADD COLUMN pickup_state Varchar(500);
+ALTER TABLE jobs_reference ADD COLUMN pickup_country Varchar(500);
+ALTER TABLE jobs_reference ADD COLUMN delivery_postal_code Varchar(100);
+ALTER TABLE jobs_reference ADD COLUMN delivery_city Varchar(500);
+ALTER TABLE jobs_reference ADD COLUMN delivery_state Varchar(500);
+ALTER TABLE jobs_reference ADD COLUMN delivery_country Varchar(500);
+
+CREATE INDEX pickupPostal_idx ON jobs_reference (org_id,pickup_postal_code);
+CREATE INDEX pickupCity_idx ON jobs_reference (org_id,pickup_city);
+CREATE INDEX pickupRegion_idx ON jobs_reference (org_id,pickup_country,pickup_state);
+CREATE INDEX deliveryPostal_idx ON jobs_reference (org_id,delivery_postal_code);
+CREATE INDEX deliveryCity_idx ON jobs_reference (org_id,delivery_city);
+CREATE INDEX deliveryRegion_idx ON jobs_reference (org_id,delivery_country,delivery_state);
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"fmt"
+	"poc-ddb-tidb-search/pkg/query"
+	"strings"
+)
+
+const reportLimit = 1000
+
+// ReportQuery is an aggregate query whose rows are bucket, group, then one column per metric name
+type ReportQuery struct {
+	Metrics []string
+	SQL     string
+}
+
+var reportBucketFormats = map[string]string{
+	"day":   "%Y-%m-%d",
+	"week":  "%x-W%v",
+	"month": "%Y-%m",
+}
+
+// MakeReportSQLStatement builds the aggregate query for the report params, scoped to the org and search filters.
+// The params must be validated before hand, see query.ReportParams.Validate
+func MakeReportSQLStatement(params *query.ReportParams, orgID string) *ReportQuery {
+	filters := params.Filters
+	if filters == nil {
+		filters = &query.JobSearchParams{}
+	}
+
+	// always join so group by and metrics can use both tables
+	where := makeSearchWhereClause(filters, orgID, true)
+	from := makeSearchFromClause(filters, orgID, true)
+
+	dateCol := "a." + params.DateField
+	kv := []string{where}
+	if params.From != "" {
+		kv = append(kv, fmt.Sprintf("%s >= '%s'", dateCol, params.From))
+	}
+	if params.To != "" {
+		kv = append(kv, fmt.Sprintf("%s < date_add('%s', interval 1 day)", dateCol, params.To))
+	}
+	where = strings.Join(kv, " and ")
+
+	bucket := "''"
+	if params.Bucket != "" {
+		bucket = fmt.Sprintf("coalesce(date_format(%s, '%s'), '')", dateCol, reportBucketFormats[params.Bucket])
+	}
+
+	group := "''"
+	if params.GroupBy != "" {
+		col := "a." + params.GroupBy
+		if referenceColumns[params.GroupBy] {
+			col = "b." + params.GroupBy
+		}
+		group = fmt.Sprintf("coalesce(%s, '')", col)
+	}
+
+	metrics, metricCols := makeReportMetrics(params.Metric)
+
+	q := fmt.Sprintf("Select %s as bucket, %s as grp, %s from %s where %s group by bucket, grp order by bucket, grp limit %d",
+		bucket, group, strings.Join(metricCols, ", "), from, where, reportLimit)
+
+	return &ReportQuery{Metrics: metrics, SQL: q}
+}
+
+func makeReportMetrics(metric string) ([]string, []string) {
+	switch metric {
+	case "on_time":
+		return []string{"on_time", "late", "pending"}, []string{
+			"coalesce(sum(a.completed_time is not null and a.completed_time <= a.commit_time), 0)",
+			"coalesce(sum(a.completed_time is not null and a.completed_time > a.commit_time), 0)",
+			"coalesce(sum(a.completed_time is null), 0)",
+		}
+	case "cod_total":
+		return []string{"cod_total", "count"}, []string{"coalesce(sum(a.cod_amount), 0)", "count(*)"}
+	}
+
+	return []string{"count"}, []string{"count(*)"}
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"poc-ddb-tidb-search/pkg/models"
+	"poc-ddb-tidb-search/pkg/query"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// seedReportFixtures stores four org1 jobs starting on monday and sunday of iso week 10, late on
+// monday of week 11 and just after midnight of april 1st, and a copy of the first one in org2
+func seedReportFixtures(t *testing.T, tidb *tiDB) {
+	type fixture struct {
+		uuid, start, commit, vendor string
+		status                      models.Status
+		completed                   string
+		cod                         float64
+	}
+
+	layout := "02/01/2006 15:04:05"
+	for _, f := range []fixture{
+		{"uuid-1", "06/03/2023 09:00:00", "06/03/2023 18:00:00", "V1", models.StatusCompleted, "06/03/2023 17:00:00", 100},
+		{"uuid-2", "12/03/2023 10:00:00", "12/03/2023 12:00:00", "V1", models.StatusCompleted, "12/03/2023 15:00:00", 50.5},
+		{"uuid-3", "13/03/2023 23:30:00", "14/03/2023 12:00:00", "V2", models.StatusFailed, "", 0},
+		{"uuid-4", "01/04/2023 00:30:00", "02/04/2023 12:00:00", "V2", models.StatusOnRoute, "", 20},
+	} {
+		job := loadTestJob(t)
+		job.ID = "JOB-" + f.uuid
+		job.Status = f.status
+		job.PartnerName = f.vendor
+		job.CODAmount = f.cod
+		job.PickupDate, job.PickupStartTime = f.start[:10], f.start[11:]
+		job.DeliveryDate, job.DeliveryCommitTime = f.commit[:10], f.commit[11:]
+		if f.completed != "" {
+			completed, err := time.Parse(layout, f.completed)
+			assert.NoError(t, err)
+			job.ActualDeliveryTimeUnixsec = completed.Unix()
+		}
+		seedJob(t, tidb, f.uuid, job)
+
+		if f.uuid == "uuid-1" {
+			job.OrgID2 = "org2"
+			seedJob(t, tidb, "uuid-1-org2", job)
+		}
+	}
+}
+
+func runReport(t *testing.T, tidb *tiDB, params *query.ReportParams) []*query.ReportRow {
+	t.Helper()
+
+	if params.DateField == "" {
+		params.DateField = "start_time"
+	}
+	if params.Metric == "" {
+		params.Metric = "count"
+	}
+	assert.NoError(t, params.Validate())
+
+	rq := MakeReportSQLStatement(params, "org1")
+	res, err := tidb.Search(rq)
+	if !assert.NoError(t, err, rq.SQL) {
+		return nil
+	}
+	return res.(*TiDBResult).Report
+}
+
+func TestMakeReportSQLStatementBuckets(t *testing.T) {
+	tidb := newTestTiDB(t)
+	seedReportFixtures(t, tidb)
+
+	assert.Equal(t, []*query.ReportRow{
+		{Bucket: "2023-W10", Metrics: map[string]float64{"count": 2}},
+		{Bucket: "2023-W11", Metrics: map[string]float64{"count": 1}},
+		{Bucket: "2023-W13", Metrics: map[string]float64{"count": 1}},
+	}, runReport(t, tidb, &query.ReportParams{Bucket: "week"}), "iso weeks start on monday")
+
+	assert.Equal(t, []*query.ReportRow{
+		{Bucket: "2023-03-06", Metrics: map[string]float64{"count": 1}},
+		{Bucket: "2023-03-12", Metrics: map[string]float64{"count": 1}},
+		{Bucket: "2023-03-13", Metrics: map[string]float64{"count": 1}},
+		{Bucket: "2023-04-01", Metrics: map[string]float64{"count": 1}},
+	}, runReport(t, tidb, &query.ReportParams{Bucket: "day"}))
+
+	assert.Equal(t, []*query.ReportRow{
+		{Bucket: "", Metrics: map[string]float64{"count": 2}},
+		{Bucket: "2023-03", Metrics: map[string]float64{"count": 2}},
+	}, runReport(t, tidb, &query.ReportParams{Bucket: "month", DateField: "completed_time"}), "jobs not completed have no bucket")
+}
+
+func TestMakeReportSQLStatementMetrics(t *testing.T) {
+	tidb := newTestTiDB(t)
+	seedReportFixtures(t, tidb)
+
+	assert.Equal(t, []*query.ReportRow{
+		{Group: "V1", Metrics: map[string]float64{"on_time": 1, "late": 1, "pending": 0}},
+		{Group: "V2", Metrics: map[string]float64{"on_time": 0, "late": 0, "pending": 2}},
+	}, runReport(t, tidb, &query.ReportParams{GroupBy: "assigned_vendor", Metric: "on_time"}))
+
+	assert.Equal(t, []*query.ReportRow{
+		{Bucket: "2023-03", Metrics: map[string]float64{"cod_total": 150.5, "count": 3}},
+		{Bucket: "2023-04", Metrics: map[string]float64{"cod_total": 20, "count": 1}},
+	}, runReport(t, tidb, &query.ReportParams{Bucket: "month", Metric: "cod_total"}))
+
+	assert.Equal(t, []*query.ReportRow{
+		{Group: string(models.StatusFailed), Metrics: map[string]float64{"count": 1}},
+	}, runReport(t, tidb, &query.ReportParams{GroupBy: "status", Filters: &query.JobSearchParams{VendorName: "V2", Status: string(models.StatusFailed)}}))
+}
+
+func TestMakeReportSQLStatementBounds(t *testing.T) {
+	tidb := newTestTiDB(t)
+	seedReportFixtures(t, tidb)
+
+	count := func(from, to string) float64 {
+		rows := runReport(t, tidb, &query.ReportParams{From: from, To: to})
+		if len(rows) == 0 {
+			return 0
+		}
+		return rows[0].Metrics["count"]
+	}
+
+	assert.Equal(t, float64(4), count("", ""))
+	assert.Equal(t, float64(2), count("2023-03-12", "2023-03-13"), "to includes the whole day")
+	assert.Equal(t, float64(1), count("2023-03-13", "2023-03-31"))
+	assert.Equal(t, float64(1), count("2023-04-01", ""))
+	assert.Equal(t, float64(1), count("", "2023-03-06"))
+	assert.Equal(t, float64(0), count("2023-03-07", "2023-03-11"))
+}
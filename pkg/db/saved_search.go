@@ -0,0 +1,111 @@
+package db
+
+import (
+	"errors"
+	"poc-ddb-tidb-search/pkg/query"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// SavedSearch is a named set of search params of an org user, keyed by orgID and userID#id
+type SavedSearch struct {
+	OrgID     string                 `json:"orgID"`
+	DocID     string                 `json:"docID"`
+	ID        string                 `json:"id"`
+	UserID    string                 `json:"user_id"`
+	Name      string                 `json:"name"`
+	Params    *query.JobSearchParams `json:"params"`
+	Watch     *SearchWatch           `json:"watch,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+}
+
+const (
+	WatchSinkSQS     = "sqs"
+	WatchSinkWebhook = "webhook"
+)
+
+// SearchWatch notifies a sink when a synced job matches the saved search
+type SearchWatch struct {
+	Sink string `json:"sink"` // sqs (the notifications queue) or webhook (the org endpoints subscribed to search.matched)
+}
+
+var ErrSavedSearchNotFound = errors.New("saved search not found")
+
+func savedSearchDocID(userID, id string) string {
+	return userID + "#" + id
+}
+
+// SaveSavedSearch creates or replaces the saved search, the ddb table must be set
+func SaveSavedSearch(ddb DB, s *SavedSearch) error {
+	s.DocID = savedSearchDocID(s.UserID, s.ID)
+	_, err := ddb.Put(s)
+	return err
+}
+
+// GetSavedSearch fetches a saved search of the org user
+func GetSavedSearch(ddb DB, orgID, userID, id string) (*SavedSearch, error) {
+	item, err := ddb.Get(&DDBKey{OrgID: orgID, DocID: savedSearchDocID(userID, id)})
+	if err != nil {
+		return nil, err
+	}
+
+	av, ok := item.(map[string]types.AttributeValue)
+	if !ok || av == nil {
+		return nil, ErrSavedSearchNotFound
+	}
+
+	s := new(SavedSearch)
+	if err := UnmarshalDDBItem(av, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// ListSavedSearches returns the saved searches of the org user
+func ListSavedSearches(ddb DB, orgID, userID string) ([]*SavedSearch, error) {
+	res, err := ddb.Search(&DDBQuery{OrgID: orgID, DocIDPrefix: savedSearchDocID(userID, "")})
+	if err != nil {
+		return nil, err
+	}
+
+	items, _ := res.([]map[string]types.AttributeValue)
+	list := make([]*SavedSearch, 0, len(items))
+	for _, item := range items {
+		s := new(SavedSearch)
+		if err := UnmarshalDDBItem(item, s); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+
+	return list, nil
+}
+
+// DeleteSavedSearch removes a saved search of the org user
+func DeleteSavedSearch(ddb DB, orgID, userID, id string) error {
+	return ddb.Delete(&DDBKey{OrgID: orgID, DocID: savedSearchDocID(userID, id)})
+}
+
+// ListWatchedSearches returns the saved searches of all the org users that have a watch
+func ListWatchedSearches(ddb DB, orgID string) ([]*SavedSearch, error) {
+	res, err := ddb.Search(&DDBQuery{OrgID: orgID})
+	if err != nil {
+		return nil, err
+	}
+
+	items, _ := res.([]map[string]types.AttributeValue)
+	list := make([]*SavedSearch, 0)
+	for _, item := range items {
+		s := new(SavedSearch)
+		if err := UnmarshalDDBItem(item, s); err != nil {
+			return nil, err
+		}
+		if s.Watch != nil && s.Params != nil {
+			list = append(list, s)
+		}
+	}
+
+	return list, nil
+}
@@ -0,0 +1,545 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"poc-ddb-tidb-search/pkg/db/dbtest"
+	"poc-ddb-tidb-search/pkg/geo"
+	"poc-ddb-tidb-search/pkg/models"
+	"poc-ddb-tidb-search/pkg/query"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestMySQL returns a connection to an empty dispatchDB of the dbtest server
+func newTestMySQL(t *testing.T) *sql.DB {
+	return dbtest.NewMySQL(t, TiDB_DatabaseName)
+}
+
+// newTestTiDB returns the test server migrated to the latest schema
+func newTestTiDB(t *testing.T) *tiDB {
+	t.Helper()
+
+	conn := newTestMySQL(t)
+	migrator, err := NewMigrator(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	return &tiDB{db: conn}
+}
+
+// seedJob inserts the job with the statements of the tidb sync
+func seedJob(t *testing.T, tidb *tiDB, uuid string, job *models.Job) {
+	t.Helper()
+
+	inserts, err := MakeInsertJobSQLStatements(job, uuid)
+	assert.NoError(t, err)
+
+	stmts := make([]any, 0, len(inserts))
+	for _, stmt := range inserts {
+		stmts = append(stmts, stmt)
+	}
+
+	if _, err := tidb.Put(stmts...); err != nil {
+		t.Fatalf("seed %s: %v", uuid, err)
+	}
+}
+
+// seedSearchFixtures stores two org1 jobs based on testData/job.json, and a copy of the first one
+// in org2 which no org1 search may return
+func seedSearchFixtures(t *testing.T, tidb *tiDB) {
+	manila := loadTestJob(t)
+	manila.ID = "JOB-A"
+	manila.RefShipmentID = "SHP-A"
+	manila.OrderPayload.OrderID = "ORD-A"
+	manila.Status = models.StatusCompleted
+	manila.PickupDate, manila.PickupStartTime = "03/03/2023", "08:30:00"
+	manila.DeliveryDate, manila.DeliveryCommitTime = "15/03/2023", "18:00:00"
+	manila.OrderPayload.ShipperInfo.Name = "Makati Pharma"
+	manila.OrderPayload.ConsigneeInfo.Name = "Quiapo Clinic"
+	manila.PartnerName = "Acme_Express"
+	manila.FromFacility = &models.HubLocationInfo{FacilityName: "North Hub"}
+	manila.DriverID, manila.DriverName, manila.VehicleNumber = "drv-1", "Juan Dela Cruz", "ABC-123"
+	manila.TrackingID, manila.ClientOrderCode = "TRK-A", "COC-A"
+	manila.RefOrderLabel, manila.RefShipmentLabel, manila.RefPackageLabel = "OL-A", "SL-A", "PL-A"
+	manila.PickupPostcode, manila.DeliveryPostcode = "1200", "1001"
+	manila.PickupGPSLat, manila.PickupGPSLon = 14.5547, 121.0244
+	manila.DeliveryGPSLat, manila.DeliveryGPSLon = 14.5995, 120.9842
+	manila.PackageTags = []string{"fragile", "cold"}
+	manila.OrderTagList = []string{"vip"}
+	manila.OrderPayload.CustomerReferences = []*models.CustomerReference{{ID: "PO-1"}}
+
+	cebu := loadTestJob(t)
+	cebu.ID = "JOB-B"
+	cebu.RefShipmentID = "SHP-B"
+	cebu.OrderPayload.OrderID = "ORD-B"
+	cebu.Status = models.StatusFailed
+	cebu.PickupDate, cebu.PickupStartTime = "04/03/2023", "09:00:00"
+	cebu.DeliveryDate, cebu.DeliveryCommitTime = "16/03/2023", "17:00:00"
+	cebu.OrderPayload.ShipperInfo.Name = "Cebu Foods"
+	cebu.OrderPayload.ConsigneeInfo.Name = "Mango Store"
+	cebu.PartnerName = "AcmeXExpress"
+	cebu.FromFacility = &models.HubLocationInfo{FacilityName: "South Hub"}
+	cebu.DriverID, cebu.DriverName, cebu.VehicleNumber = "drv-2", "Maria Santos", "XYZ-789"
+	cebu.TrackingID, cebu.ClientOrderCode = "TRK-B", "COC-B"
+	cebu.RefOrderLabel, cebu.RefShipmentLabel, cebu.RefPackageLabel = "OL-B", "SL-B", "PL-B"
+	cebu.PickupAddress, cebu.DeliveryAddress = "Colon Street", "Mango Avenue"
+	cebu.PickupCity, cebu.PickupState, cebu.PickupCountry = "LAPU-LAPU", "CEBU", "PHILIPPINES"
+	cebu.DeliveryCity, cebu.DeliveryState, cebu.DeliveryCountry = "CEBU CITY", "CEBU", "PHILIPPINES"
+	cebu.PickupPostcode, cebu.DeliveryPostcode = "1210", "6000"
+	cebu.PickupGPSLat, cebu.PickupGPSLon = 10.3075, 123.9790
+	cebu.DeliveryGPSLat, cebu.DeliveryGPSLon = 10.3157, 123.8854
+	cebu.PackageTags = []string{"fragile"}
+	cebu.OrderTagList = []string{"regular"}
+	cebu.OrderPayload.CustomerReferences = []*models.CustomerReference{{ID: "PO-2"}}
+
+	seedJob(t, tidb, "uuid-a", manila)
+	seedJob(t, tidb, "uuid-b", cebu)
+
+	manila.OrgID2 = "org2"
+	seedJob(t, tidb, "uuid-c", manila)
+}
+
+var searchSQLCases = []struct {
+	name   string
+	params query.JobSearchParams
+	want   []string
+}{
+	{"org only", query.JobSearchParams{}, []string{"uuid-a", "uuid-b"}},
+	{"shipment id", query.JobSearchParams{ShipmentID: "SHP-A"}, []string{"uuid-a"}},
+	{"order id", query.JobSearchParams{OrderID: "ORD-B"}, []string{"uuid-b"}},
+	{"job id", query.JobSearchParams{JobID: "JOB-A"}, []string{"uuid-a"}},
+	{"status", query.JobSearchParams{Status: string(models.StatusFailed)}, []string{"uuid-b"}},
+	{"start date", query.JobSearchParams{StartTime: "2023-03-03"}, []string{"uuid-a"}},
+	{"commit date", query.JobSearchParams{CommitTime: "2023-03-16"}, []string{"uuid-b"}},
+	{"consignee", query.JobSearchParams{ConsigneeName: "Quiapo Clinic"}, []string{"uuid-a"}},
+	{"sender", query.JobSearchParams{SenderName: "Cebu Foods"}, []string{"uuid-b"}},
+	{"vendor", query.JobSearchParams{VendorName: "Acme_Express"}, []string{"uuid-a"}},
+	{"facility", query.JobSearchParams{FacilityName: "South Hub"}, []string{"uuid-b"}},
+	{"account", query.JobSearchParams{AccountName: "Makati Pharma"}, []string{"uuid-a"}},
+	{"driver id", query.JobSearchParams{DriverID: "drv-2"}, []string{"uuid-b"}},
+	{"driver name", query.JobSearchParams{DriverName: "Juan Dela Cruz"}, []string{"uuid-a"}},
+	{"vehicle", query.JobSearchParams{VehicleNumber: "XYZ-789"}, []string{"uuid-b"}},
+	{"tracking id", query.JobSearchParams{TrackingID: "TRK-A"}, []string{"uuid-a"}},
+	{"client order code", query.JobSearchParams{ClientOrderCode: "COC-B"}, []string{"uuid-b"}},
+	{"order label", query.JobSearchParams{OrderLabel: "OL-A"}, []string{"uuid-a"}},
+	{"shipment label", query.JobSearchParams{ShipmentLabel: "SL-B"}, []string{"uuid-b"}},
+	{"package label", query.JobSearchParams{PackageLabel: "PL-A"}, []string{"uuid-a"}},
+	{"pickup postcode", query.JobSearchParams{PickupPostcode: "1210"}, []string{"uuid-b"}},
+	// no case for escaped wildcards, the engine unescapes '\_' in string literals where mysql and TiDB keep it
+	{"pickup postcode prefix", query.JobSearchParams{PickupPostcodePrefix: "12"}, []string{"uuid-a", "uuid-b"}},
+	{"pickup city", query.JobSearchParams{PickupCity: "MAKATI"}, []string{"uuid-a"}},
+	{"pickup state", query.JobSearchParams{PickupState: "CEBU"}, []string{"uuid-b"}},
+	{"pickup country", query.JobSearchParams{PickupCountry: "PHILIPPINES"}, []string{"uuid-a", "uuid-b"}},
+	{"delivery postcode", query.JobSearchParams{DeliveryPostcode: "1001"}, []string{"uuid-a"}},
+	{"delivery postcode prefix", query.JobSearchParams{DeliveryPostcodePrefix: "6"}, []string{"uuid-b"}},
+	{"delivery city", query.JobSearchParams{DeliveryCity: "MANILA"}, []string{"uuid-a"}},
+	{"delivery state", query.JobSearchParams{DeliveryState: "METRO MANILA"}, []string{"uuid-a"}},
+	{"delivery country", query.JobSearchParams{DeliveryCountry: "PHILIPPINES"}, []string{"uuid-a", "uuid-b"}},
+	{"customer ref", query.JobSearchParams{CustomerRef: "PO-2"}, []string{"uuid-b"}},
+	{"shipment tags any", query.JobSearchParams{ShipmentTags: []string{"cold", "fragile"}}, []string{"uuid-a", "uuid-b"}},
+	{"shipment tags all", query.JobSearchParams{ShipmentTags: []string{"cold", "fragile"}, TagMatch: query.TagMatchAll}, []string{"uuid-a"}},
+	{"order tags", query.JobSearchParams{OrderTags: []string{"regular"}}, []string{"uuid-b"}},
+	{"near service leg", query.JobSearchParams{Near: &geo.Point{Lat: 14.6, Lon: 120.98}, RadiusKm: 2}, []string{"uuid-a"}},
+	{"near pickup leg", query.JobSearchParams{Near: &geo.Point{Lat: 14.5547, Lon: 121.0244}, RadiusKm: 2, GeoLeg: "pickup"}, []string{"uuid-a"}},
+	{"near other leg", query.JobSearchParams{Near: &geo.Point{Lat: 14.5547, Lon: 121.0244}, RadiusKm: 2, GeoLeg: "delivery"}, []string{}},
+	{"bbox", query.JobSearchParams{BBox: &geo.BoundingBox{MinLat: 10, MinLon: 123.5, MaxLat: 10.5, MaxLon: 124}}, []string{"uuid-b"}},
+	{"text", query.JobSearchParams{Text: "quiapo"}, []string{"uuid-a"}},
+	{"text typo", query.JobSearchParams{Text: "mango avenu"}, []string{"uuid-b"}},
+
+	// jobs, jobs_reference and child table filters together
+	{"status and vendor", query.JobSearchParams{Status: string(models.StatusCompleted), VendorName: "Acme_Express"}, []string{"uuid-a"}},
+	{"status and other vendor", query.JobSearchParams{Status: string(models.StatusCompleted), VendorName: "AcmeXExpress"}, []string{}},
+	{"tags and geo", query.JobSearchParams{ShipmentTags: []string{"fragile"}, BBox: &geo.BoundingBox{MinLat: 14, MinLon: 120.5, MaxLat: 15, MaxLon: 121.5}}, []string{"uuid-a"}},
+	{"text and region", query.JobSearchParams{Text: "fragile", PickupState: "CEBU", OrderTags: []string{"regular"}}, []string{"uuid-b"}},
+	{"shipment id and dates", query.JobSearchParams{ShipmentID: "SHP-B", StartTime: "2023-03-04", CommitTime: "2023-03-16", CustomerRef: "PO-2"}, []string{"uuid-b"}},
+}
+
+func TestMakeSearchSQLStatementsResults(t *testing.T) {
+	tidb := newTestTiDB(t)
+	seedSearchFixtures(t, tidb)
+
+	for _, tc := range searchSQLCases {
+		t.Run(tc.name, func(t *testing.T) {
+			params := tc.params
+			params.PageSize = 10
+
+			stmts := MakeSearchSQLStatements(&params, "org1")
+			res, err := tidb.Search(stmts[0], stmts[1])
+			if !assert.NoError(t, err, stmts[0]) {
+				return
+			}
+
+			result := res.(*TiDBResult)
+			uuids := make([]string, 0, len(result.Details))
+			for _, row := range result.Details {
+				uuids = append(uuids, row.UUID)
+			}
+			assert.ElementsMatch(t, tc.want, uuids, stmts[0])
+			assert.Equal(t, len(tc.want), result.TotalItems, stmts[1])
+		})
+	}
+}
+
+func TestSearchSQLCasesCoverParams(t *testing.T) {
+	used := make(map[string]bool)
+	for _, tc := range searchSQLCases {
+		v := reflect.ValueOf(tc.params)
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Field(i).IsZero() {
+				used[v.Type().Field(i).Name] = true
+			}
+		}
+	}
+
+	// paging and facets have their own tests
+	for _, name := range []string{"Facets", "PageSize", "PageNumber"} {
+		used[name] = true
+	}
+
+	fields := reflect.TypeOf(query.JobSearchParams{})
+	for i := 0; i < fields.NumField(); i++ {
+		assert.True(t, used[fields.Field(i).Name], "no search sql case for %s", fields.Field(i).Name)
+	}
+}
+
+func TestMakeSearchSQLStatementsPaging(t *testing.T) {
+	tidb := newTestTiDB(t)
+	seedSearchFixtures(t, tidb)
+
+	seen := make([]string, 0)
+	for page := 0; page < 3; page++ {
+		params := &query.JobSearchParams{Text: "fragile", PageSize: 1, PageNumber: page}
+		stmts := MakeSearchSQLStatements(params, "org1")
+
+		res, err := tidb.Search(stmts[0], stmts[1])
+		assert.NoError(t, err)
+
+		result := res.(*TiDBResult)
+		assert.Equal(t, 2, result.TotalItems)
+		for _, row := range result.Details {
+			seen = append(seen, row.UUID)
+		}
+	}
+
+	// the relevance order breaks ties by uuid, so the pages neither skip nor repeat jobs
+	assert.ElementsMatch(t, []string{"uuid-a", "uuid-b"}, seen)
+
+	res, err := tidb.Search(MakeSearchSQLStatements(&query.JobSearchParams{JobID: "JOB-A", PageSize: 10}, "org1")[0])
+	assert.NoError(t, err)
+	job, err := res.(*TiDBResult).Details[0].Job()
+	assert.NoError(t, err)
+	assert.Equal(t, "SHP-A", job.RefShipmentID)
+}
+
+func TestMakeFacetSQLStatementsResults(t *testing.T) {
+	tidb := newTestTiDB(t)
+	seedSearchFixtures(t, tidb)
+
+	params := &query.JobSearchParams{ShipmentTags: []string{"fragile"}, Facets: []string{"status", "assigned_vendor"}}
+	facets := make([]any, 0)
+	for _, fq := range MakeFacetSQLStatements(params, "org1") {
+		facets = append(facets, fq)
+	}
+
+	res, err := tidb.Search(facets...)
+	assert.NoError(t, err)
+
+	result := res.(*TiDBResult)
+	assert.ElementsMatch(t, []*query.FacetCount{
+		{Value: string(models.StatusCompleted), Count: 1},
+		{Value: string(models.StatusFailed), Count: 1},
+	}, result.Facets["status"])
+	assert.ElementsMatch(t, []*query.FacetCount{
+		{Value: "Acme_Express", Count: 1},
+		{Value: "AcmeXExpress", Count: 1},
+	}, result.Facets["assigned_vendor"])
+}
+
+func TestMakeFacetSQLStatementsScopes(t *testing.T) {
+	tidb := newTestTiDB(t)
+	seedSearchFixtures(t, tidb)
+
+	facets := func(params *query.JobSearchParams) map[string][]*query.FacetCount {
+		stmts := make([]any, 0)
+		for _, fq := range MakeFacetSQLStatements(params, "org1") {
+			stmts = append(stmts, fq)
+		}
+		res, err := tidb.Search(stmts...)
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		return res.(*TiDBResult).Facets
+	}
+
+	assert.Empty(t, MakeFacetSQLStatements(&query.JobSearchParams{}, "org1"))
+
+	// jobs table only, without the reference join
+	assert.Equal(t, []*query.FacetCount{{Value: string(models.StatusFailed), Count: 1}},
+		facets(&query.JobSearchParams{Status: string(models.StatusFailed), Facets: []string{"status"}})["status"])
+
+	// the org2 copy of the first job is not counted, the most frequent value comes first
+	result := facets(&query.JobSearchParams{Facets: []string{"assigned_facility", "pickup_country"}})
+	assert.ElementsMatch(t, []*query.FacetCount{{Value: "North Hub", Count: 1}, {Value: "South Hub", Count: 1}}, result["assigned_facility"])
+	assert.Equal(t, []*query.FacetCount{{Value: "PHILIPPINES", Count: 2}}, result["pickup_country"])
+
+	// child table and text filters narrow the counts like the search
+	assert.Equal(t, []*query.FacetCount{{Value: "South Hub", Count: 1}},
+		facets(&query.JobSearchParams{CustomerRef: "PO-2", Facets: []string{"assigned_facility"}})["assigned_facility"])
+	assert.Equal(t, []*query.FacetCount{{Value: string(models.StatusCompleted), Count: 1}},
+		facets(&query.JobSearchParams{Text: "quiapo", Facets: []string{"status"}})["status"])
+}
+
+func TestMakeInsertJobSQLStatementTimes(t *testing.T) {
+	tidb := newTestTiDB(t)
+	seedSearchFixtures(t, tidb)
+
+	var start, commit time.Time
+	err := tidb.db.QueryRow("Select start_time, commit_time from jobs where uuid='uuid-a'").Scan(&start, &commit)
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 3, 3, 8, 30, 0, 0, time.UTC), start)
+	assert.Equal(t, time.Date(2023, 3, 15, 18, 0, 0, 0, time.UTC), commit)
+}
+
+func TestMakeInsertJobReferenceSQLStatementAccount(t *testing.T) {
+	tidb := newTestTiDB(t)
+
+	job := loadTestJob(t)
+	ref := "PO-77"
+	job.ReferenceID, job.OrderPayload.ReferenceID = "CUST-REF-1", &ref
+	seedJob(t, tidb, "uuid-r", job)
+
+	var account, refs string
+	err := tidb.db.QueryRow("Select customer_account_name, order_refids from jobs_reference where uuid='uuid-r'").Scan(&account, &refs)
+	assert.NoError(t, err)
+	assert.Equal(t, "RW Test Sender3", account, "the shipper of the order, not the shipper line")
+	assert.Equal(t, "CUST-REF-1,PO-77", refs, "the customer references of the order, not the internal order id")
+}
+
+// TestSearchQuotedValues stores and searches values with quotes and backslashes, which have to
+// be escaped in the inserts of the sync and in the filters
+func TestSearchQuotedValues(t *testing.T) {
+	tidb := newTestTiDB(t)
+
+	job := loadTestJob(t)
+	job.ID = `JOB-'Q'`
+	job.OrderPayload.ConsigneeInfo.Name = `O'Brien "Corner" Store`
+	job.OrderPayload.ShipperInfo.Name = `Sender's Co`
+	job.PartnerName, job.FromFacility = `Vendor's Fleet`, &models.HubLocationInfo{FacilityName: `Hub\North`}
+	job.DriverID, job.DriverName, job.VehicleNumber = `drv'1`, `Juan D'Cruz`, `AB'C`
+	job.TrackingID, job.ClientOrderCode = `TRK'1`, `COC'1`
+	job.ReferenceID, job.RefShipmentLabel, job.RefPackageLabel = `OL'1`, `SL'1`, `PL'1`
+	job.DeliveryAddress = `St. John's Road`
+	job.PickupPostcode, job.PickupCity, job.PickupState, job.PickupCountry = `12'00`, `Ha'apai`, `Ha'apai Group`, `Tonga'`
+	job.DeliveryPostcode, job.DeliveryCity, job.DeliveryState, job.DeliveryCountry = `60'00`, `Nuku'alofa`, `Tonga'tapu`, `Tonga'`
+	seedJob(t, tidb, "uuid-q", job)
+
+	var jobCity, deliveryCity string
+	assert.NoError(t, tidb.db.QueryRow("Select job_city, delivery_city from jobs_reference where uuid='uuid-q'").Scan(&jobCity, &deliveryCity))
+	assert.Equal(t, `Nuku'alofa`, jobCity)
+	assert.Equal(t, jobCity, deliveryCity)
+
+	for _, params := range []query.JobSearchParams{
+		{JobID: job.ID},
+		{ConsigneeName: job.OrderPayload.ConsigneeInfo.Name},
+		{SenderName: `Sender's Co`},
+		{AccountName: `Sender's Co`},
+		{VendorName: `Vendor's Fleet`},
+		{FacilityName: `Hub\North`},
+		{DriverID: `drv'1`},
+		{DriverName: `Juan D'Cruz`},
+		{VehicleNumber: `AB'C`},
+		{TrackingID: `TRK'1`},
+		{ClientOrderCode: `COC'1`},
+		{OrderLabel: `OL'1`},
+		{ShipmentLabel: `SL'1`},
+		{PackageLabel: `PL'1`},
+		{PickupPostcode: `12'00`},
+		{PickupPostcodePrefix: `12'`},
+		{PickupCity: `Ha'apai`},
+		{PickupState: `Ha'apai Group`},
+		{PickupCountry: `Tonga'`},
+		{DeliveryPostcode: `60'00`},
+		{DeliveryPostcodePrefix: `60'`},
+		{DeliveryCity: `Nuku'alofa`},
+		{DeliveryState: `Tonga'tapu`},
+		{DeliveryCountry: `Tonga'`},
+	} {
+		params.PageSize = 10
+		stmts := MakeSearchSQLStatements(&params, "org1")
+		res, err := tidb.Search(stmts[0], stmts[1])
+		if !assert.NoError(t, err, stmts[0]) {
+			continue
+		}
+		assert.Equal(t, 1, res.(*TiDBResult).TotalItems, stmts[1])
+	}
+
+	// a quote can not end the value and widen the filter
+	stmts := MakeSearchSQLStatements(&query.JobSearchParams{DriverName: `x' or '1'='1`, PageSize: 10}, "org1")
+	res, err := tidb.Search(stmts[0], stmts[1])
+	assert.NoError(t, err)
+	assert.Equal(t, 0, res.(*TiDBResult).TotalItems)
+}
+
+func TestSearchAcrossAntimeridian(t *testing.T) {
+	tidb := newTestTiDB(t)
+
+	for uuid, lon := range map[string]float64{"uuid-east": 179.98, "uuid-180": 180, "uuid-west": -179.97} {
+		job := loadTestJob(t)
+		job.DeliveryGPSLat, job.DeliveryGPSLon = -17.5, lon
+		seedJob(t, tidb, uuid, job)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		params query.JobSearchParams
+	}{
+		{"near west of it", query.JobSearchParams{Near: &geo.Point{Lat: -17.5, Lon: -179.99}, RadiusKm: 10}},
+		{"near east of it", query.JobSearchParams{Near: &geo.Point{Lat: -17.5, Lon: 179.99}, RadiusKm: 10}},
+		{"bbox across it", query.JobSearchParams{BBox: &geo.BoundingBox{MinLat: -18, MinLon: 179.9, MaxLat: -17, MaxLon: -179.9}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			params := tc.params
+			params.PageSize = 10
+
+			stmts := MakeSearchSQLStatements(&params, "org1")
+			res, err := tidb.Search(stmts[0], stmts[1])
+			if !assert.NoError(t, err, stmts[0]) {
+				return
+			}
+
+			uuids := make([]string, 0)
+			for _, row := range res.(*TiDBResult).Details {
+				uuids = append(uuids, row.UUID)
+			}
+			assert.ElementsMatch(t, []string{"uuid-east", "uuid-180", "uuid-west"}, uuids, stmts[0])
+		})
+	}
+}
+
+// quotedOrgID is an orgid header value which ends a quoted literal of either kind
+const quotedOrgID = `org'1" or "1"="1`
+
+// TestSearchQuotedOrgID seeds a job of an org whose id has quotes with the statements of the sync
+// and finds it with the searches reading the child tables
+func TestSearchQuotedOrgID(t *testing.T) {
+	tidb := newTestTiDB(t)
+
+	job := loadTestJob(t)
+	job.OrgID2 = quotedOrgID
+	job.DeliveryAddress = "Quayside Wharf"
+	job.PackageTags, job.OrderTagList = []string{"fragile"}, []string{"vip"}
+	job.PickupGPSLat, job.PickupGPSLon = 14.5547, 121.0244
+	job.DeliveryGPSLat, job.DeliveryGPSLon = 14.5995, 120.9842
+	job.OrderPayload.CustomerReferences = []*models.CustomerReference{{ID: "REF-Q"}}
+
+	jobStmt, err := MakeInsertJobSQLStatement(job, "uuid-q")
+	assert.NoError(t, err)
+	stmts := []any{jobStmt, MakeInsertJobKeywordsSQLStatement(job, "uuid-q"), MakeInsertJobCustomerRefsSQLStatement(job, "uuid-q"),
+		MakeInsertJobLocationsSQLStatement(job, "uuid-q")}
+	for _, stmt := range MakeInsertJobTagsSQLStatements(job, "uuid-q") {
+		stmts = append(stmts, stmt)
+	}
+	_, err = tidb.Put(stmts...)
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		name   string
+		params query.JobSearchParams
+	}{
+		{"text", query.JobSearchParams{Text: "quayside"}},
+		{"shipment tags", query.JobSearchParams{ShipmentTags: []string{"fragile"}}},
+		{"order tags", query.JobSearchParams{OrderTags: []string{"vip"}}},
+		{"customer ref", query.JobSearchParams{CustomerRef: "REF-Q"}},
+		{"near", query.JobSearchParams{Near: &geo.Point{Lat: 14.5995, Lon: 120.9842}, RadiusKm: 1, GeoLeg: "delivery"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			params := tc.params
+			params.PageSize = 10
+
+			stmts := MakeSearchSQLStatements(&params, quotedOrgID)
+			res, err := tidb.Search(stmts[0], stmts[1])
+			if !assert.NoError(t, err, stmts[0]) {
+				return
+			}
+			assert.Equal(t, 1, res.(*TiDBResult).TotalItems, stmts[1])
+
+			// other orgs don't see the job
+			stmts = MakeSearchSQLStatements(&params, "org1")
+			res, err = tidb.Search(stmts[0], stmts[1])
+			assert.NoError(t, err)
+			assert.Equal(t, 0, res.(*TiDBResult).TotalItems, stmts[1])
+		})
+	}
+}
+
+// TestMakeWatchMatchSQLStatement returns the index of each search the job matches in one query
+func TestMakeWatchMatchSQLStatement(t *testing.T) {
+	tidb := newTestTiDB(t)
+	seedSearchFixtures(t, tidb)
+
+	searches := []*SavedSearch{
+		{ID: "failed", OrgID: "org1", Params: &query.JobSearchParams{Status: string(models.StatusFailed)}},
+		{ID: "completed", OrgID: "org1", Params: &query.JobSearchParams{Status: string(models.StatusCompleted)}},
+		{ID: "fragile", OrgID: "org1", Params: &query.JobSearchParams{ShipmentTags: []string{"fragile"}}},
+		{ID: "other org", OrgID: "org2", Params: &query.JobSearchParams{Status: string(models.StatusFailed)}},
+	}
+
+	res, err := tidb.Search(MakeWatchMatchSQLStatement(searches, "uuid-b"))
+	assert.NoError(t, err)
+
+	matched := make([]string, 0)
+	for _, row := range res.(*TiDBResult).Details {
+		matched = append(matched, row.UUID)
+	}
+	assert.ElementsMatch(t, []string{"0", "2"}, matched)
+}
+
+// TestSearchQueryErrors returns the errors of failed search and count queries
+func TestSearchQueryErrors(t *testing.T) {
+	tidb := newTestTiDB(t)
+
+	_, err := tidb.Search("Select uuid, detail from missing_jobs")
+	assert.Error(t, err)
+
+	_, err = tidb.Search("Select uuid, detail from jobs", "Select count(*) from missing_jobs")
+	assert.Error(t, err)
+}
+
+func TestMakeDeleteJobsSQLStatements(t *testing.T) {
+	tidb := newTestTiDB(t)
+	seedSearchFixtures(t, tidb)
+
+	assert.Empty(t, MakeDeleteJobsSQLStatements(map[string][]string{"org1": {}}))
+
+	stmts := make([]any, 0)
+	for _, stmt := range MakeDeleteJobsSQLStatements(map[string][]string{"org1": {"JOB-A", "JOB-X"}}) {
+		stmts = append(stmts, stmt)
+	}
+	_, err := tidb.Put(stmts...)
+	assert.NoError(t, err)
+
+	// every row of uuid-a is gone, the org2 copy with the same job id stays
+	for _, table := range []string{"jobs", "jobs_reference", "job_tags", "order_tags", "job_customer_refs", "job_locations", "jobs_keywords"} {
+		var uuids []string
+		rows, err := tidb.db.Query("Select distinct uuid from " + table + " order by uuid")
+		if !assert.NoError(t, err) {
+			continue
+		}
+		for rows.Next() {
+			var uuid string
+			assert.NoError(t, rows.Scan(&uuid))
+			uuids = append(uuids, uuid)
+		}
+		rows.Close()
+		assert.Equal(t, []string{"uuid-b", "uuid-c"}, uuids, table)
+	}
+}
@@ -3,8 +3,12 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"poc-ddb-tidb-search/pkg/models"
+	"poc-ddb-tidb-search/pkg/query"
 
 	"crypto/tls"
 
@@ -30,9 +34,26 @@ type TiDBRow struct {
 	Detail string
 }
 
+// Job decodes the base64 json job detail stored in the jobs table
+func (r *TiDBRow) Job() (*models.Job, error) {
+	jobJson, err := base64.StdEncoding.DecodeString(r.Detail)
+	if err != nil {
+		return nil, err
+	}
+
+	job := new(models.Job)
+	if err := json.Unmarshal(jobJson, job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
 type TiDBResult struct {
 	TotalItems int
 	Details    []*TiDBRow
+	Facets     map[string][]*query.FacetCount
+	Report     []*query.ReportRow
 }
 
 func NewTiDB(dbName string) (DB, error) {
@@ -45,7 +66,7 @@ func NewTiDB(dbName string) (DB, error) {
 		dbName = "test"
 	}
 
-	dsn := fmt.Sprintf("anN5DThCfX3tUZr.root:Q9qyi4i6Zy7XL3Xw@tcp(gateway01.ap-southeast-1.prod.aws.tidbcloud.com:4000)/%s?tls=tidb", dbName)
+	dsn := fmt.Sprintf("anN5DThCfX3tUZr.root:Q9qyi4i6Zy7XL3Xw@tcp(gateway01.ap-southeast-1.prod.aws.tidbcloud.com:4000)/%s?tls=tidb&parseTime=true", dbName)
 
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
@@ -57,6 +78,14 @@ func NewTiDB(dbName string) (DB, error) {
 	}, nil
 }
 
+// NewTiDBFromConn wraps an open connection, e.g. to a local TiDB or a localsql server migrated with
+// NewMigrator
+func NewTiDBFromConn(conn *sql.DB) DB {
+	return &tiDB{
+		db: conn,
+	}
+}
+
 func (tidb *tiDB) SetTableName(name string) error {
 	if name == "" {
 		return errors.New("empty table name")
@@ -103,10 +132,39 @@ func (tidb *tiDB) Delete(input any) error {
 func (tidb *tiDB) Search(input ...any) (any, error) {
 	result := make([]*TiDBRow, 0)
 	totalItems := 0
+	var facets map[string][]*query.FacetCount
+	var report []*query.ReportRow
 
 	for i, sql := range input {
+		if rq, ok := sql.(*ReportQuery); ok {
+			rows, err := tidb.execReportQuery(rq)
+			if err != nil {
+				return nil, err
+			}
+			report = rows
+			continue
+		}
+
+		if fq, ok := sql.(*FacetQuery); ok {
+			counts, err := tidb.execFacetQuery(fq.SQL)
+			if err != nil {
+				return nil, err
+			}
+			if facets == nil {
+				facets = make(map[string][]*query.FacetCount)
+			}
+			facets[fq.Name] = counts
+			continue
+		}
+
+		// plain statements have no arguments
+		stmt, ok := sql.(*SQLStatement)
+		if !ok {
+			stmt = &SQLStatement{SQL: sql.(string)}
+		}
+
 		if i == 0 {
-			res, err := tidb.execQuery(sql.(string))
+			res, err := tidb.execQuery(stmt.SQL, stmt.Args...)
 			if err != nil {
 				return nil, err
 			}
@@ -114,14 +172,14 @@ func (tidb *tiDB) Search(input ...any) (any, error) {
 			continue
 		}
 
-		count, err := tidb.execTotalCountQuery(sql.(string))
+		count, err := tidb.execTotalCountQuery(stmt.SQL, stmt.Args...)
 		if err != nil {
 			return nil, err
 		}
 		totalItems = count
 	}
 
-	return &TiDBResult{TotalItems: totalItems, Details: result}, nil
+	return &TiDBResult{TotalItems: totalItems, Details: result, Facets: facets, Report: report}, nil
 }
 
 func (tidb *tiDB) Close() error {
@@ -132,9 +190,12 @@ func (tidb *tiDB) GetTiDBConn() *sql.DB {
 	return tidb.db
 }
 
-func (tidb *tiDB) execQuery(q string) ([]*TiDBRow, error) {
+func (tidb *tiDB) execQuery(q string, args ...any) ([]*TiDBRow, error) {
 
-	rows, err := tidb.db.QueryContext(context.Background(), q)
+	rows, err := tidb.db.QueryContext(context.Background(), q, args...)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
 	var result = make([]*TiDBRow, 0)
@@ -165,9 +226,12 @@ func (tidb *tiDB) execQuery(q string) ([]*TiDBRow, error) {
 	return result, nil
 }
 
-func (tidb *tiDB) execTotalCountQuery(q string) (int, error) {
+func (tidb *tiDB) execTotalCountQuery(q string, args ...any) (int, error) {
 
-	rows, err := tidb.db.QueryContext(context.Background(), q)
+	rows, err := tidb.db.QueryContext(context.Background(), q, args...)
+	if err != nil {
+		return 0, err
+	}
 	defer rows.Close()
 
 	var count = 0
@@ -182,3 +246,60 @@ func (tidb *tiDB) execTotalCountQuery(q string) (int, error) {
 
 	return count, nil
 }
+
+func (tidb *tiDB) execFacetQuery(q string) ([]*query.FacetCount, error) {
+
+	rows, err := tidb.db.QueryContext(context.Background(), q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result = make([]*query.FacetCount, 0)
+	for rows.Next() {
+		var fc = new(query.FacetCount)
+		if err := rows.Scan(&fc.Value, &fc.Count); err != nil {
+			return nil, err
+		}
+		result = append(result, fc)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (tidb *tiDB) execReportQuery(rq *ReportQuery) ([]*query.ReportRow, error) {
+
+	rows, err := tidb.db.QueryContext(context.Background(), rq.SQL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result = make([]*query.ReportRow, 0)
+	for rows.Next() {
+		var r = &query.ReportRow{Metrics: make(map[string]float64, len(rq.Metrics))}
+		values := make([]float64, len(rq.Metrics))
+
+		dest := []any{&r.Bucket, &r.Group}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		for i, name := range rq.Metrics {
+			r.Metrics[name] = values[i]
+		}
+		result = append(result, r)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
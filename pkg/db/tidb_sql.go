@@ -4,22 +4,48 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"poc-ddb-tidb-search/pkg/fulltext"
+	"poc-ddb-tidb-search/pkg/geo"
 	"poc-ddb-tidb-search/pkg/models"
 	"poc-ddb-tidb-search/pkg/query"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
 var (
-	InsertJobSQL     = `Insert into jobs %s values (%s)`
-	InsertJobRefSQL  = `Insert into jobs_reference %s values (%s)`
-	UpdateJobSQL     = `Update jobs set %s`           // deferred
-	UpdateJobsRefSQL = `Update jobs_reference set %s` // deferred
+	InsertJobSQL      = `Insert into jobs %s values (%s)`
+	InsertJobRefSQL   = `Insert into jobs_reference %s values (%s)`
+	InsertKeywordSQL  = `Insert into jobs_keywords %s values %s`
+	InsertTagSQL      = `Insert into %s %s values %s`
+	InsertLocationSQL = `Insert into job_locations %s values %s`
+	UpdateJobSQL      = `Update jobs set %s`           // deferred
+	UpdateJobsRefSQL  = `Update jobs_reference set %s` // deferred
 )
 
+const facetLimit = 100
+
+// referenceColumns are the facet and report columns stored in jobs_reference, the others are in jobs
+var referenceColumns = map[string]bool{
+	"assigned_vendor":   true,
+	"assigned_facility": true,
+	"job_city":          true,
+	"pickup_city":       true,
+	"pickup_country":    true,
+	"delivery_city":     true,
+	"delivery_country":  true,
+}
+
+// FacetQuery is a group by count query for a single facet, see TiDBResult.Facets
+type FacetQuery struct {
+	Name string
+	SQL  string
+}
+
 func MakeInsertJobSQLStatement(job *models.Job, uuid string) (string, error) {
-	keys := "(`uuid`,`org_id`,`shipment_id`,`job_id`,`order_id`,`status`,`start_time`,`commit_time`,`detail`)"
-	vals := `"%s","%s","%s","%s","%s","%s","%s","%s","%s"`
+	keys := "(`uuid`,`org_id`,`shipment_id`,`job_id`,`order_id`,`status`,`start_time`,`commit_time`,`completed_time`,`cod_amount`,`detail`)"
+	vals := `"%s","%s","%s","%s","%s","%s","%s","%s",%s,%s,"%s"`
 
 	jobJson, err := json.Marshal(job)
 	if err != nil {
@@ -27,22 +53,31 @@ func MakeInsertJobSQLStatement(job *models.Job, uuid string) (string, error) {
 	}
 	jobBlob := base64.StdEncoding.EncodeToString(jobJson)
 
-	layout := "02/01/2006 5:04:05" // dd/mm/yyyy time from jobs payload
+	layout := "02/01/2006 15:04:05" // dd/mm/yyyy time from jobs payload
 	startTime := job.PickupDate + " " + job.PickupStartTime
 	st, _ := time.Parse(layout, startTime)
 
 	commitTime := job.DeliveryDate + " " + job.DeliveryCommitTime
 	ct, _ := time.Parse(layout, commitTime)
 
-	vals = fmt.Sprintf(vals, uuid, job.OrgID2, job.RefShipmentID, job.ID, job.OrderPayload.OrderID, job.Status,
-		st.Format(time.RFC3339), ct.Format(time.RFC3339), jobBlob)
+	completedTime := "NULL"
+	if job.ActualDeliveryTimeUnixsec > 0 {
+		completedTime = `"` + time.Unix(job.ActualDeliveryTimeUnixsec, 0).UTC().Format(time.RFC3339) + `"`
+	}
+
+	vals = fmt.Sprintf(vals, uuid, escapeSQLString(job.OrgID2), escapeSQLString(job.RefShipmentID), escapeSQLString(job.ID),
+		escapeSQLString(job.OrderPayload.OrderID), escapeSQLString(string(job.Status)),
+		st.Format(time.RFC3339), ct.Format(time.RFC3339), completedTime, strconv.FormatFloat(job.CODAmount, 'f', 2, 64), jobBlob)
 
 	return fmt.Sprintf(InsertJobSQL, keys, vals), nil
 }
 
 func MakeInsertJobReferenceSQLStatement(job *models.Job, uuid string) (string, error) {
-	keys := "(`uuid`,`org_id`,`shipment_tags`,`order_refids`,`shipment_ref_ids`,`assigned_vendor`,`assigned_facility`,`job_postal_code`,`job_city`,`job_street`,`customer_account_name`,`sender_name`,`consignee_name`)"
-	vals := `"%s","%s","%s","%s","%s","%s","%s","%s","%s","%s","%s","%s","%s"`
+	keys := "(`uuid`,`org_id`,`shipment_tags`,`order_refids`,`shipment_ref_ids`,`assigned_vendor`,`assigned_facility`,`job_postal_code`,`job_city`,`job_street`,`customer_account_name`,`sender_name`,`consignee_name`," +
+		"`driver_id`,`driver_name`,`vehicle_number`,`tracking_id`,`client_order_code`,`order_label`,`shipment_label`,`package_label`," +
+		"`pickup_postal_code`,`pickup_city`,`pickup_state`,`pickup_country`,`delivery_postal_code`,`delivery_city`,`delivery_state`,`delivery_country`)"
+	vals := `"%s","%s","%s","%s","%s","%s","%s","%s","%s","%s","%s","%s","%s","%s","%s","%s","%s","%s","%s","%s","%s",` +
+		`"%s","%s","%s","%s","%s","%s","%s","%s"`
 
 	tags := ""
 	if len(job.PackageTags) > 0 {
@@ -64,84 +99,599 @@ func MakeInsertJobReferenceSQLStatement(job *models.Job, uuid string) (string, e
 		consigneeName = job.OrderPayload.ConsigneeInfo.Name
 	}
 
-	vals = fmt.Sprintf(vals, uuid, job.OrgID2, tags, job.RefOrderID, job.RefShipmentID, job.PartnerName,
-		facility, job.DeliveryPostcode, job.DeliveryCity, job.DeliveryAddress, "none yet", senderName, consigneeName)
+	str := make([]any, 0, 29)
+	for _, v := range []string{uuid, job.OrgID2, tags, strings.Join(job.GetOrderReferenceIDs(), ","), job.RefShipmentID, job.PartnerName,
+		facility, job.DeliveryPostcode, job.DeliveryCity, job.DeliveryAddress, job.GetCustomerAccountName(), senderName, consigneeName,
+		job.DriverID, job.DriverName, job.VehicleNumber, job.TrackingID, job.ClientOrderCode,
+		job.GetOrderLabel(), job.GetShipmentLabel(), job.GetPackageLabel(),
+		job.PickupPostcode, job.PickupCity, job.PickupState, job.PickupCountry,
+		job.DeliveryPostcode, job.DeliveryCity, job.DeliveryState, job.DeliveryCountry} {
+		str = append(str, escapeSQLString(v))
+	}
+	vals = fmt.Sprintf(vals, str...)
 
 	return fmt.Sprintf(InsertJobRefSQL, keys, vals), nil
 }
 
+// MakeInsertJobCustomerRefsSQLStatement returns the customer references insert of the job, empty if it has none
+func MakeInsertJobCustomerRefsSQLStatement(job *models.Job, uuid string) string {
+	if job.OrderPayload == nil {
+		return ""
+	}
+
+	refs := make([]string, 0, len(job.OrderPayload.CustomerReferences))
+	for _, ref := range job.OrderPayload.CustomerReferences {
+		if ref != nil {
+			refs = append(refs, ref.ID)
+		}
+	}
+
+	return makeInsertTagsSQLStatement("job_customer_refs", "ref", job.OrgID2, uuid, refs)
+}
+
+// MakeInsertJobLocationsSQLStatement returns the pickup, delivery and service coordinates insert of the job,
+// empty if it has no coordinates
+func MakeInsertJobLocationsSQLStatement(job *models.Job, uuid string) string {
+	keys := "(`uuid`,`org_id`,`leg`,`lat`,`lon`,`cell`)"
+
+	serviceLat, serviceLon := job.GetServiceLatLong()
+	legs := []struct {
+		name  string
+		point geo.Point
+	}{
+		{"service", geo.Point{Lat: serviceLat, Lon: serviceLon}},
+		{"pickup", geo.Point{Lat: job.PickupGPSLat, Lon: job.PickupGPSLon}},
+		{"delivery", geo.Point{Lat: job.DeliveryGPSLat, Lon: job.DeliveryGPSLon}},
+	}
+
+	vals := make([]string, 0, len(legs))
+	for _, leg := range legs {
+		if !leg.point.Valid() {
+			continue
+		}
+		vals = append(vals, fmt.Sprintf(`('%s','%s','%s',%f,%f,%d)`, uuid, escapeSQLString(job.OrgID2), leg.name,
+			leg.point.Lat, leg.point.Lon, geo.Cell(leg.point.Lat, leg.point.Lon)))
+	}
+
+	if len(vals) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(InsertLocationSQL, keys, strings.Join(vals, ","))
+}
+
+// MakeInsertJobKeywordsSQLStatement returns the full text tokens insert of the job, empty if the job has no searchable text
+func MakeInsertJobKeywordsSQLStatement(job *models.Job, uuid string) string {
+	keys := "(`uuid`,`org_id`,`token`,`weight`)"
+
+	keywords := fulltext.JobKeywords(job)
+	if len(keywords) == 0 {
+		return ""
+	}
+
+	vals := make([]string, 0, len(keywords))
+	for _, kw := range keywords {
+		vals = append(vals, fmt.Sprintf(`('%s','%s','%s',%d)`, uuid, escapeSQLString(job.OrgID2), escapeSQLString(kw.Token), kw.Weight))
+	}
+
+	return fmt.Sprintf(InsertKeywordSQL, keys, strings.Join(vals, ","))
+}
+
+// MakeInsertJobTagsSQLStatements returns the job_tags and order_tags inserts of the job, if it has any tags
+func MakeInsertJobTagsSQLStatements(job *models.Job, uuid string) []string {
+	stmts := make([]string, 0, 2)
+
+	for table, tags := range jobTagLists(job) {
+		if stmt := makeInsertTagsSQLStatement(table, "tag", job.OrgID2, uuid, tags); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+
+	sort.Strings(stmts)
+	return stmts
+}
+
+// MakeInsertJobSQLStatements returns every insert of the job, the jobs row first, to run in one transaction
+func MakeInsertJobSQLStatements(job *models.Job, uuid string) ([]string, error) {
+	jobStmt, err := MakeInsertJobSQLStatement(job, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	jobRefStmt, err := MakeInsertJobReferenceSQLStatement(job, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	stmts := []string{jobStmt, jobRefStmt}
+	stmts = append(stmts, MakeInsertJobTagsSQLStatements(job, uuid)...)
+
+	for _, stmt := range []string{
+		MakeInsertJobCustomerRefsSQLStatement(job, uuid),
+		MakeInsertJobLocationsSQLStatement(job, uuid),
+		MakeInsertJobKeywordsSQLStatement(job, uuid),
+	} {
+		if stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+
+	return stmts, nil
+}
+
+// MakeDeleteJobsSQLStatements returns the deletes of every row of the jobs, found by org_id and job_id,
+// the rows of the child tables before the jobs rows they are found by. The jobs are given per org
+func MakeDeleteJobsSQLStatements(jobIDs map[string][]string) []string {
+	orgs := make([]string, 0, len(jobIDs))
+	for orgID, ids := range jobIDs {
+		if len(ids) > 0 {
+			orgs = append(orgs, orgID)
+		}
+	}
+	if len(orgs) == 0 {
+		return nil
+	}
+	sort.Strings(orgs)
+
+	conds := make([]string, 0, len(orgs))
+	for _, orgID := range orgs {
+		ids := make([]string, 0, len(jobIDs[orgID]))
+		for _, id := range jobIDs[orgID] {
+			ids = append(ids, `'`+escapeSQLString(id)+`'`)
+		}
+		conds = append(conds, fmt.Sprintf("(org_id='%s' and job_id in (%s))", escapeSQLString(orgID), strings.Join(ids, ",")))
+	}
+	where := strings.Join(conds, " or ")
+
+	stmts := make([]string, 0, 7)
+	for _, table := range []string{"job_tags", "order_tags", "job_customer_refs", "job_locations", "jobs_keywords", "jobs_reference"} {
+		stmts = append(stmts, fmt.Sprintf("Delete from %s where uuid in (select uuid from jobs where %s)", table, where))
+	}
+	return append(stmts, "Delete from jobs where "+where)
+}
+
+// JobTables are the tables with rows of a synced job, see MakeUpdateJobSQLStatements
+var JobTables = []string{"jobs", "jobs_reference", "job_tags", "order_tags", "job_customer_refs", "job_locations", "jobs_keywords"}
+
+// MakeSelectJobUUIDSQLStatement finds the uuid of the synced job, the detail column is there for Search
+func MakeSelectJobUUIDSQLStatement(orgID, jobID string) string {
+	return fmt.Sprintf("Select uuid, detail from %s.jobs where org_id='%s' and job_id='%s' order by uuid limit 1",
+		TiDB_DatabaseName, escapeSQLString(orgID), escapeSQLString(jobID))
+}
+
+// MakeUpdateJobSQLStatements returns the statements replacing the rows of the synced job in the given
+// tables, e.g. the AffectedTables of a modify, with the rows of the new image. The other tables are kept
+func MakeUpdateJobSQLStatements(job *models.Job, uuid string, tables []string) ([]string, error) {
+	rows, err := jobTableRows(job, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	stmts := make([]string, 0, 2*len(tables))
+	for _, table := range tables {
+		row, ok := rows[table]
+		if !ok {
+			return nil, fmt.Errorf("unknown job table %q", table)
+		}
+
+		stmts = append(stmts, fmt.Sprintf("Delete from %s where uuid='%s'", table, escapeSQLString(uuid)))
+		if row != "" {
+			stmts = append(stmts, row)
+		}
+	}
+	return stmts, nil
+}
+
+// jobTagLists returns the tags of the job per tag table
+func jobTagLists(job *models.Job) map[string][]string {
+	orderTags := append([]string{}, job.OrderTagList...)
+	if job.OrderPayload != nil {
+		orderTags = append(orderTags, job.OrderPayload.TagList...)
+	}
+
+	return map[string][]string{"job_tags": job.PackageTags, "order_tags": orderTags}
+}
+
+// AffectedTables returns the tables whose rows would change when the old job is synced as the new one,
+// by comparing what the insert statements of both would write
+func AffectedTables(old, new *models.Job) ([]string, error) {
+	oldRows, err := jobTableRows(old, "uuid")
+	if err != nil {
+		return nil, err
+	}
+	newRows, err := jobTableRows(new, "uuid")
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]string, 0)
+	for table, row := range newRows {
+		if oldRows[table] != row {
+			tables = append(tables, table)
+		}
+	}
+
+	sort.Strings(tables)
+	return tables, nil
+}
+
+// jobTableRows returns the insert statement of each table for the job, empty for tables without rows
+func jobTableRows(job *models.Job, uuid string) (map[string]string, error) {
+	jobStmt, err := MakeInsertJobSQLStatement(job, uuid)
+	if err != nil {
+		return nil, err
+	}
+	jobRefStmt, err := MakeInsertJobReferenceSQLStatement(job, uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	rows := map[string]string{
+		"jobs":              jobStmt,
+		"jobs_reference":    jobRefStmt,
+		"job_customer_refs": MakeInsertJobCustomerRefsSQLStatement(job, uuid),
+		"job_locations":     MakeInsertJobLocationsSQLStatement(job, uuid),
+		"jobs_keywords":     MakeInsertJobKeywordsSQLStatement(job, uuid),
+	}
+	for table, tags := range jobTagLists(job) {
+		rows[table] = makeInsertTagsSQLStatement(table, "tag", job.OrgID2, uuid, tags)
+	}
+
+	return rows, nil
+}
+
+// makeInsertTagsSQLStatement inserts the distinct values into a (uuid, org_id, column) child table
+func makeInsertTagsSQLStatement(table, column, orgID, uuid string, tags []string) string {
+	seen := make(map[string]bool)
+	vals := make([]string, 0, len(tags))
+
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		vals = append(vals, fmt.Sprintf(`('%s','%s','%s')`, uuid, escapeSQLString(orgID), escapeSQLString(tag)))
+	}
+
+	if len(vals) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf(InsertTagSQL, table, "(`uuid`,`org_id`,`"+column+"`)", strings.Join(vals, ","))
+}
+
+// escapeSQLString escapes a user supplied value for use inside a quoted sql string
+func escapeSQLString(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `"`, `\"`).Replace(s)
+}
+
+// escapeLike escapes the like wildcards of a user supplied value, so \, % and _ match literally.
+// Inside a quoted sql string the result needs escapeSQLString as well
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
 func MakeSearchSQLStatements(params *query.JobSearchParams, orgID string) []string {
 	stmts := make([]string, 0)
-	kv := make([]string, 0)
-	joinPrefixA := "a."
-	joinPrefixB := "b."
-	needToJoin := false
+	needToJoin := needsReferenceJoin(params)
+	where := makeSearchWhereClause(params, orgID, needToJoin)
+	from := makeSearchFromClause(params, orgID, needToJoin)
 
-	// check if we got jobs_reference table field to query
-	if params.ConsigneeName != "" || params.FacilityName != "" || params.OrderRefTags != "" || params.SenderName != "" ||
-		params.ShipmentTags != "" || params.VendorName != "" {
-		needToJoin = true
+	q := fmt.Sprintf("Select uuid, detail from %s where %s limit %d, %d", from, where, params.PageNumber*params.PageSize, params.PageSize)
+	q2 := fmt.Sprintf("Select count(*) as totalrec from %s where %s", from, where)
+
+	if needToJoin {
+		q = fmt.Sprintf("Select a.uuid, a.detail from %s where %s limit %d, %d", from, where, params.PageNumber*params.PageSize, params.PageSize)
+	}
+
+	if params.Text != "" {
+		// relevance order, uuid keeps pages stable between equal scores
+		q = fmt.Sprintf("Select a.uuid, a.detail from %s where %s order by k.score desc, a.uuid limit %d, %d", from, where, params.PageNumber*params.PageSize, params.PageSize)
+	}
+
+	stmts = append(stmts, q, q2)
+
+	return stmts
+}
+
+// MakeExportSQLStatement pages through the search result ordered by uuid, starting after afterUUID,
+// so large exports don't rely on limit offsets
+func MakeExportSQLStatement(params *query.JobSearchParams, orgID, afterUUID string, limit int) string {
+	needToJoin := needsReferenceJoin(params)
+	where := makeSearchWhereClause(params, orgID, needToJoin)
+	from := makeSearchFromClause(params, orgID, needToJoin)
+
+	prefix := ""
+	if needToJoin {
+		prefix = "a."
+	}
+
+	return fmt.Sprintf("Select %suuid, %sdetail from %s where %s and %suuid > '%s' order by %suuid limit %d",
+		prefix, prefix, from, where, prefix, afterUUID, prefix, limit)
+}
+
+// MakeWatchMatchSQLStatement checks in one query which of the saved searches the synced job uuid
+// matches, the uuid of each returned row is the index of a matched search
+func MakeWatchMatchSQLStatement(searches []*SavedSearch, uuid string) *SQLStatement {
+	parts := make([]string, 0, len(searches))
+	args := make([]any, 0, len(searches))
+
+	for i, s := range searches {
+		needToJoin := needsReferenceJoin(s.Params)
+		where := makeSearchWhereClause(s.Params, s.OrgID, needToJoin)
+		from := makeSearchFromClause(s.Params, s.OrgID, needToJoin)
+
+		prefix := ""
+		if needToJoin {
+			prefix = "a."
+		}
+
+		parts = append(parts, fmt.Sprintf("Select %d as uuid, '' as detail from %s where %s and %suuid=?", i, from, where, prefix))
+		args = append(args, uuid)
+	}
+
+	return &SQLStatement{SQL: strings.Join(parts, " union all "), Args: args}
+}
+
+// MakeFacetSQLStatements returns a group by count query per requested facet, using the same where clause as the search
+func MakeFacetSQLStatements(params *query.JobSearchParams, orgID string) []*FacetQuery {
+	stmts := make([]*FacetQuery, 0, len(params.Facets))
+	if len(params.Facets) == 0 {
+		return stmts
+	}
+
+	needToJoin := needsReferenceJoin(params)
+	for _, facet := range params.Facets {
+		if referenceColumns[facet] {
+			needToJoin = true
+		}
 	}
 
+	where := makeSearchWhereClause(params, orgID, needToJoin)
+	from := makeSearchFromClause(params, orgID, needToJoin)
+
+	for _, facet := range params.Facets {
+		col := facet
+		if needToJoin {
+			col = "a." + facet
+			if referenceColumns[facet] {
+				col = "b." + facet
+			}
+		}
+
+		stmts = append(stmts, &FacetQuery{
+			Name: facet,
+			SQL: fmt.Sprintf("Select coalesce(%s, '') as facet, count(*) as totalrec from %s where %s group by %s order by totalrec desc limit %d",
+				col, from, where, col, facetLimit),
+		})
+	}
+
+	return stmts
+}
+
+func makeSearchFromClause(params *query.JobSearchParams, orgID string, needToJoin bool) string {
+	if !needToJoin {
+		return fmt.Sprintf("%s.jobs", TiDB_DatabaseName)
+	}
+
+	from := fmt.Sprintf("%s.jobs a left join %s.jobs_reference b on a.uuid = b.uuid", TiDB_DatabaseName, TiDB_DatabaseName)
+	if params.Text != "" {
+		from += " join " + makeKeywordMatchSubquery(params.Text, orgID) + " k on a.uuid = k.uuid"
+	}
+	return from
+}
+
+// makeKeywordMatchSubquery scores jobs by the weight of their matching tokens, a job has to match
+// at least half of the query tokens so that one or two typos still match
+func makeKeywordMatchSubquery(text, orgID string) string {
+	tokens := fulltext.QueryTokens(text)
+	if len(tokens) == 0 {
+		tokens = []string{""} // matches nothing
+	}
+
+	quoted := make([]string, 0, len(tokens))
+	for _, t := range tokens {
+		quoted = append(quoted, "'"+escapeSQLString(t)+"'")
+	}
+
+	minMatch := (len(tokens) + 1) / 2
+
+	return fmt.Sprintf("(Select uuid, sum(weight) as score from %s.jobs_keywords where org_id='%s' and token in (%s) group by uuid having count(*) >= %d)",
+		TiDB_DatabaseName, escapeSQLString(orgID), strings.Join(quoted, ","), minMatch)
+}
+
+// makeTagFilter matches jobs having any or all of the values in the given child table column
+func makeTagFilter(table, column, prefix, orgID string, tags []string, match string) string {
+	quoted := make([]string, 0, len(tags))
+	for _, t := range tags {
+		quoted = append(quoted, "'"+escapeSQLString(t)+"'")
+	}
+
+	minMatch := 1
+	if match == query.TagMatchAll {
+		minMatch = len(tags)
+	}
+
+	return fmt.Sprintf("%suuid in (Select uuid from %s.%s where org_id='%s' and %s in (%s) group by uuid having count(distinct %s) >= %d)",
+		prefix, TiDB_DatabaseName, table, escapeSQLString(orgID), column, strings.Join(quoted, ","), column, minMatch)
+}
+
+// makeGeoFilter matches jobs in the bounding box or radius, the grid cells narrow the index lookup
+// and the exact lat/lon range and haversine distance are applied on the candidates
+func makeGeoFilter(params *query.JobSearchParams, prefix, orgID string) string {
+	leg := params.GeoLeg
+	if leg == "" {
+		leg = "service"
+	}
+
+	boxes := make([]geo.BoundingBox, 0, 2)
+	if params.BBox != nil {
+		boxes = append(boxes, *params.BBox)
+	}
+	if params.Near != nil {
+		boxes = append(boxes, geo.RadiusBox(*params.Near, params.RadiusKm))
+	}
+
+	kv := []string{fmt.Sprintf("org_id='%s'", escapeSQLString(orgID)), fmt.Sprintf("leg='%s'", escapeSQLString(leg))}
+	for _, box := range boxes {
+		// a box across the antimeridian is matched as its east and west part
+		parts := make([]string, 0, 2)
+		for _, part := range box.Split() {
+			cond := fmt.Sprintf("lat between %f and %f and lon between %f and %f", part.MinLat, part.MaxLat, part.MinLon, part.MaxLon)
+			if cells, ok := geo.CoveringCells(part); ok {
+				ids := make([]string, 0, len(cells))
+				for _, c := range cells {
+					ids = append(ids, strconv.FormatInt(c, 10))
+				}
+				cond = fmt.Sprintf("cell in (%s) and %s", strings.Join(ids, ","), cond)
+			}
+			parts = append(parts, cond)
+		}
+		if len(parts) == 1 {
+			kv = append(kv, parts[0])
+		} else {
+			kv = append(kv, "(("+strings.Join(parts, ") or (")+"))")
+		}
+	}
+
+	if params.Near != nil {
+		kv = append(kv, fmt.Sprintf("%f * 2 * asin(sqrt(power(sin(radians(lat - %f) / 2), 2) + cos(radians(%f)) * cos(radians(lat)) * power(sin(radians(lon - %f) / 2), 2))) <= %f",
+			geo.EarthRadiusKm, params.Near.Lat, params.Near.Lat, params.Near.Lon, params.RadiusKm))
+	}
+
+	return fmt.Sprintf("%suuid in (Select uuid from %s.job_locations where %s)", prefix, TiDB_DatabaseName, strings.Join(kv, " and "))
+}
+
+// needsReferenceJoin checks if we got jobs_reference table field to query, free text search needs the aliased join as well
+func needsReferenceJoin(params *query.JobSearchParams) bool {
+	return params.ConsigneeName != "" || params.FacilityName != "" || params.SenderName != "" ||
+		params.VendorName != "" || params.AccountName != "" || params.DriverID != "" || params.DriverName != "" ||
+		params.VehicleNumber != "" || params.TrackingID != "" || params.ClientOrderCode != "" ||
+		params.OrderLabel != "" || params.ShipmentLabel != "" || params.PackageLabel != "" ||
+		params.PickupPostcode != "" || params.PickupPostcodePrefix != "" || params.PickupCity != "" || params.PickupState != "" || params.PickupCountry != "" ||
+		params.DeliveryPostcode != "" || params.DeliveryPostcodePrefix != "" || params.DeliveryCity != "" || params.DeliveryState != "" || params.DeliveryCountry != "" ||
+		params.Text != ""
+}
+
+// makeSearchWhereClause returns the org scoped where clause for the search params
+func makeSearchWhereClause(params *query.JobSearchParams, orgID string, needToJoin bool) string {
+	joinPrefixA := "a."
+	joinPrefixB := "b."
+
 	if !needToJoin {
 		joinPrefixA = ""
 		joinPrefixB = ""
 	}
 
+	kv := []string{fmt.Sprintf("%sorg_id='%s'", joinPrefixA, escapeSQLString(orgID))}
+
 	// jobs table
 	if params.JobID != "" {
-		kv = append(kv, fmt.Sprintf("%sjob_id='%s'", joinPrefixA, params.JobID))
+		kv = append(kv, fmt.Sprintf("%sjob_id='%s'", joinPrefixA, escapeSQLString(params.JobID)))
 	}
 	if params.OrderID != "" {
-		kv = append(kv, fmt.Sprintf("%sorder_id='%s'", joinPrefixA, params.OrderID))
+		kv = append(kv, fmt.Sprintf("%sorder_id='%s'", joinPrefixA, escapeSQLString(params.OrderID)))
 	}
 	if params.ShipmentID != "" {
-		kv = append(kv, fmt.Sprintf("%shipment_id='%s'", joinPrefixA, params.ShipmentID))
+		kv = append(kv, fmt.Sprintf("%sshipment_id='%s'", joinPrefixA, escapeSQLString(params.ShipmentID)))
 	}
 	if params.Status != "" {
-		kv = append(kv, fmt.Sprintf("%sstatus='%s'", joinPrefixA, params.Status))
+		kv = append(kv, fmt.Sprintf("%sstatus='%s'", joinPrefixA, escapeSQLString(params.Status)))
 	}
 	if params.StartTime != "" {
-		kv = append(kv, fmt.Sprintf("cast(%sstart_time as date)='%s'", joinPrefixA, params.StartTime)) // yyyy-mm-dd
+		kv = append(kv, fmt.Sprintf("cast(%sstart_time as date)='%s'", joinPrefixA, escapeSQLString(params.StartTime))) // yyyy-mm-dd
 	}
 	if params.CommitTime != "" {
-		kv = append(kv, fmt.Sprintf("cast(%scommit_time as date)='%s'", joinPrefixA, params.CommitTime)) // yyyy-mm-dd
+		kv = append(kv, fmt.Sprintf("cast(%scommit_time as date)='%s'", joinPrefixA, escapeSQLString(params.CommitTime))) // yyyy-mm-dd
 	}
 
-	// job_refs table
-	if params.ShipmentTags != "" {
-		kv = append(kv, fmt.Sprintf("%sshipment_tags like '%s'", joinPrefixB, "%"+params.ShipmentTags+"%"))
+	// tag and customer references tables
+	if len(params.ShipmentTags) > 0 {
+		kv = append(kv, makeTagFilter("job_tags", "tag", joinPrefixA, orgID, params.ShipmentTags, params.TagMatch))
 	}
-	if params.OrderRefTags != "" {
-		kv = append(kv, fmt.Sprintf("%sorder_refids like '%s'", joinPrefixB, "%"+params.OrderRefTags+"%"))
+	if len(params.OrderTags) > 0 {
+		kv = append(kv, makeTagFilter("order_tags", "tag", joinPrefixA, orgID, params.OrderTags, params.TagMatch))
 	}
+	if params.CustomerRef != "" {
+		kv = append(kv, makeTagFilter("job_customer_refs", "ref", joinPrefixA, orgID, []string{params.CustomerRef}, query.TagMatchAny))
+	}
+
+	// job locations table
+	if params.BBox != nil || params.Near != nil {
+		kv = append(kv, makeGeoFilter(params, joinPrefixA, orgID))
+	}
+
+	// job_refs table
 	if params.VendorName != "" {
-		kv = append(kv, fmt.Sprintf("%sassigned_vendor='%s'", joinPrefixB, params.VendorName))
+		kv = append(kv, fmt.Sprintf("%sassigned_vendor='%s'", joinPrefixB, escapeSQLString(params.VendorName)))
 	}
 	if params.FacilityName != "" {
-		kv = append(kv, fmt.Sprintf("%sassigned_facility='%s'", joinPrefixB, params.FacilityName))
+		kv = append(kv, fmt.Sprintf("%sassigned_facility='%s'", joinPrefixB, escapeSQLString(params.FacilityName)))
 	}
 	if params.SenderName != "" {
-		kv = append(kv, fmt.Sprintf("%ssender_name='%s'", joinPrefixB, params.SenderName))
+		kv = append(kv, fmt.Sprintf("%ssender_name='%s'", joinPrefixB, escapeSQLString(params.SenderName)))
 	}
 	if params.ConsigneeName != "" {
-		kv = append(kv, fmt.Sprintf("%sconsignee_name='%s'", joinPrefixB, params.ConsigneeName))
+		kv = append(kv, fmt.Sprintf("%sconsignee_name='%s'", joinPrefixB, escapeSQLString(params.ConsigneeName)))
 	}
-
-	qfields := strings.Join(kv, " and ")
-
-	q := fmt.Sprintf("Select uuid, detail from %s.jobs where org_id='%s' and %s limit %d, %d", TiDB_DatabaseName, orgID, qfields, params.PageNumber*params.PageSize, params.PageSize)
-	q2 := fmt.Sprintf("Select count(*) as totalrec from %s.jobs where org_id='%s' and %s", TiDB_DatabaseName, orgID, qfields)
-
-	if needToJoin {
-		q = fmt.Sprintf("Select a.uuid, a.detail from %s.jobs a left join %s.jobs_reference b on a.uuid = b.uuid where a.org_id='%s' and %s limit %d, %d",
-			TiDB_DatabaseName, TiDB_DatabaseName, orgID, qfields, params.PageNumber*params.PageSize, params.PageSize)
-
-		q2 = fmt.Sprintf("Select count(*) as totalrec from %s.jobs a left join %s.jobs_reference b on a.uuid = b.uuid where a.org_id='%s' and %s",
-			TiDB_DatabaseName, TiDB_DatabaseName, orgID, qfields)
+	if params.AccountName != "" {
+		kv = append(kv, fmt.Sprintf("%scustomer_account_name='%s'", joinPrefixB, escapeSQLString(params.AccountName)))
+	}
+	if params.DriverID != "" {
+		kv = append(kv, fmt.Sprintf("%sdriver_id='%s'", joinPrefixB, escapeSQLString(params.DriverID)))
+	}
+	if params.DriverName != "" {
+		kv = append(kv, fmt.Sprintf("%sdriver_name='%s'", joinPrefixB, escapeSQLString(params.DriverName)))
+	}
+	if params.VehicleNumber != "" {
+		kv = append(kv, fmt.Sprintf("%svehicle_number='%s'", joinPrefixB, escapeSQLString(params.VehicleNumber)))
+	}
+	if params.TrackingID != "" {
+		kv = append(kv, fmt.Sprintf("%stracking_id='%s'", joinPrefixB, escapeSQLString(params.TrackingID)))
+	}
+	if params.ClientOrderCode != "" {
+		kv = append(kv, fmt.Sprintf("%sclient_order_code='%s'", joinPrefixB, escapeSQLString(params.ClientOrderCode)))
+	}
+	if params.OrderLabel != "" {
+		kv = append(kv, fmt.Sprintf("%sorder_label='%s'", joinPrefixB, escapeSQLString(params.OrderLabel)))
+	}
+	if params.ShipmentLabel != "" {
+		kv = append(kv, fmt.Sprintf("%sshipment_label='%s'", joinPrefixB, escapeSQLString(params.ShipmentLabel)))
+	}
+	if params.PackageLabel != "" {
+		kv = append(kv, fmt.Sprintf("%spackage_label='%s'", joinPrefixB, escapeSQLString(params.PackageLabel)))
+	}
+	if params.PickupPostcode != "" {
+		kv = append(kv, fmt.Sprintf("%spickup_postal_code='%s'", joinPrefixB, escapeSQLString(params.PickupPostcode)))
+	}
+	if params.PickupPostcodePrefix != "" {
+		kv = append(kv, fmt.Sprintf("%spickup_postal_code like '%s'", joinPrefixB, escapeSQLString(escapeLike(params.PickupPostcodePrefix))+"%"))
+	}
+	if params.PickupCity != "" {
+		kv = append(kv, fmt.Sprintf("%spickup_city='%s'", joinPrefixB, escapeSQLString(params.PickupCity)))
+	}
+	if params.PickupState != "" {
+		kv = append(kv, fmt.Sprintf("%spickup_state='%s'", joinPrefixB, escapeSQLString(params.PickupState)))
+	}
+	if params.PickupCountry != "" {
+		kv = append(kv, fmt.Sprintf("%spickup_country='%s'", joinPrefixB, escapeSQLString(params.PickupCountry)))
+	}
+	if params.DeliveryPostcode != "" {
+		kv = append(kv, fmt.Sprintf("%sdelivery_postal_code='%s'", joinPrefixB, escapeSQLString(params.DeliveryPostcode)))
+	}
+	if params.DeliveryPostcodePrefix != "" {
+		kv = append(kv, fmt.Sprintf("%sdelivery_postal_code like '%s'", joinPrefixB, escapeSQLString(escapeLike(params.DeliveryPostcodePrefix))+"%"))
+	}
+	if params.DeliveryCity != "" {
+		kv = append(kv, fmt.Sprintf("%sdelivery_city='%s'", joinPrefixB, escapeSQLString(params.DeliveryCity)))
+	}
+	if params.DeliveryState != "" {
+		kv = append(kv, fmt.Sprintf("%sdelivery_state='%s'", joinPrefixB, escapeSQLString(params.DeliveryState)))
+	}
+	if params.DeliveryCountry != "" {
+		kv = append(kv, fmt.Sprintf("%sdelivery_country='%s'", joinPrefixB, escapeSQLString(params.DeliveryCountry)))
 	}
 
-	stmts = append(stmts, q, q2)
-
-	return stmts
+	return strings.Join(kv, " and ")
 }
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"encoding/json"
+	"os"
+	"poc-ddb-tidb-search/pkg/models"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func loadTestJob(t *testing.T) *models.Job {
+	payload, err := os.ReadFile("../../testData/job.json")
+	assert.NoError(t, err)
+
+	job := new(models.Job)
+	assert.NoError(t, json.Unmarshal(payload, job))
+	job.OrgID2 = "org1"
+	return job
+}
+
+func TestAffectedTables(t *testing.T) {
+	old := loadTestJob(t)
+
+	tables, err := AffectedTables(old, loadTestJob(t))
+	assert.NoError(t, err)
+	assert.Empty(t, tables)
+
+	// only the detail blob changes
+	new := loadTestJob(t)
+	new.Comment = "left at the door"
+	tables, err = AffectedTables(old, new)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"jobs"}, tables)
+
+	new = loadTestJob(t)
+	new.Status = "failed"
+	new.PackageTags = append(new.PackageTags, "fragile")
+	new.DriverName = "Bob"
+	tables, err = AffectedTables(old, new)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"job_tags", "jobs", "jobs_keywords", "jobs_reference"}, tables)
+}
+
+func TestMakeUpdateJobSQLStatements(t *testing.T) {
+	job := loadTestJob(t)
+	job.PackageTags = nil
+
+	stmts, err := MakeUpdateJobSQLStatements(job, "uuid-1", []string{"job_tags", "jobs"})
+	assert.NoError(t, err)
+	if assert.Len(t, stmts, 3, "no insert for a job without tags") {
+		assert.Equal(t, "Delete from job_tags where uuid='uuid-1'", stmts[0])
+		assert.Equal(t, "Delete from jobs where uuid='uuid-1'", stmts[1])
+		assert.Contains(t, stmts[2], "uuid-1")
+	}
+
+	_, err = MakeUpdateJobSQLStatements(job, "uuid-1", []string{"nope"})
+	assert.Error(t, err)
+
+	rows, err := jobTableRows(job, "uuid-1")
+	assert.NoError(t, err)
+	assert.Len(t, rows, len(JobTables))
+	for _, table := range JobTables {
+		assert.Contains(t, rows, table)
+	}
+}
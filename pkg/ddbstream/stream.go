@@ -2,15 +2,85 @@ package ddbstream
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+// Change is a typed stream record. Inserts have no OldImage, removes have no NewImage and
+// Keys only has the key attributes set
+type Change[T any] struct {
+	EventName               string    `json:"event_name"` // INSERT, MODIFY or REMOVE
+	Keys                    *T        `json:"keys"`
+	OldImage                *T        `json:"old_image,omitempty"`
+	NewImage                *T        `json:"new_image,omitempty"`
+	SequenceNumber          string    `json:"sequence_number"`
+	ApproximateCreationTime time.Time `json:"approximate_creation_time"`
+}
+
+// Current returns the item as of the change: the new image, the old image of a removed item,
+// or just its keys when the stream has no old image
+func (c *Change[T]) Current() *T {
+	if c.NewImage != nil {
+		return c.NewImage
+	}
+	if c.OldImage != nil {
+		return c.OldImage
+	}
+	return c.Keys
+}
+
+// ConvertChange converts the keys and images of a stream event, the images the stream view
+// type does not include are left nil
+func ConvertChange[T any](event *events.DynamoDBEventRecord, avType string) (*Change[T], error) {
+	record := &event.Change
+	c := &Change[T]{
+		EventName:               event.EventName,
+		Keys:                    new(T),
+		SequenceNumber:          record.SequenceNumber,
+		ApproximateCreationTime: record.ApproximateCreationDateTime.UTC(),
+	}
+
+	if err := ConvertKeys(record, avType, c.Keys); err != nil {
+		return nil, err
+	}
+
+	if len(record.OldImage) > 0 {
+		c.OldImage = new(T)
+		if err := ConvertOldImage(record, avType, c.OldImage); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(record.NewImage) > 0 {
+		c.NewImage = new(T)
+		if err := ConvertStreamRecord(record, avType, c.NewImage); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
 // ConvertStreamRecord converts a ddb stream record to a type
 func ConvertStreamRecord[T any](record *events.DynamoDBStreamRecord, avType string, out *T) error {
-	sMap, err := streamAttributesToMap(record.NewImage)
+	return convertImage(record.NewImage, avType, out)
+}
+
+// ConvertOldImage converts the image before a modify or remove, the stream must be NEW_AND_OLD_IMAGES
+func ConvertOldImage[T any](record *events.DynamoDBStreamRecord, avType string, out *T) error {
+	return convertImage(record.OldImage, avType, out)
+}
+
+// ConvertKeys converts the key attributes of the record, they are set for every event
+func ConvertKeys[T any](record *events.DynamoDBStreamRecord, avType string, out *T) error {
+	return convertImage(record.Keys, avType, out)
+}
+
+func convertImage(image map[string]events.DynamoDBAttributeValue, avType string, out any) error {
+	sMap, err := streamAttributesToMap(image)
 	if err != nil {
 		return err
 	}
@@ -51,6 +121,12 @@ func convertAttribute(av events.DynamoDBAttributeValue) (types.AttributeValue, e
 		return &types.AttributeValueMemberBOOL{Value: av.Boolean()}, nil
 	case events.DataTypeNull:
 		return &types.AttributeValueMemberNULL{Value: av.IsNull()}, nil
+	case events.DataTypeStringSet:
+		return &types.AttributeValueMemberSS{Value: av.StringSet()}, nil
+	case events.DataTypeNumberSet:
+		return &types.AttributeValueMemberNS{Value: av.NumberSet()}, nil
+	case events.DataTypeBinarySet:
+		return &types.AttributeValueMemberBS{Value: av.BinarySet()}, nil
 	case events.DataTypeList:
 		list := make([]types.AttributeValue, 0)
 		for _, lv := range av.List() {
@@ -74,3 +150,63 @@ func convertAttribute(av events.DynamoDBAttributeValue) (types.AttributeValue, e
 		return &types.AttributeValueMemberM{Value: m}, nil
 	}
 }
+
+// ToStreamImage converts dynamodb attributes to their stream record form, the inverse of the
+// conversion done when decoding, so changes made outside of a stream can be handled the same way
+func ToStreamImage(item map[string]types.AttributeValue) (map[string]events.DynamoDBAttributeValue, error) {
+	if item == nil {
+		return nil, nil
+	}
+
+	image := make(map[string]events.DynamoDBAttributeValue, len(item))
+	for k, v := range item {
+		sv, err := ToStreamAttribute(v)
+		if err != nil {
+			return nil, err
+		}
+		image[k] = sv
+	}
+	return image, nil
+}
+
+func ToStreamAttribute(av types.AttributeValue) (events.DynamoDBAttributeValue, error) {
+	switch v := av.(type) {
+	case *types.AttributeValueMemberB:
+		return events.NewBinaryAttribute(v.Value), nil
+	case *types.AttributeValueMemberBOOL:
+		return events.NewBooleanAttribute(v.Value), nil
+	case *types.AttributeValueMemberBS:
+		return events.NewBinarySetAttribute(v.Value), nil
+	case *types.AttributeValueMemberL:
+		list := make([]events.DynamoDBAttributeValue, 0, len(v.Value))
+		for _, lv := range v.Value {
+			o, err := ToStreamAttribute(lv)
+			if err != nil {
+				return events.DynamoDBAttributeValue{}, err
+			}
+			list = append(list, o)
+		}
+		return events.NewListAttribute(list), nil
+	case *types.AttributeValueMemberM:
+		m, err := ToStreamImage(v.Value)
+		if err != nil {
+			return events.DynamoDBAttributeValue{}, err
+		}
+		if m == nil {
+			m = make(map[string]events.DynamoDBAttributeValue)
+		}
+		return events.NewMapAttribute(m), nil
+	case *types.AttributeValueMemberN:
+		return events.NewNumberAttribute(v.Value), nil
+	case *types.AttributeValueMemberNS:
+		return events.NewNumberSetAttribute(v.Value), nil
+	case *types.AttributeValueMemberNULL:
+		return events.NewNullAttribute(), nil
+	case *types.AttributeValueMemberS:
+		return events.NewStringAttribute(v.Value), nil
+	case *types.AttributeValueMemberSS:
+		return events.NewStringSetAttribute(v.Value), nil
+	}
+
+	return events.DynamoDBAttributeValue{}, fmt.Errorf("unhandled attribute %T", av)
+}
@@ -0,0 +1,210 @@
+package ddbstream
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// toStreamImage is how lambda receives the item in a stream record
+func toStreamImage(t *testing.T, m map[string]types.AttributeValue) map[string]events.DynamoDBAttributeValue {
+	image, err := ToStreamImage(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return image
+}
+
+func randomBytes(r *rand.Rand) []byte {
+	b := make([]byte, 1+r.Intn(8))
+	r.Read(b)
+	return b
+}
+
+func randomAttribute(r *rand.Rand, depth int) types.AttributeValue {
+	kinds := 8
+	if depth > 0 {
+		kinds = 10 // lists and maps
+	}
+
+	switch r.Intn(kinds) {
+	case 0:
+		return &types.AttributeValueMemberB{Value: randomBytes(r)}
+	case 1:
+		return &types.AttributeValueMemberBOOL{Value: r.Intn(2) == 1}
+	case 2:
+		set := make([][]byte, 1+r.Intn(3))
+		for i := range set {
+			set[i] = randomBytes(r)
+		}
+		return &types.AttributeValueMemberBS{Value: set}
+	case 3:
+		return &types.AttributeValueMemberN{Value: strconv.FormatFloat(r.NormFloat64()*1000, 'f', -1, 64)}
+	case 4:
+		set := make([]string, 1+r.Intn(3))
+		for i := range set {
+			set[i] = strconv.Itoa(r.Int())
+		}
+		return &types.AttributeValueMemberNS{Value: set}
+	case 5:
+		return &types.AttributeValueMemberNULL{Value: true}
+	case 6:
+		return &types.AttributeValueMemberS{Value: fmt.Sprintf("s-%x", r.Int63())}
+	case 7:
+		set := make([]string, 1+r.Intn(3))
+		for i := range set {
+			set[i] = fmt.Sprintf("ss-%d-%x", i, r.Int63())
+		}
+		return &types.AttributeValueMemberSS{Value: set}
+	case 8:
+		list := make([]types.AttributeValue, r.Intn(4))
+		for i := range list {
+			list[i] = randomAttribute(r, depth-1)
+		}
+		return &types.AttributeValueMemberL{Value: list}
+	}
+
+	m := make(map[string]types.AttributeValue)
+	for i := r.Intn(4); i > 0; i-- {
+		m[fmt.Sprintf("k%d", i)] = randomAttribute(r, depth-1)
+	}
+	return &types.AttributeValueMemberM{Value: m}
+}
+
+func TestConvertAttributeRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+
+	for i := 0; i < 500; i++ {
+		av := randomAttribute(r, 3)
+
+		sv, err := ToStreamAttribute(av)
+		assert.NoError(t, err)
+
+		got, err := convertAttribute(sv)
+		assert.NoError(t, err)
+		assert.Equal(t, av, got)
+	}
+}
+
+type roundTripItem struct {
+	S     string             `dynamodbav:"s"`
+	N     float64            `dynamodbav:"n"`
+	I     int64              `dynamodbav:"i"`
+	B     []byte             `dynamodbav:"b"`
+	Bool  bool               `dynamodbav:"bool"`
+	Ptr   *string            `dynamodbav:"ptr"`
+	SS    []string           `dynamodbav:"ss,stringset"`
+	NS    []int              `dynamodbav:"ns,numberset"`
+	BS    [][]byte           `dynamodbav:"bs,binaryset"`
+	L     []string           `dynamodbav:"l"`
+	M     map[string]float64 `dynamodbav:"m"`
+	Child *roundTripChild    `dynamodbav:"child"`
+}
+
+type roundTripChild struct {
+	Name string   `dynamodbav:"name"`
+	Tags []string `dynamodbav:"tags,stringset"`
+}
+
+// TestStreamImageMatchesMarshalling checks that any item marshalled by attributevalue decodes the
+// same from a stream image as from the marshalled attributes
+func TestStreamImageMatchesMarshalling(t *testing.T) {
+	property := func(item roundTripItem) bool {
+		av, err := attributevalue.MarshalMap(item)
+		if err != nil {
+			return true // not a valid item, e.g. an empty map key
+		}
+
+		record := &events.DynamoDBStreamRecord{NewImage: toStreamImage(t, av), OldImage: toStreamImage(t, av)}
+
+		converted, err := streamAttributesToMap(record.NewImage)
+		if !assert.NoError(t, err) || !assert.Equal(t, av, converted) {
+			return false
+		}
+
+		var expected, fromNew, fromOld roundTripItem
+		if err := attributevalue.UnmarshalMap(av, &expected); err != nil {
+			return false
+		}
+		if err := ConvertStreamRecord(record, "dynamodbav", &fromNew); err != nil {
+			return false
+		}
+		if err := ConvertOldImage(record, "dynamodbav", &fromOld); err != nil {
+			return false
+		}
+
+		return assert.Equal(t, expected, fromNew) && assert.Equal(t, expected, fromOld)
+	}
+
+	assert.NoError(t, quick.Check(property, &quick.Config{MaxCount: 200, Rand: rand.New(rand.NewSource(7))}))
+}
+
+type changeItem struct {
+	OrgID  string `json:"orgID"`
+	DocID  string `json:"docID"`
+	Status string `json:"status"`
+}
+
+func TestConvertChange(t *testing.T) {
+	created := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	keys := map[string]events.DynamoDBAttributeValue{
+		"orgID": events.NewStringAttribute("org1"),
+		"docID": events.NewStringAttribute("job1"),
+	}
+	image := func(status string) map[string]events.DynamoDBAttributeValue {
+		return map[string]events.DynamoDBAttributeValue{
+			"orgID":  events.NewStringAttribute("org1"),
+			"docID":  events.NewStringAttribute("job1"),
+			"status": events.NewStringAttribute(status),
+		}
+	}
+
+	remove := &events.DynamoDBEventRecord{
+		EventName: string(events.DynamoDBOperationTypeRemove),
+		Change: events.DynamoDBStreamRecord{
+			ApproximateCreationDateTime: events.SecondsEpochTime{Time: created},
+			Keys:                        keys,
+			OldImage:                    image("delivered"),
+			SequenceNumber:              "100",
+		},
+	}
+
+	change, err := ConvertChange[changeItem](remove, "json")
+	assert.NoError(t, err)
+	assert.Equal(t, "REMOVE", change.EventName)
+	assert.Equal(t, &changeItem{OrgID: "org1", DocID: "job1"}, change.Keys)
+	assert.Equal(t, &changeItem{OrgID: "org1", DocID: "job1", Status: "delivered"}, change.OldImage)
+	assert.Nil(t, change.NewImage)
+	assert.Equal(t, change.OldImage, change.Current())
+	assert.Equal(t, "100", change.SequenceNumber)
+	assert.True(t, created.Equal(change.ApproximateCreationTime))
+
+	// a KEYS_ONLY stream still identifies the removed item
+	remove.Change.OldImage = nil
+	change, err = ConvertChange[changeItem](remove, "json")
+	assert.NoError(t, err)
+	assert.Nil(t, change.OldImage)
+	assert.Equal(t, change.Keys, change.Current())
+
+	modify := &events.DynamoDBEventRecord{
+		EventName: string(events.DynamoDBOperationTypeModify),
+		Change: events.DynamoDBStreamRecord{
+			Keys:     keys,
+			OldImage: image("pending"),
+			NewImage: image("delivered"),
+		},
+	}
+
+	change, err = ConvertChange[changeItem](modify, "json")
+	assert.NoError(t, err)
+	assert.Equal(t, "pending", change.OldImage.Status)
+	assert.Equal(t, "delivered", change.Current().Status)
+}
@@ -0,0 +1,249 @@
+// Package dlq reads the dead letter queues of the sync pipeline and sends their messages back:
+// the sync queue dlq holds the change records the TiDB sync failed, the stream dlq the batches
+// of table changes the stream receiver failed
+package dlq
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+
+	"poc-ddb-tidb-search/pkg/changefeed"
+	"poc-ddb-tidb-search/pkg/ddbstream"
+	"poc-ddb-tidb-search/pkg/models"
+	queue "poc-ddb-tidb-search/pkg/sqs"
+)
+
+// Client is the sqs api the tools use, the sdk client or queue.MemoryClient
+type Client interface {
+	queue.ReceiveClient
+	queue.SendMessageClient
+	queue.DeleteClient
+}
+
+// the kinds of dlq messages
+const (
+	KindChange      = "change"       // a change record of the sync queue
+	KindStreamBatch = "stream_batch" // the failure record of a stream batch
+	KindUnknown     = "unknown"
+)
+
+// Message is a decoded dlq message. Changes have the record type and org of their attributes and
+// the job of the change, stream batches the shard and sequence numbers of the failed records, and
+// the changes of those records once they are read from the stream, see Expand
+type Message struct {
+	ID         string                          `json:"id"`
+	Kind       string                          `json:"kind"`
+	RecordType string                          `json:"record_type,omitempty"`
+	OrgID      string                          `json:"org_id,omitempty"`
+	Receives   int                             `json:"receives"`
+	SentAt     time.Time                       `json:"sent_at"`
+	Attributes map[string]string               `json:"attributes,omitempty"`
+	Change     *ddbstream.Change[models.Job]   `json:"change,omitempty"`
+	Batch      *StreamBatch                    `json:"batch,omitempty"`
+	Changes    []*ddbstream.Change[models.Job] `json:"changes,omitempty"`
+	Body       string                          `json:"body,omitempty"`
+	Error      string                          `json:"error,omitempty"`
+
+	raw types.Message
+}
+
+// Job is the job of a change message, nil for the other kinds
+func (m *Message) Job() *models.Job {
+	if m.Change == nil {
+		return nil
+	}
+	return m.Change.Current()
+}
+
+// StreamBatch is the record lambda sends to the on failure destination of a stream trigger,
+// the changes themselves are only in the stream
+type StreamBatch struct {
+	Condition    string `json:"condition"`
+	FunctionARN  string `json:"function_arn"`
+	StreamARN    string `json:"stream_arn"`
+	ShardID      string `json:"shard_id"`
+	StartSeq     string `json:"start_sequence_number"`
+	EndSeq       string `json:"end_sequence_number"`
+	BatchSize    int    `json:"batch_size"`
+	FirstArrival string `json:"approximate_arrival_of_first_record"`
+}
+
+type failureRecord struct {
+	RequestContext struct {
+		Condition   string `json:"condition"`
+		FunctionArn string `json:"functionArn"`
+	} `json:"requestContext"`
+	DDBStreamBatchInfo *struct {
+		ShardID                         string `json:"shardId"`
+		StartSequenceNumber             string `json:"startSequenceNumber"`
+		EndSequenceNumber               string `json:"endSequenceNumber"`
+		ApproximateArrivalOfFirstRecord string `json:"approximateArrivalOfFirstRecord"`
+		BatchSize                       int    `json:"batchSize"`
+		StreamArn                       string `json:"streamArn"`
+	} `json:"DDBStreamBatchInfo"`
+}
+
+// Decode reads the kind and content of a received message
+func Decode(raw types.Message) *Message {
+	m := &Message{
+		ID:         aws.ToString(raw.MessageId),
+		Kind:       KindUnknown,
+		Attributes: make(map[string]string),
+		Body:       aws.ToString(raw.Body),
+		raw:        raw,
+	}
+
+	m.Receives, _ = strconv.Atoi(raw.Attributes["ApproximateReceiveCount"])
+	if ms, err := strconv.ParseInt(raw.Attributes["SentTimestamp"], 10, 64); err == nil {
+		m.SentAt = time.UnixMilli(ms).UTC()
+	}
+	for k, v := range raw.MessageAttributes {
+		m.Attributes[k] = aws.ToString(v.StringValue)
+	}
+	m.RecordType, m.OrgID = m.Attributes["recordType"], m.Attributes["orgID"]
+
+	failure := new(failureRecord)
+	if err := json.Unmarshal([]byte(m.Body), failure); err == nil && failure.DDBStreamBatchInfo != nil {
+		info := failure.DDBStreamBatchInfo
+		m.Kind = KindStreamBatch
+		m.Batch = &StreamBatch{
+			Condition:    failure.RequestContext.Condition,
+			FunctionARN:  failure.RequestContext.FunctionArn,
+			StreamARN:    info.StreamArn,
+			ShardID:      info.ShardID,
+			StartSeq:     info.StartSequenceNumber,
+			EndSeq:       info.EndSequenceNumber,
+			BatchSize:    info.BatchSize,
+			FirstArrival: info.ApproximateArrivalOfFirstRecord,
+		}
+		return m
+	}
+
+	if change, err := decodeChange(m.Body); err == nil {
+		m.Kind = KindChange
+		m.Change = change
+		if m.OrgID == "" && change.Current() != nil {
+			m.OrgID = change.Current().OrgID2
+		}
+	}
+
+	return m
+}
+
+// decodeChange reads the change record like the sync, bare job bodies are the new image
+func decodeChange(body string) (*ddbstream.Change[models.Job], error) {
+	change := new(ddbstream.Change[models.Job])
+	if err := json.Unmarshal([]byte(body), change); err != nil {
+		return nil, err
+	}
+
+	if change.Keys == nil && change.NewImage == nil && change.OldImage == nil {
+		job := new(models.Job)
+		if err := json.Unmarshal([]byte(body), job); err != nil {
+			return nil, err
+		}
+		change.NewImage = job
+	}
+
+	return change, nil
+}
+
+// Filter selects messages, empty fields match every message. A stream batch matches when one of its
+// changes does, it only has changes once expanded
+type Filter struct {
+	Kind       string
+	OrgID      string
+	RecordType string
+	JobID      string
+}
+
+func (f *Filter) Match(m *Message) bool {
+	if f.Kind != "" && f.Kind != m.Kind {
+		return false
+	}
+
+	if m.Kind == KindStreamBatch {
+		if f.OrgID == "" && f.RecordType == "" && f.JobID == "" {
+			return true
+		}
+		for _, c := range m.Changes {
+			job := c.Current()
+			if f.matchJob(strings.ToLower(c.EventName), job.OrgID2, job) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return f.matchJob(m.RecordType, m.OrgID, m.Job())
+}
+
+func (f *Filter) matchJob(recordType, orgID string, job *models.Job) bool {
+	if f.OrgID != "" && f.OrgID != orgID {
+		return false
+	}
+	if f.RecordType != "" && f.RecordType != recordType {
+		return false
+	}
+	if f.JobID != "" && (job == nil || (job.ID != f.JobID && job.DocID != f.JobID)) {
+		return false
+	}
+	return true
+}
+
+// Reader receives the messages of a dlq. The received messages are hidden from other readers for
+// Visibility, so a message is read once per run. With Streams the stream batches are expanded
+type Reader struct {
+	Client     Client
+	QueueURL   string
+	Visibility time.Duration
+	Streams    changefeed.StreamsClient
+}
+
+// Read receives up to max messages matching the filter, until the queue has no more visible ones
+func (r *Reader) Read(ctx context.Context, filter *Filter, max int) ([]*Message, error) {
+	input := &queue.ReceiveInput{QueueURL: r.QueueURL, MaxMessages: queue.MaxReceiveMessages, WaitTime: time.Second, Visibility: r.Visibility.Truncate(time.Second)}
+	if input.Visibility < time.Second {
+		input.Visibility = 30 * time.Second
+	}
+
+	messages := make([]*Message, 0)
+	seen := make(map[string]bool)
+	for len(messages) < max {
+		received, err := queue.Receive(ctx, r.Client, input)
+		if err != nil {
+			return nil, err
+		}
+
+		fresh := 0
+		for _, raw := range received {
+			m := Decode(raw)
+			if seen[m.ID] {
+				continue
+			}
+			seen[m.ID] = true
+			fresh++
+
+			if m.Kind == KindStreamBatch && r.Streams != nil {
+				if err := Expand(ctx, r.Streams, m); err != nil {
+					m.Error = err.Error() // e.g. trimmed from the stream after 24 hours
+				}
+			}
+
+			if filter.Match(m) && len(messages) < max {
+				messages = append(messages, m)
+			}
+		}
+		if fresh == 0 {
+			break
+		}
+	}
+
+	return messages, nil
+}
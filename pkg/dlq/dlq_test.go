@@ -0,0 +1,246 @@
+package dlq
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/ddbstream"
+	"poc-ddb-tidb-search/pkg/models"
+	"poc-ddb-tidb-search/pkg/pipeline"
+	queue "poc-ddb-tidb-search/pkg/sqs"
+)
+
+const (
+	syncQueueURL = "https://sqs.local/sync.fifo"
+	syncDLQURL   = "https://sqs.local/sync-DLQ.fifo"
+	streamDLQURL = "https://sqs.local/stream.dlq"
+	streamARN    = "arn:aws:dynamodb:ap-southeast-1:1:table/jobs/stream/1"
+)
+
+func loadTestJob(t *testing.T, orgID, id string) *models.Job {
+	payload, err := os.ReadFile("../../testData/job.json")
+	assert.NoError(t, err)
+
+	job := new(models.Job)
+	assert.NoError(t, json.Unmarshal(payload, job))
+	job.OrgID2 = orgID
+	job.ID = id
+	job.DocID = id
+	return job
+}
+
+// sendChange puts a change record into the dlq the way the sync queue moves it there
+func sendChange(t *testing.T, client *queue.MemoryClient, recordType string, job *models.Job) {
+	body, err := json.Marshal(&ddbstream.Change[models.Job]{EventName: "INSERT", Keys: &models.Job{OrgID2: job.OrgID2, DocID: job.DocID}, NewImage: job})
+	assert.NoError(t, err)
+
+	input := queue.NewQueueInput(syncDLQURL, string(body))
+	input.SetMessageAttributes("recordType", recordType)
+	input.SetMessageAttributes("orgID", job.OrgID2)
+	input.SetMessageGroupID(job.OrgID2)
+	_, err = queue.Enqueue(context.Background(), client, input)
+	assert.NoError(t, err)
+}
+
+func queued(client *queue.MemoryClient, queueURL string) []*sqs.SendMessageInput {
+	out := make([]*sqs.SendMessageInput, 0)
+	for _, m := range client.Messages() {
+		if *m.QueueUrl == queueURL {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+const batchFailure = `{
+  "requestContext": {"requestId": "r1", "functionArn": "arn:aws:lambda:ap-southeast-1:1:function:poc-stream-receiver-func", "condition": "RetryAttemptsExhausted", "approximateInvokeCount": 4},
+  "responseContext": {"statusCode": 200, "executedVersion": "$LATEST", "functionError": "Unhandled"},
+  "version": "1.0",
+  "timestamp": "2023-03-20T10:00:00.000Z",
+  "DDBStreamBatchInfo": {"shardId": "shard1", "startSequenceNumber": "101", "endSequenceNumber": "103", "approximateArrivalOfFirstRecord": "2023-03-20T09:59:00Z", "approximateArrivalOfLastRecord": "2023-03-20T09:59:01Z", "batchSize": 3, "streamArn": "` + streamARN + `"}
+}`
+
+func TestDecode(t *testing.T) {
+	job := loadTestJob(t, "org1", "JOB-1")
+	bare, err := json.Marshal(job)
+	assert.NoError(t, err)
+
+	m := Decode(types.Message{
+		MessageId:         aws.String("m1"),
+		Body:              aws.String(string(bare)),
+		Attributes:        map[string]string{"ApproximateReceiveCount": "5", "SentTimestamp": "1679306400000"},
+		MessageAttributes: map[string]types.MessageAttributeValue{"recordType": {StringValue: aws.String("insert")}},
+	})
+	assert.Equal(t, KindChange, m.Kind)
+	assert.Equal(t, "insert", m.RecordType)
+	assert.Equal(t, "org1", m.OrgID, "the org of the job when the message has no org attribute")
+	assert.Equal(t, "JOB-1", m.Job().ID)
+	assert.Equal(t, 5, m.Receives)
+	assert.Equal(t, int64(1679306400), m.SentAt.Unix())
+
+	m = Decode(types.Message{MessageId: aws.String("m2"), Body: aws.String(batchFailure)})
+	assert.Equal(t, KindStreamBatch, m.Kind)
+	assert.Nil(t, m.Job())
+	assert.Equal(t, &StreamBatch{
+		Condition:    "RetryAttemptsExhausted",
+		FunctionARN:  "arn:aws:lambda:ap-southeast-1:1:function:poc-stream-receiver-func",
+		StreamARN:    streamARN,
+		ShardID:      "shard1",
+		StartSeq:     "101",
+		EndSeq:       "103",
+		BatchSize:    3,
+		FirstArrival: "2023-03-20T09:59:00Z",
+	}, m.Batch)
+
+	m = Decode(types.Message{MessageId: aws.String("m3"), Body: aws.String("not json")})
+	assert.Equal(t, KindUnknown, m.Kind)
+	assert.False(t, (&Filter{OrgID: "org1"}).Match(m))
+	assert.True(t, (&Filter{}).Match(m))
+}
+
+func TestRedriveChanges(t *testing.T) {
+	ctx := context.Background()
+	client := &queue.MemoryClient{}
+	sendChange(t, client, "insert", loadTestJob(t, "org1", "JOB-1"))
+	sendChange(t, client, "insert", loadTestJob(t, "org1", "JOB-2"))
+	sendChange(t, client, "insert", loadTestJob(t, "org2", "JOB-3"))
+
+	reader := &Reader{Client: client, QueueURL: syncDLQURL}
+	messages, err := reader.Read(ctx, &Filter{OrgID: "org1"}, 10)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 2)
+
+	redriver := &Redriver{Client: client, DLQURL: syncDLQURL, QueueURL: syncQueueURL, DryRun: true}
+	outcomes := redriver.Redrive(ctx, messages)
+	assert.Equal(t, []*Outcome{
+		{ID: messages[0].ID, Kind: KindChange, Action: ActionDryRun},
+		{ID: messages[1].ID, Kind: KindChange, Action: ActionDryRun},
+	}, outcomes)
+	assert.Empty(t, queued(client, syncQueueURL))
+	assert.Len(t, queued(client, syncDLQURL), 3)
+
+	redriver.DryRun = false
+	for _, o := range redriver.Redrive(ctx, messages) {
+		assert.Equal(t, ActionRedriven, o.Action, o.Error)
+	}
+	assert.Len(t, queued(client, syncDLQURL), 1, "the org2 message stays in the dlq")
+
+	// the sync handles the redriven records like the ones of the stream receiver
+	sent := queued(client, syncQueueURL)
+	assert.Len(t, sent, 2)
+	assert.Equal(t, "org1", *sent[0].MessageGroupId)
+	assert.Equal(t, "insert", *sent[0].MessageAttributes["recordType"].StringValue)
+
+	tidb := &db.RecordingTiDB{}
+	resp, err := (&pipeline.Syncer{TiDB: tidb}).Handle(ctx, client.Receive(syncQueueURL))
+	assert.NoError(t, err)
+	assert.Empty(t, resp.BatchItemFailures)
+	assert.Len(t, tidb.Puts(), 2)
+}
+
+// fakeStreams serves one shard of records with sequence numbers 100 to 104, two per page
+type fakeStreams struct {
+	records []streamtypes.Record
+}
+
+func newFakeStreams() *fakeStreams {
+	f := new(fakeStreams)
+	for i, id := range []string{"JOB-0", "JOB-1", "JOB-2", "JOB-3", "JOB-4"} {
+		f.records = append(f.records, streamtypes.Record{
+			EventID:   aws.String("ev" + id),
+			EventName: streamtypes.OperationTypeInsert,
+			Dynamodb: &streamtypes.StreamRecord{
+				SequenceNumber: aws.String(strconv.Itoa(100 + i)),
+				Keys: map[string]streamtypes.AttributeValue{
+					"orgID": &streamtypes.AttributeValueMemberS{Value: "org1"},
+					"docID": &streamtypes.AttributeValueMemberS{Value: id},
+				},
+				NewImage: map[string]streamtypes.AttributeValue{
+					"orgID":       &streamtypes.AttributeValueMemberS{Value: "org1"},
+					"docID":       &streamtypes.AttributeValueMemberS{Value: id},
+					"shipment_id": &streamtypes.AttributeValueMemberS{Value: id},
+				},
+			},
+		})
+	}
+	return f
+}
+
+func (f *fakeStreams) DescribeStream(ctx context.Context, in *dynamodbstreams.DescribeStreamInput, _ ...func(*dynamodbstreams.Options)) (*dynamodbstreams.DescribeStreamOutput, error) {
+	return &dynamodbstreams.DescribeStreamOutput{StreamDescription: &streamtypes.StreamDescription{}}, nil
+}
+
+func (f *fakeStreams) GetShardIterator(ctx context.Context, in *dynamodbstreams.GetShardIteratorInput, _ ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	return &dynamodbstreams.GetShardIteratorOutput{ShardIterator: in.SequenceNumber}, nil
+}
+
+func (f *fakeStreams) GetRecords(ctx context.Context, in *dynamodbstreams.GetRecordsInput, _ ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error) {
+	out := &dynamodbstreams.GetRecordsOutput{}
+	for i, r := range f.records {
+		if *r.Dynamodb.SequenceNumber < *in.ShardIterator {
+			continue
+		}
+		if len(out.Records) == 2 {
+			out.NextShardIterator = f.records[i].Dynamodb.SequenceNumber
+			break
+		}
+		out.Records = append(out.Records, r)
+	}
+	return out, nil
+}
+
+func TestRedriveStreamBatch(t *testing.T) {
+	ctx := context.Background()
+	client := &queue.MemoryClient{}
+	streams := newFakeStreams()
+	_, err := client.SendMessage(ctx, &sqs.SendMessageInput{QueueUrl: aws.String(streamDLQURL), MessageBody: aws.String(batchFailure)})
+	assert.NoError(t, err)
+
+	reader := &Reader{Client: client, QueueURL: streamDLQURL, Streams: streams}
+	messages, err := reader.Read(ctx, &Filter{JobID: "JOB-2"}, 10)
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+	assert.Empty(t, messages[0].Error)
+
+	ids := make([]string, 0)
+	for _, c := range messages[0].Changes {
+		ids = append(ids, c.Current().ID)
+	}
+	assert.Equal(t, []string{"JOB-1", "JOB-2", "JOB-3"}, ids, "the records of the batch from 101 to 103")
+
+	// the stream receiver sends the records to the sync queue again
+	receiver := &pipeline.StreamReceiver{Client: client, QueueURL: syncQueueURL}
+	redriver := &Redriver{Client: client, DLQURL: streamDLQURL, Streams: streams, Handler: receiver.Handle}
+	outcomes := redriver.Redrive(ctx, messages)
+	assert.Equal(t, []*Outcome{{ID: messages[0].ID, Kind: KindStreamBatch, Action: ActionRedriven, Records: 3}}, outcomes)
+	assert.Empty(t, queued(client, streamDLQURL))
+
+	sent := queued(client, syncQueueURL)
+	assert.Len(t, sent, 3)
+	assert.Equal(t, "insert", *sent[0].MessageAttributes["recordType"].StringValue)
+	assert.Equal(t, "org1", *sent[0].MessageGroupId)
+}
+
+func TestStreamRecordsEndOfShard(t *testing.T) {
+	batch := &StreamBatch{StreamARN: streamARN, ShardID: "shard1", StartSeq: "103", EndSeq: "109"}
+	records, err := StreamRecords(context.Background(), newFakeStreams(), batch)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2, "103 and 104 are left in the shard")
+
+	_, err = StreamRecords(context.Background(), newFakeStreams(), &StreamBatch{})
+	assert.Error(t, err)
+
+	assert.True(t, seqAfter("1000", "999"))
+	assert.False(t, seqAfter("101", "103"))
+}
@@ -0,0 +1,135 @@
+package dlq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	logger "github.com/sirupsen/logrus"
+
+	"poc-ddb-tidb-search/pkg/changefeed"
+	queue "poc-ddb-tidb-search/pkg/sqs"
+)
+
+// the actions taken on a message
+const (
+	ActionRedriven = "redriven"
+	ActionDryRun   = "would redrive"
+	ActionSkipped  = "skipped"
+	ActionFailed   = "failed"
+)
+
+// Outcome is what was done with a message, Records are the stream records of a stream batch
+type Outcome struct {
+	ID      string `json:"id"`
+	Kind    string `json:"kind"`
+	Action  string `json:"action"`
+	Records int    `json:"records,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Redriver sends the messages of the dlq DLQURL back and deletes them from it. Changes are sent to
+// QueueURL with their attributes and message group, stream batches are read from the stream again
+// with Streams and handed to Handler, the stream receiver. DryRun only checks what would be sent
+type Redriver struct {
+	Client   Client
+	DLQURL   string
+	QueueURL string
+	Streams  changefeed.StreamsClient
+	Handler  changefeed.Handler
+	DryRun   bool
+}
+
+// Redrive handles every message, a failed message stays in the dlq
+func (r *Redriver) Redrive(ctx context.Context, messages []*Message) []*Outcome {
+	outcomes := make([]*Outcome, 0, len(messages))
+
+	for _, m := range messages {
+		outcome := &Outcome{ID: m.ID, Kind: m.Kind, Action: ActionRedriven}
+		outcomes = append(outcomes, outcome)
+
+		var err error
+		switch m.Kind {
+		case KindChange:
+			err = r.sendChange(ctx, m)
+		case KindStreamBatch:
+			outcome.Records, err = r.replayBatch(ctx, m)
+		default:
+			outcome.Action = ActionSkipped
+			continue
+		}
+
+		if err == nil && !r.DryRun {
+			_, err = r.Client.DeleteMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: &r.DLQURL, ReceiptHandle: m.raw.ReceiptHandle})
+			if err != nil {
+				err = fmt.Errorf("redriven but not deleted from the dlq: %w", err)
+			}
+		}
+
+		switch {
+		case err != nil:
+			outcome.Action, outcome.Error = ActionFailed, err.Error()
+			logger.WithFields(logger.Fields{
+				"error":     err.Error(),
+				"code":      "RedriveErr",
+				"messageID": m.ID,
+			}).Error("failed to redrive dlq message")
+		case r.DryRun:
+			outcome.Action = ActionDryRun
+		}
+	}
+
+	return outcomes
+}
+
+// sendChange queues the change record again as the stream receiver sent it
+func (r *Redriver) sendChange(ctx context.Context, m *Message) error {
+	input := queue.NewQueueInput(r.QueueURL, m.Body)
+	for k, v := range m.Attributes {
+		input.SetMessageAttributes(k, v)
+	}
+	if strings.HasSuffix(r.QueueURL, ".fifo") {
+		group := m.raw.Attributes["MessageGroupId"]
+		if group == "" {
+			group = m.OrgID
+		}
+		input.SetMessageGroupID(group)
+	}
+
+	if r.DryRun {
+		return input.Validate()
+	}
+	_, err := queue.Enqueue(ctx, r.Client, input)
+	return err
+}
+
+// replayBatch reads the records of the failed batch and hands them to the stream receiver
+func (r *Redriver) replayBatch(ctx context.Context, m *Message) (int, error) {
+	if r.Streams == nil || r.Handler == nil {
+		return 0, errors.New("stream batches need a streams client and handler")
+	}
+
+	records, err := StreamRecords(ctx, r.Streams, m.Batch)
+	if err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, errors.New("no records of the batch left in the stream")
+	}
+	if r.DryRun {
+		return len(records), nil
+	}
+
+	resp, err := r.Handler(ctx, events.DynamoDBEvent{Records: records})
+	if err != nil {
+		return len(records), err
+	}
+	if len(resp.BatchItemFailures) > 0 {
+		return len(records), fmt.Errorf("%d of %d records failed again", len(resp.BatchItemFailures), len(records))
+	}
+
+	return len(records), nil
+}
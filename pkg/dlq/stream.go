@@ -0,0 +1,95 @@
+package dlq
+
+import (
+	"context"
+	"errors"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+
+	"poc-ddb-tidb-search/pkg/changefeed"
+	"poc-ddb-tidb-search/pkg/ddbstream"
+	"poc-ddb-tidb-search/pkg/models"
+)
+
+// an open shard has no next records yet, give up after this many empty pages
+const maxEmptyPages = 3
+
+// StreamRecords reads the records of the failed batch from its shard, the stream keeps them for 24 hours
+func StreamRecords(ctx context.Context, client changefeed.StreamsClient, batch *StreamBatch) ([]events.DynamoDBEventRecord, error) {
+	if batch.StreamARN == "" || batch.ShardID == "" || batch.StartSeq == "" {
+		return nil, errors.New("stream batch without shard or sequence number")
+	}
+
+	it, err := client.GetShardIterator(ctx, &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         aws.String(batch.StreamARN),
+		ShardId:           aws.String(batch.ShardID),
+		ShardIteratorType: types.ShardIteratorTypeAtSequenceNumber,
+		SequenceNumber:    aws.String(batch.StartSeq),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]events.DynamoDBEventRecord, 0, batch.BatchSize)
+	iterator, empty := it.ShardIterator, 0
+	for iterator != nil && empty < maxEmptyPages {
+		out, err := client.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{ShardIterator: iterator, Limit: aws.Int32(100)})
+		if err != nil {
+			return nil, err
+		}
+
+		page, err := changefeed.ConvertStreamRecords(out.Records)
+		if err != nil {
+			return nil, err
+		}
+		if len(page) == 0 {
+			empty++
+		}
+
+		for _, r := range page {
+			if batch.EndSeq != "" && seqAfter(r.Change.SequenceNumber, batch.EndSeq) {
+				return records, nil
+			}
+			records = append(records, r)
+			if r.Change.SequenceNumber == batch.EndSeq {
+				return records, nil
+			}
+		}
+		iterator = out.NextShardIterator
+	}
+
+	return records, nil
+}
+
+// seqAfter compares the decimal sequence numbers of a shard
+func seqAfter(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	return a > b
+}
+
+// Expand reads the changes of a stream batch message from the stream
+func Expand(ctx context.Context, client changefeed.StreamsClient, m *Message) error {
+	if m.Batch == nil {
+		return nil
+	}
+
+	records, err := StreamRecords(ctx, client, m.Batch)
+	if err != nil {
+		return err
+	}
+
+	m.Changes = make([]*ddbstream.Change[models.Job], 0, len(records))
+	for i := range records {
+		change, err := ddbstream.ConvertChange[models.Job](&records[i], "json")
+		if err != nil {
+			return err
+		}
+		m.Changes = append(m.Changes, change)
+	}
+	return nil
+}
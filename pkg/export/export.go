@@ -0,0 +1,140 @@
+package export
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"poc-ddb-tidb-search/pkg/blob"
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/query"
+	queue "poc-ddb-tidb-search/pkg/sqs"
+
+	"github.com/google/uuid"
+)
+
+const exportPageSize = 1000
+
+// Message is the export queue payload, the worker loads the rest from the export_jobs table
+type Message struct {
+	ID    string `json:"id"`
+	OrgID string `json:"org_id"`
+}
+
+// NewExportJob creates a queued export job for the given search params
+func NewExportJob(orgID string, format Format, params *query.JobSearchParams) (*db.ExportJob, error) {
+	p, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &db.ExportJob{
+		ID:     uuid.NewString(),
+		OrgID:  orgID,
+		Format: string(format),
+		Params: string(p),
+		Status: db.ExportStatusQueued,
+	}, nil
+}
+
+// Enqueue sends the export job to the export worker queue
+func Enqueue(ctx context.Context, client queue.SendMessageClient, queueURL string, job *db.ExportJob) error {
+	msg, err := json.Marshal(&Message{ID: job.ID, OrgID: job.OrgID})
+	if err != nil {
+		return err
+	}
+
+	input := queue.NewQueueInput(queueURL, string(msg))
+	input.SetMessageAttributes("orgID", job.OrgID)
+
+	_, err = queue.Enqueue(ctx, client, input)
+	return err
+}
+
+// Key is the object key of the export file
+func Key(job *db.ExportJob) string {
+	return fmt.Sprintf("exports/%s/%s.%s", job.OrgID, job.ID, Format(job.Format).Extension())
+}
+
+// Run pages through the search result in TiDB, writes it as a gzipped file and uploads it to the store.
+// The job's location and total items are set on success.
+func Run(ctx context.Context, tiDB db.DB, store blob.Store, job *db.ExportJob) error {
+	format, err := ParseFormat(job.Format)
+	if err != nil {
+		return err
+	}
+
+	params := new(query.JobSearchParams)
+	if err := json.Unmarshal([]byte(job.Params), params); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp("", "export-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w, err := NewWriter(format, tmp)
+	if err != nil {
+		return err
+	}
+
+	total, err := writePages(ctx, tiDB, params, job.OrgID, w)
+	if err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	if _, err := tmp.Seek(0, 0); err != nil {
+		return err
+	}
+
+	location, err := store.Put(ctx, Key(job), tmp)
+	if err != nil {
+		return err
+	}
+
+	job.Location = location
+	job.TotalItems = total
+	return nil
+}
+
+func writePages(ctx context.Context, tiDB db.DB, params *query.JobSearchParams, orgID string, w Writer) (int, error) {
+	total := 0
+	lastUUID := ""
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+
+		res, err := tiDB.Search(db.MakeExportSQLStatement(params, orgID, lastUUID, exportPageSize))
+		if err != nil {
+			return total, err
+		}
+
+		rows := res.(*db.TiDBResult).Details
+		for _, row := range rows {
+			job, err := row.Job()
+			if err != nil {
+				return total, err
+			}
+
+			if err := w.Write(row.UUID, job); err != nil {
+				return total, err
+			}
+			total++
+		}
+
+		if len(rows) < exportPageSize {
+			return total, nil
+		}
+		lastUUID = rows[len(rows)-1].UUID
+	}
+}
@@ -0,0 +1,122 @@
+package export
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"poc-ddb-tidb-search/pkg/models"
+)
+
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+)
+
+// ParseFormat validates the requested export format, csv is the default
+func ParseFormat(f string) (Format, error) {
+	switch Format(f) {
+	case "", FormatCSV:
+		return FormatCSV, nil
+	case FormatNDJSON:
+		return FormatNDJSON, nil
+	}
+
+	return "", fmt.Errorf("unsupported export format %q", f)
+}
+
+// Extension returns the file extension of the gzipped export file
+func (f Format) Extension() string {
+	return string(f) + ".gz"
+}
+
+// Writer writes exported jobs as gzipped csv or ndjson
+type Writer interface {
+	Write(uuid string, job *models.Job) error
+	Close() error
+}
+
+var csvHeader = []string{
+	"uuid", "org_id", "job_id", "shipment_id", "order_id", "status", "service_type",
+	"pickup_date", "pickup_start_time", "delivery_date", "delivery_commit_time",
+	"vendor", "facility", "sender_name", "consignee_name",
+	"delivery_address", "delivery_city", "delivery_postcode", "cod_amount",
+}
+
+func NewWriter(format Format, w io.Writer) (Writer, error) {
+	gz := gzip.NewWriter(w)
+
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(gz)
+		if err := cw.Write(csvHeader); err != nil {
+			return nil, err
+		}
+		return &csvWriter{gz: gz, w: cw}, nil
+	case FormatNDJSON:
+		return &ndjsonWriter{gz: gz, enc: json.NewEncoder(gz)}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+type csvWriter struct {
+	gz *gzip.Writer
+	w  *csv.Writer
+}
+
+func (cw *csvWriter) Write(uuid string, job *models.Job) error {
+	facility := ""
+	if job.FromFacility != nil {
+		facility = job.FromFacility.FacilityName
+	}
+
+	orderID, senderName, consigneeName := "", "", ""
+	if job.OrderPayload != nil {
+		orderID = job.OrderPayload.OrderID
+		if job.OrderPayload.ShipperInfo != nil {
+			senderName = job.OrderPayload.ShipperInfo.Name
+		}
+		if job.OrderPayload.ConsigneeInfo != nil {
+			consigneeName = job.OrderPayload.ConsigneeInfo.Name
+		}
+	}
+
+	return cw.w.Write([]string{
+		uuid, job.OrgID2, job.ID, job.RefShipmentID, orderID, string(job.Status), string(job.ServiceType),
+		job.PickupDate, job.PickupStartTime, job.DeliveryDate, job.DeliveryCommitTime,
+		job.PartnerName, facility, senderName, consigneeName,
+		job.DeliveryAddress, job.DeliveryCity, job.DeliveryPostcode, strconv.FormatFloat(job.CODAmount, 'f', -1, 64),
+	})
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	if err := cw.w.Error(); err != nil {
+		return err
+	}
+	return cw.gz.Close()
+}
+
+type ndjsonWriter struct {
+	gz  *gzip.Writer
+	enc *json.Encoder
+}
+
+type ndjsonRow struct {
+	UUID string      `json:"uuid"`
+	Job  *models.Job `json:"job"`
+}
+
+func (nw *ndjsonWriter) Write(uuid string, job *models.Job) error {
+	return nw.enc.Encode(&ndjsonRow{UUID: uuid, Job: job})
+}
+
+func (nw *ndjsonWriter) Close() error {
+	return nw.gz.Close()
+}
@@ -0,0 +1,105 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+
+	"poc-ddb-tidb-search/pkg/blob"
+	"poc-ddb-tidb-search/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func loadTestJob(t *testing.T) *models.Job {
+	testPayload, err := os.ReadFile("../../testData/job.json")
+	assert.NoError(t, err)
+
+	job := new(models.Job)
+	assert.NoError(t, json.Unmarshal(testPayload, job))
+	return job
+}
+
+func TestCSVWriter(t *testing.T) {
+	job := loadTestJob(t)
+
+	var buf bytes.Buffer
+	w, err := NewWriter(FormatCSV, &buf)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write("uuid-1", job))
+	assert.NoError(t, w.Close())
+
+	gz, err := gzip.NewReader(&buf)
+	assert.NoError(t, err)
+
+	records, err := csv.NewReader(gz).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, csvHeader, records[0])
+	assert.Equal(t, "uuid-1", records[1][0])
+	assert.Equal(t, job.ID, records[1][2])
+	assert.Equal(t, string(job.Status), records[1][5])
+}
+
+func TestNDJSONWriterToLocalStore(t *testing.T) {
+	job := loadTestJob(t)
+
+	tmp, err := os.CreateTemp(t.TempDir(), "export-*")
+	assert.NoError(t, err)
+	defer tmp.Close()
+
+	w, err := NewWriter(FormatNDJSON, tmp)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write("uuid-1", job))
+	assert.NoError(t, w.Write("uuid-2", job))
+	assert.NoError(t, w.Close())
+
+	_, err = tmp.Seek(0, 0)
+	assert.NoError(t, err)
+
+	store, err := blob.NewLocalStore(t.TempDir())
+	assert.NoError(t, err)
+
+	location, err := store.Put(context.Background(), "exports/org/id.ndjson.gz", tmp)
+	assert.NoError(t, err)
+	assert.Contains(t, location, "exports/org/id.ndjson.gz")
+
+	rc, err := store.Get(context.Background(), "exports/org/id.ndjson.gz")
+	assert.NoError(t, err)
+	defer rc.Close()
+
+	gz, err := gzip.NewReader(rc)
+	assert.NoError(t, err)
+
+	dec := json.NewDecoder(gz)
+	count := 0
+	for {
+		var row ndjsonRow
+		if err := dec.Decode(&row); err == io.EOF {
+			break
+		} else {
+			assert.NoError(t, err)
+		}
+		assert.Equal(t, job.ID, row.Job.ID)
+		count++
+	}
+	assert.Equal(t, 2, count)
+}
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatCSV, f)
+
+	f, err = ParseFormat("ndjson")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatNDJSON, f)
+
+	_, err = ParseFormat("xlsx")
+	assert.Error(t, err)
+}
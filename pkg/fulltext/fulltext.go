@@ -0,0 +1,116 @@
+package fulltext
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"poc-ddb-tidb-search/pkg/models"
+)
+
+const (
+	ngramSize   = 3
+	maxWordSize = 50
+
+	// word tokens rank above partial trigram matches
+	wordWeight  = 3
+	ngramWeight = 1
+
+	// MaxQueryTokens caps the tokens of a free text query
+	MaxQueryTokens = 64
+)
+
+// Keyword is a token of a job's searchable text and its relevance weight, stored in jobs_keywords
+type Keyword struct {
+	Token  string
+	Weight int
+}
+
+// Words splits text into lowercase words of letters and digits
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Tokens returns the distinct word ("w:" prefix) and padded trigram ("g:" prefix) tokens of text.
+// Trigrams make partial names and small typos still match most of the tokens of a word.
+func Tokens(text string) []string {
+	seen := make(map[string]bool)
+	tokens := make([]string, 0)
+
+	add := func(t string) {
+		if !seen[t] {
+			seen[t] = true
+			tokens = append(tokens, t)
+		}
+	}
+
+	for _, w := range Words(text) {
+		if r := []rune(w); len(r) > maxWordSize {
+			w = string(r[:maxWordSize])
+		}
+
+		add("w:" + w)
+		for _, g := range ngrams(w) {
+			add("g:" + g)
+		}
+	}
+
+	return tokens
+}
+
+// QueryTokens tokenizes a free text query, capped at MaxQueryTokens
+func QueryTokens(text string) []string {
+	tokens := Tokens(text)
+	if len(tokens) > MaxQueryTokens {
+		tokens = tokens[:MaxQueryTokens]
+	}
+	return tokens
+}
+
+// JobKeywords returns the weighted tokens of a job's names, addresses and tags
+func JobKeywords(job *models.Job) []*Keyword {
+	texts := []string{job.DeliveryAddress, job.PickupAddress, job.RecipientLine, job.ShipperLine}
+	texts = append(texts, job.PackageTags...)
+	texts = append(texts, job.OrderTagList...)
+
+	if job.OrderPayload != nil {
+		if job.OrderPayload.ShipperInfo != nil {
+			texts = append(texts, job.OrderPayload.ShipperInfo.Name)
+		}
+		if job.OrderPayload.ConsigneeInfo != nil {
+			texts = append(texts, job.OrderPayload.ConsigneeInfo.Name)
+		}
+		texts = append(texts, job.OrderPayload.TagList...)
+	}
+
+	weights := make(map[string]int)
+	for _, text := range texts {
+		for _, t := range Tokens(text) {
+			if strings.HasPrefix(t, "w:") {
+				weights[t] += wordWeight
+			} else {
+				weights[t] += ngramWeight
+			}
+		}
+	}
+
+	keywords := make([]*Keyword, 0, len(weights))
+	for t, w := range weights {
+		keywords = append(keywords, &Keyword{Token: t, Weight: w})
+	}
+	sort.Slice(keywords, func(i, j int) bool { return keywords[i].Token < keywords[j].Token })
+
+	return keywords
+}
+
+// ngrams returns the trigrams of the word padded with "_", so word boundaries count as well
+func ngrams(word string) []string {
+	runes := []rune("_" + word + "_")
+	grams := make([]string, 0, len(runes)-ngramSize+1)
+	for i := 0; i+ngramSize <= len(runes); i++ {
+		grams = append(grams, string(runes[i:i+ngramSize]))
+	}
+	return grams
+}
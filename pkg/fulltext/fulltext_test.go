@@ -0,0 +1,57 @@
+package fulltext
+
+import (
+	"testing"
+
+	"poc-ddb-tidb-search/pkg/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokens(t *testing.T) {
+	tokens := Tokens("Jon Smith-Doe")
+
+	assert.Contains(t, tokens, "w:jon")
+	assert.Contains(t, tokens, "w:smith")
+	assert.Contains(t, tokens, "w:doe")
+	assert.Contains(t, tokens, "g:smi")
+	assert.Contains(t, tokens, "g:ith")
+	assert.NotContains(t, tokens, "w:smith-doe")
+}
+
+func TestTypoSharesMostTrigrams(t *testing.T) {
+	indexed := make(map[string]bool)
+	for _, tok := range Tokens("Johnson") {
+		indexed[tok] = true
+	}
+
+	matched := 0
+	query := QueryTokens("jonson")
+	for _, tok := range query {
+		if indexed[tok] {
+			matched++
+		}
+	}
+
+	// the search requires at least half of the query tokens to match
+	assert.GreaterOrEqual(t, matched, (len(query)+1)/2)
+}
+
+func TestJobKeywords(t *testing.T) {
+	job := &models.Job{
+		DeliveryAddress: "12 Orchard Road",
+		PackageTags:     []string{"fragile"},
+		OrderPayload: &models.OrderPayload{
+			ConsigneeInfo: &models.ConsigneeInfo{Name: "Orchard Lee"},
+		},
+	}
+
+	weights := make(map[string]int)
+	for _, kw := range JobKeywords(job) {
+		weights[kw.Token] = kw.Weight
+	}
+
+	assert.Equal(t, 2*wordWeight, weights["w:orchard"])
+	assert.Equal(t, wordWeight, weights["w:fragile"])
+	assert.Equal(t, ngramWeight, weights["g:fra"])
+}
@@ -0,0 +1,143 @@
+package geo
+
+import (
+	"errors"
+	"math"
+)
+
+const (
+	EarthRadiusKm = 6371.0
+
+	// CellSize is the grid cell size in degrees (~11km at the equator)
+	CellSize = 0.1
+
+	cellsPerRow = int64(360 / CellSize)
+
+	// MaxCoveringCells caps the cells of a coarse lookup, larger areas only use the lat/lon range
+	MaxCoveringCells = 400
+)
+
+type Point struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
+
+type BoundingBox struct {
+	MinLat float64 `json:"min_lat"`
+	MinLon float64 `json:"min_lon"`
+	MaxLat float64 `json:"max_lat"`
+	MaxLon float64 `json:"max_lon"`
+}
+
+// Valid returns true if the point is a usable coordinate, 0,0 is treated as not set
+func (p Point) Valid() bool {
+	if p.Lat == 0 && p.Lon == 0 {
+		return false
+	}
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lon >= -180 && p.Lon <= 180
+}
+
+// Validate checks the box is within range. A box with MinLon greater than MaxLon crosses the
+// antimeridian, it spans from MinLon east to 180 and on from -180 to MaxLon
+func (b BoundingBox) Validate() error {
+	if b.MinLat < -90 || b.MaxLat > 90 || b.MinLon < -180 || b.MaxLon > 180 {
+		return errors.New("bounding box is out of range")
+	}
+	if b.MinLat > b.MaxLat {
+		return errors.New("bounding box min lat is greater than max lat")
+	}
+	return nil
+}
+
+// CrossesAntimeridian returns true if the box spans the 180th meridian
+func (b BoundingBox) CrossesAntimeridian() bool {
+	return b.MinLon > b.MaxLon
+}
+
+// Split returns the box as boxes which do not cross the antimeridian, the box itself if it doesn't
+func (b BoundingBox) Split() []BoundingBox {
+	if !b.CrossesAntimeridian() {
+		return []BoundingBox{b}
+	}
+
+	east, west := b, b
+	east.MaxLon = 180
+	west.MinLon = -180
+	return []BoundingBox{east, west}
+}
+
+// NormalizeLon wraps the longitude into [-180, 180), 180 is the same meridian as -180
+func NormalizeLon(lon float64) float64 {
+	lon = math.Mod(lon+180, 360)
+	if lon < 0 {
+		lon += 360
+	}
+	return lon - 180
+}
+
+// Cell returns the grid cell id of the coordinate, lon 180 is in the first column like -180
+func Cell(lat, lon float64) int64 {
+	row := int64(math.Floor((lat + 90) / CellSize))
+	col := int64(math.Floor((NormalizeLon(lon) + 180) / CellSize))
+	return row*cellsPerRow + col
+}
+
+// CoveringCells returns the grid cells intersecting the box, ok is false if there are more than MaxCoveringCells.
+// The box must not cross the antimeridian, see Split
+func CoveringCells(b BoundingBox) ([]int64, bool) {
+	minRow := int64(math.Floor((b.MinLat + 90) / CellSize))
+	maxRow := int64(math.Floor((b.MaxLat + 90) / CellSize))
+	minCol := int64(math.Floor((b.MinLon + 180) / CellSize))
+	maxCol := int64(math.Floor((b.MaxLon + 180) / CellSize))
+
+	if (maxRow-minRow+1)*(maxCol-minCol+1) > MaxCoveringCells {
+		return nil, false
+	}
+
+	cells := make([]int64, 0)
+	for row := minRow; row <= maxRow; row++ {
+		for col := minCol; col <= maxCol; col++ {
+			cells = append(cells, row*cellsPerRow+col%cellsPerRow) // lon 180 is in column 0
+		}
+	}
+	return cells, true
+}
+
+// RadiusBox returns the bounding box enclosing the circle around the point. Near the antimeridian
+// the box crosses it, MinLon is then greater than MaxLon
+func RadiusBox(p Point, radiusKm float64) BoundingBox {
+	angular := radiusKm / EarthRadiusKm
+	dLat := angular * 180 / math.Pi
+
+	// widest longitude of the circle, see http://janmatuschek.de/LatitudeLongitudeBoundingCoordinates
+	dLon := 180.0
+	if sin := math.Sin(angular) / math.Cos(p.Lat*math.Pi/180); sin < 1 {
+		dLon = math.Asin(sin) * 180 / math.Pi
+	}
+
+	box := BoundingBox{
+		MinLat: math.Max(p.Lat-dLat, -90),
+		MinLon: -180,
+		MaxLat: math.Min(p.Lat+dLat, 90),
+		MaxLon: 180,
+	}
+	if dLon < 180 {
+		box.MinLon = NormalizeLon(p.Lon - dLon)
+		box.MaxLon = NormalizeLon(p.Lon + dLon)
+		if box.MaxLon == -180 {
+			box.MaxLon = 180
+		}
+	}
+	return box
+}
+
+// DistanceKm is the haversine distance between two points
+func DistanceKm(a, b Point) float64 {
+	dLat := (b.Lat - a.Lat) * math.Pi / 180
+	dLon := (b.Lon - a.Lon) * math.Pi / 180
+
+	h := math.Pow(math.Sin(dLat/2), 2) +
+		math.Cos(a.Lat*math.Pi/180)*math.Cos(b.Lat*math.Pi/180)*math.Pow(math.Sin(dLon/2), 2)
+
+	return 2 * EarthRadiusKm * math.Asin(math.Sqrt(h))
+}
@@ -0,0 +1,80 @@
+package geo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCoveringCellsContainPointsInBox(t *testing.T) {
+	singapore := Point{Lat: 1.3521, Lon: 103.8198}
+	box := RadiusBox(singapore, 10)
+
+	cells, ok := CoveringCells(box)
+	assert.True(t, ok)
+
+	covered := make(map[int64]bool)
+	for _, c := range cells {
+		covered[c] = true
+	}
+
+	for _, p := range []Point{singapore, {Lat: box.MinLat, Lon: box.MinLon}, {Lat: box.MaxLat, Lon: box.MaxLon}} {
+		assert.True(t, covered[Cell(p.Lat, p.Lon)])
+	}
+}
+
+func TestRadiusBoxEnclosesRadius(t *testing.T) {
+	p := Point{Lat: 14.5995, Lon: 120.9842}
+	box := RadiusBox(p, 25)
+
+	assert.InDelta(t, 25, DistanceKm(p, Point{Lat: box.MaxLat, Lon: p.Lon}), 0.01)
+	assert.GreaterOrEqual(t, DistanceKm(p, Point{Lat: p.Lat, Lon: box.MaxLon}), 25.0)
+}
+
+func TestCoveringCellsTooLarge(t *testing.T) {
+	_, ok := CoveringCells(BoundingBox{MinLat: -10, MinLon: -10, MaxLat: 10, MaxLon: 10})
+	assert.False(t, ok)
+}
+
+func TestCellFoldsAntimeridian(t *testing.T) {
+	assert.Equal(t, Cell(-17.5, -180), Cell(-17.5, 180))
+	assert.NotEqual(t, Cell(-17.55, 180), Cell(-17.45, -180), "lon 180 must not spill into the next row")
+	assert.Equal(t, Cell(-17.5, -179.95), Cell(-17.5, 180.05))
+	assert.Equal(t, -180.0, NormalizeLon(180))
+	assert.Equal(t, 179.5, NormalizeLon(-180.5))
+}
+
+func TestRadiusBoxWrapsAntimeridian(t *testing.T) {
+	fiji := Point{Lat: -17.5, Lon: 179.95}
+	box := RadiusBox(fiji, 20)
+	assert.True(t, box.CrossesAntimeridian())
+	assert.NoError(t, box.Validate())
+	assert.Less(t, box.MaxLon, -179.0)
+	assert.Greater(t, box.MinLon, 179.0)
+
+	parts := box.Split()
+	assert.Len(t, parts, 2)
+	assert.Equal(t, 180.0, parts[0].MaxLon)
+	assert.Equal(t, -180.0, parts[1].MinLon)
+
+	covered := make(map[int64]bool)
+	for _, part := range parts {
+		assert.False(t, part.CrossesAntimeridian())
+		cells, ok := CoveringCells(part)
+		assert.True(t, ok)
+		for _, c := range cells {
+			covered[c] = true
+		}
+	}
+	for _, p := range []Point{fiji, {Lat: fiji.Lat, Lon: 180}, {Lat: fiji.Lat, Lon: -179.9}, {Lat: box.MinLat, Lon: box.MinLon}, {Lat: box.MaxLat, Lon: box.MaxLon}} {
+		assert.True(t, covered[Cell(p.Lat, p.Lon)], "%v", p)
+	}
+
+	assert.Len(t, RadiusBox(Point{Lat: 14.5995, Lon: 120.9842}, 25).Split(), 1)
+}
+
+func TestBoundingBoxValidate(t *testing.T) {
+	assert.NoError(t, BoundingBox{MinLat: -18, MinLon: 179, MaxLat: -17, MaxLon: -179}.Validate(), "crosses the antimeridian")
+	assert.Error(t, BoundingBox{MinLat: -17, MinLon: 179, MaxLat: -18, MaxLon: -179}.Validate())
+	assert.Error(t, BoundingBox{MinLat: -18, MinLon: 179, MaxLat: -17, MaxLon: 181}.Validate())
+}
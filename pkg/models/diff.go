@@ -0,0 +1,117 @@
+package models
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DiffJobs returns the json paths of the job fields that changed, empty for a no-op update
+func DiffJobs(old, new *Job) []string {
+	return Diff(old, new)
+}
+
+// Diff returns the sorted json paths of the fields that differ between two values of the same type,
+// e.g. status, order_payload.consignee_info.name or package_tags[1]. Lists of a different length
+// and pointers set on one side only are reported as a whole
+func Diff(old, new any) []string {
+	paths := make([]string, 0)
+	diffValues("", reflect.ValueOf(old), reflect.ValueOf(new), &paths)
+	sort.Strings(paths)
+	return paths
+}
+
+func diffValues(path string, a, b reflect.Value, paths *[]string) {
+	if !a.IsValid() || !b.IsValid() {
+		if a.IsValid() != b.IsValid() {
+			*paths = append(*paths, rootPath(path))
+		}
+		return
+	}
+
+	switch a.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				*paths = append(*paths, rootPath(path))
+			}
+			return
+		}
+		if a.Kind() == reflect.Interface && a.Elem().Type() != b.Elem().Type() {
+			*paths = append(*paths, rootPath(path))
+			return
+		}
+		diffValues(path, a.Elem(), b.Elem(), paths)
+
+	case reflect.Struct:
+		t := a.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if !f.IsExported() {
+				continue
+			}
+
+			name, skip := jsonName(f)
+			if skip {
+				continue
+			}
+
+			fieldPath := path
+			if !f.Anonymous || name != "" {
+				if name == "" {
+					name = f.Name
+				}
+				fieldPath = joinPath(path, name)
+			}
+			diffValues(fieldPath, a.Field(i), b.Field(i), paths)
+		}
+
+	case reflect.Slice, reflect.Array:
+		if a.Len() != b.Len() {
+			*paths = append(*paths, rootPath(path))
+			return
+		}
+		for i := 0; i < a.Len(); i++ {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), a.Index(i), b.Index(i), paths)
+		}
+
+	case reflect.Map:
+		keys := make(map[string]reflect.Value)
+		for _, k := range append(a.MapKeys(), b.MapKeys()...) {
+			keys[fmt.Sprint(k.Interface())] = k
+		}
+		for name, k := range keys {
+			diffValues(joinPath(path, name), a.MapIndex(k), b.MapIndex(k), paths)
+		}
+
+	default:
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*paths = append(*paths, rootPath(path))
+		}
+	}
+}
+
+// jsonName returns the json tag name of the field, skip for json:"-"
+func jsonName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	return name, false
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func rootPath(path string) string {
+	if path == "" {
+		return "."
+	}
+	return path
+}
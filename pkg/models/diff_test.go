@@ -0,0 +1,46 @@
+package models
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func loadTestJob(t *testing.T) *Job {
+	payload, err := os.ReadFile("../../testData/job.json")
+	assert.NoError(t, err)
+
+	job := new(Job)
+	assert.NoError(t, json.Unmarshal(payload, job))
+	return job
+}
+
+func TestDiffJobs(t *testing.T) {
+	old := loadTestJob(t)
+	assert.Empty(t, DiffJobs(old, loadTestJob(t)))
+
+	new := loadTestJob(t)
+	new.Status = "failed"
+	new.PackageTags = append(new.PackageTags, "fragile")
+	new.OrderPayload.ConsigneeInfo.Name = "Jane Doe"
+	new.FromFacility = &HubLocationInfo{FacilityName: "North Hub"}
+
+	expected := []string{"from_facility_detail", "order_payload.consignee_info.name", "package_tags", "status"}
+	assert.Equal(t, expected, DiffJobs(old, new))
+}
+
+func TestDiffListsAndMaps(t *testing.T) {
+	type item struct {
+		Name  string            `json:"name"`
+		Tags  []string          `json:"tags"`
+		Attrs map[string]string `json:"attrs"`
+		Skip  string            `json:"-"`
+	}
+
+	a := &item{Name: "a", Tags: []string{"x", "y"}, Attrs: map[string]string{"k": "1"}, Skip: "1"}
+	b := &item{Name: "a", Tags: []string{"x", "z"}, Attrs: map[string]string{"k": "2", "n": "3"}, Skip: "2"}
+
+	assert.Equal(t, []string{"attrs.k", "attrs.n", "tags[1]"}, Diff(a, b))
+}
@@ -535,6 +535,28 @@ func (job *Job) GetOrderLabel() string {
 	return orderLabel
 }
 
+// GetCustomerAccountName returns the customer account which booked the order, its shipper.
+// ShipperLine is only the sender line printed for the job
+func (job *Job) GetCustomerAccountName() string {
+	if job.OrderPayload == nil || job.OrderPayload.ShipperInfo == nil {
+		return ""
+	}
+	return job.OrderPayload.ShipperInfo.Name
+}
+
+// GetOrderReferenceIDs returns the reference ids the customer gave the order, RefOrderID is
+// the internal id of the order
+func (job *Job) GetOrderReferenceIDs() []string {
+	refs := make([]string, 0, 2)
+	if job.ReferenceID != "" {
+		refs = append(refs, job.ReferenceID)
+	}
+	if job.OrderPayload != nil && job.OrderPayload.ReferenceID != nil && *job.OrderPayload.ReferenceID != "" && *job.OrderPayload.ReferenceID != job.ReferenceID {
+		refs = append(refs, *job.OrderPayload.ReferenceID)
+	}
+	return refs
+}
+
 // GetShipmentLabel to return shipment ID human readable (in their own system definition)
 func (job *Job) GetShipmentLabel() string {
 	var shipLabel string
@@ -0,0 +1,425 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+
+	"poc-ddb-tidb-search/pkg/changefeed"
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/db/dbtest"
+	"poc-ddb-tidb-search/pkg/ddbstream"
+	"poc-ddb-tidb-search/pkg/models"
+	"poc-ddb-tidb-search/pkg/query"
+	queue "poc-ddb-tidb-search/pkg/sqs"
+	"poc-ddb-tidb-search/pkg/watch"
+	"poc-ddb-tidb-search/pkg/webhook"
+)
+
+const syncQueueURL = "https://sqs.local/sync.fifo"
+
+// receive hands the queued sync messages to the sync handler as lambda would
+func receive(t *testing.T, client *queue.MemoryClient, syncer *Syncer) []events.SQSMessage {
+	event := client.Receive(syncQueueURL)
+
+	resp, err := syncer.Handle(context.Background(), event)
+	assert.NoError(t, err)
+	assert.Empty(t, resp.BatchItemFailures)
+	return event.Records
+}
+
+func loadTestJob(t *testing.T) *models.Job {
+	payload, err := os.ReadFile("../../testData/job.json")
+	assert.NoError(t, err)
+
+	job := new(models.Job)
+	assert.NoError(t, json.Unmarshal(payload, job))
+	job.OrgID2 = "org1"
+	job.DocID = job.ID
+	return job
+}
+
+// TestLocalPipeline runs the table writes through the outbox, the stream receiver, the queue and
+// the TiDB sync in one process
+func TestLocalPipeline(t *testing.T) {
+	ctx := context.Background()
+	outbox := changefeed.NewOutbox()
+	jobs := db.NewMemoryDDB()
+	assert.NoError(t, jobs.SetTableName("jobs"))
+	table := changefeed.NewTable(jobs, outbox)
+
+	client := &queue.MemoryClient{}
+	receiver := &StreamReceiver{Client: client, QueueURL: syncQueueURL}
+	tiDB := &db.RecordingTiDB{}
+	syncer := &Syncer{TiDB: tiDB}
+
+	job := loadTestJob(t)
+	_, err := table.Put(job)
+	assert.NoError(t, err)
+	assert.NoError(t, outbox.Drain(ctx, receiver.Handle))
+
+	msgs := receive(t, client, syncer)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "insert", *msgs[0].MessageAttributes["recordType"].StringValue)
+	assert.Len(t, tiDB.Puts(), 1)
+	assert.Contains(t, tiDB.Puts()[0][0], job.RefShipmentID)
+
+	// the same job again is a no-op update and never reaches the queue
+	_, err = table.Put(loadTestJob(t))
+	assert.NoError(t, err)
+	assert.NoError(t, outbox.Drain(ctx, receiver.Handle))
+	assert.Empty(t, client.Messages())
+
+	job.Status = models.StatusCompleted
+	_, err = table.Put(job)
+	assert.NoError(t, err)
+	assert.NoError(t, outbox.Drain(ctx, receiver.Handle))
+
+	msgs = receive(t, client, syncer)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "modify", *msgs[0].MessageAttributes["recordType"].StringValue)
+	assert.Contains(t, strings.Split(*msgs[0].MessageAttributes["changedTables"].StringValue, ","), "jobs")
+
+	assert.NoError(t, table.Delete(&db.DDBKey{OrgID: job.OrgID2, DocID: job.DocID}))
+	assert.NoError(t, outbox.Drain(ctx, receiver.Handle))
+
+	msgs = receive(t, client, syncer)
+	assert.Len(t, msgs, 1)
+	assert.Equal(t, "remove", *msgs[0].MessageAttributes["recordType"].StringValue)
+
+	change, err := parseChange(msgs[0].Body)
+	assert.NoError(t, err)
+	assert.Equal(t, job.DocID, change.Keys.DocID)
+	assert.Equal(t, models.StatusCompleted, change.OldImage.Status)
+	assert.Nil(t, change.NewImage)
+	assert.Equal(t, 0, outbox.Pending())
+}
+
+// newTestTiDB returns a dbtest server migrated to the latest schema
+func newTestTiDB(t *testing.T) db.DB {
+	conn := dbtest.NewMySQL(t, db.TiDB_DatabaseName)
+	migrator, err := db.NewMigrator(conn)
+	assert.NoError(t, err)
+	_, err = migrator.Up(context.Background(), 0)
+	assert.NoError(t, err)
+	return db.NewTiDBFromConn(conn)
+}
+
+func countRows(t *testing.T, tiDB db.DB, q string) int {
+	var n int
+	assert.NoError(t, tiDB.GetTiDBConn().QueryRow(q).Scan(&n))
+	return n
+}
+
+// modifyMessage is the sync queue message of a modify record without the changed tables
+func modifyMessage(t *testing.T, job *models.Job) events.SQSMessage {
+	body, err := json.Marshal(&ddbstream.Change[models.Job]{EventName: "MODIFY", NewImage: job})
+	assert.NoError(t, err)
+
+	recordType := "modify"
+	return events.SQSMessage{
+		MessageId:         job.ID,
+		Body:              string(body),
+		MessageAttributes: map[string]events.SQSMessageAttribute{"recordType": {DataType: "String", StringValue: &recordType}},
+	}
+}
+
+// TestSyncerModify runs modify records through the sync against the sql engine, they replace the
+// rows of the changed tables of the synced job
+func TestSyncerModify(t *testing.T) {
+	ctx := context.Background()
+	outbox := changefeed.NewOutbox()
+	jobs := db.NewMemoryDDB()
+	assert.NoError(t, jobs.SetTableName("jobs"))
+	table := changefeed.NewTable(jobs, outbox)
+
+	client := &queue.MemoryClient{}
+	receiver := &StreamReceiver{Client: client, QueueURL: syncQueueURL}
+	tiDB := newTestTiDB(t)
+	syncer := &Syncer{TiDB: tiDB}
+
+	sync := func(job *models.Job) {
+		_, err := table.Put(job)
+		assert.NoError(t, err)
+		assert.NoError(t, outbox.Drain(ctx, receiver.Handle))
+		receive(t, client, syncer)
+	}
+
+	job := loadTestJob(t)
+	job.Status = models.StatusNew
+	job.PackageTags = []string{"fragile"}
+	sync(job)
+
+	job.Status = models.StatusFailed
+	job.PackageTags = []string{"cold"}
+	sync(job)
+
+	assert.Equal(t, 1, countRows(t, tiDB, "Select count(*) from jobs where status='failed'"))
+	assert.Equal(t, 1, countRows(t, tiDB, "Select count(*) from jobs_reference"))
+	assert.Equal(t, 1, countRows(t, tiDB, "Select count(*) from job_tags where tag='cold'"))
+	assert.Equal(t, 0, countRows(t, tiDB, "Select count(*) from job_tags where tag='fragile'"))
+
+	// a modify of a job which never reached tidb inserts it
+	other := loadTestJob(t)
+	other.ID, other.DocID = "never-synced", "never-synced"
+	_, err := syncer.Handle(ctx, events.SQSEvent{Records: []events.SQSMessage{modifyMessage(t, other)}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, countRows(t, tiDB, "Select count(*) from jobs where job_id='never-synced'"))
+}
+
+// TestSyncerRemove deletes the rows of a removed job
+func TestSyncerRemove(t *testing.T) {
+	ctx := context.Background()
+	outbox := changefeed.NewOutbox()
+	jobs := db.NewMemoryDDB()
+	assert.NoError(t, jobs.SetTableName("jobs"))
+	table := changefeed.NewTable(jobs, outbox)
+
+	client := &queue.MemoryClient{}
+	receiver := &StreamReceiver{Client: client, QueueURL: syncQueueURL}
+	tiDB := newTestTiDB(t)
+	syncer := &Syncer{TiDB: tiDB}
+
+	job := loadTestJob(t)
+	job.PackageTags = []string{"fragile"}
+	_, err := table.Put(job)
+	assert.NoError(t, err)
+	assert.NoError(t, outbox.Drain(ctx, receiver.Handle))
+	receive(t, client, syncer)
+	assert.Equal(t, 1, countRows(t, tiDB, "Select count(*) from jobs"))
+
+	assert.NoError(t, table.Delete(&db.DDBKey{OrgID: job.OrgID2, DocID: job.DocID}))
+	assert.NoError(t, outbox.Drain(ctx, receiver.Handle))
+	receive(t, client, syncer)
+
+	for _, table := range db.JobTables {
+		assert.Equal(t, 0, countRows(t, tiDB, "Select count(*) from "+table), table)
+	}
+}
+
+// TestSyncerModifyWatches notifies the watched searches a modified job starts to match, once
+func TestSyncerModifyWatches(t *testing.T) {
+	ctx := context.Background()
+	outbox := changefeed.NewOutbox()
+	jobs := db.NewMemoryDDB()
+	assert.NoError(t, jobs.SetTableName("jobs"))
+	table := changefeed.NewTable(jobs, outbox)
+
+	saved := db.NewMemoryDDB()
+	assert.NoError(t, saved.SetTableName("saved"))
+	assert.NoError(t, db.SaveSavedSearch(saved, &db.SavedSearch{
+		OrgID: "org1", UserID: "u1", ID: "failed", Name: "failed jobs",
+		Params: &query.JobSearchParams{Status: string(models.StatusFailed)},
+		Watch:  &db.SearchWatch{Sink: db.WatchSinkSQS},
+	}))
+	assert.NoError(t, db.SaveSavedSearch(saved, &db.SavedSearch{
+		OrgID: "org1", UserID: "u2", ID: "failed-hook", Name: "failed jobs",
+		Params: &query.JobSearchParams{Status: string(models.StatusFailed)},
+		Watch:  &db.SearchWatch{Sink: db.WatchSinkWebhook},
+	}))
+
+	const watchQueueURL = "https://sqs.local/watch"
+	const webhookQueueURL = "https://sqs.local/webhooks"
+	client := &queue.MemoryClient{}
+	receiver := &StreamReceiver{Client: client, QueueURL: syncQueueURL}
+	syncer := &Syncer{TiDB: newTestTiDB(t), SavedSearches: saved, Client: client, WatchQueueURL: watchQueueURL, WebhookQueueURL: webhookQueueURL}
+
+	sync := func(job *models.Job) []events.SQSMessage {
+		_, err := table.Put(job)
+		assert.NoError(t, err)
+		assert.NoError(t, outbox.Drain(ctx, receiver.Handle))
+		receive(t, client, syncer)
+		return client.Receive(watchQueueURL).Records
+	}
+
+	job := loadTestJob(t)
+	job.Status = models.StatusNew
+	assert.Empty(t, sync(job), "the new job does not match")
+
+	job.Status = models.StatusFailed
+	notified := sync(job)
+	if assert.Len(t, notified, 1) {
+		n := new(watch.Notification)
+		assert.NoError(t, json.Unmarshal([]byte(notified[0].Body), n))
+		assert.Equal(t, "modify", n.Event)
+		assert.Equal(t, "failed", n.SavedSearchID)
+		assert.Equal(t, job.ID, n.JobID)
+		assert.Equal(t, "failed", n.Status)
+	}
+
+	// webhook watches go through the signed webhook dispatcher
+	hooked := client.Receive(webhookQueueURL).Records
+	if assert.Len(t, hooked, 1) {
+		ev := new(webhook.Event)
+		assert.NoError(t, json.Unmarshal([]byte(hooked[0].Body), ev))
+		assert.Equal(t, webhook.EventSearchMatched, ev.Type)
+		assert.Equal(t, "org1", ev.OrgID)
+		assert.Equal(t, "failed-hook", ev.Search.SavedSearchID)
+		assert.Equal(t, "modify", ev.Search.Event)
+	}
+
+	job.PackageTags = []string{"cold"}
+	assert.Empty(t, sync(job), "the job matched before the change")
+
+	other := loadTestJob(t)
+	other.ID, other.DocID, other.Status = "never-synced", "never-synced", models.StatusFailed
+	_, err := syncer.Handle(ctx, events.SQSEvent{Records: []events.SQSMessage{modifyMessage(t, other)}})
+	assert.NoError(t, err)
+	assert.Len(t, client.Receive(watchQueueURL).Records, 1, "a modify inserting the job is a match")
+}
+
+// TestSyncerModifyWatchesMatchFailure doesn't notify the watched searches when the searches the job
+// matched before the change are unknown
+func TestSyncerModifyWatchesMatchFailure(t *testing.T) {
+	ctx := context.Background()
+	outbox := changefeed.NewOutbox()
+	jobs := db.NewMemoryDDB()
+	assert.NoError(t, jobs.SetTableName("jobs"))
+	table := changefeed.NewTable(jobs, outbox)
+
+	saved := db.NewMemoryDDB()
+	assert.NoError(t, saved.SetTableName("saved"))
+	assert.NoError(t, db.SaveSavedSearch(saved, &db.SavedSearch{
+		OrgID: "org1", UserID: "u1", ID: "failed", Name: "failed jobs",
+		Params: &query.JobSearchParams{Status: string(models.StatusFailed)},
+		Watch:  &db.SearchWatch{Sink: db.WatchSinkSQS},
+	}))
+
+	const watchQueueURL = "https://sqs.local/watch"
+	client := &queue.MemoryClient{}
+	receiver := &StreamReceiver{Client: client, QueueURL: syncQueueURL}
+	tiDB := &failingMatchTiDB{DB: newTestTiDB(t)}
+	syncer := &Syncer{TiDB: tiDB, SavedSearches: saved, Client: client, WatchQueueURL: watchQueueURL}
+
+	sync := func(job *models.Job) []events.SQSMessage {
+		_, err := table.Put(job)
+		assert.NoError(t, err)
+		assert.NoError(t, outbox.Drain(ctx, receiver.Handle))
+		receive(t, client, syncer)
+		return client.Receive(watchQueueURL).Records
+	}
+
+	job := loadTestJob(t)
+	job.Status = models.StatusFailed
+	assert.Len(t, sync(job), 1)
+
+	tiDB.failMatch = true
+	job.PackageTags = []string{"cold"}
+	assert.Empty(t, sync(job), "the job may have matched before the change")
+	assert.Equal(t, 1, countRows(t, tiDB, "Select count(*) from job_tags where tag='cold'"), "the job is synced")
+}
+
+// failingMatchTiDB fails the watch matches until the next put
+type failingMatchTiDB struct {
+	db.DB
+	failMatch bool
+}
+
+func (f *failingMatchTiDB) Search(input ...any) (any, error) {
+	if _, ok := input[0].(*db.SQLStatement); ok && f.failMatch {
+		return nil, errors.New("tidb down")
+	}
+	return f.DB.Search(input...)
+}
+
+func (f *failingMatchTiDB) Put(input ...any) (any, error) {
+	f.failMatch = false
+	return f.DB.Put(input...)
+}
+
+func TestSyncerReportsFailures(t *testing.T) {
+	job := loadTestJob(t)
+	legacy, err := json.Marshal(job)
+	assert.NoError(t, err)
+
+	attrs := func(recordType string) map[string]events.SQSMessageAttribute {
+		return map[string]events.SQSMessageAttribute{"recordType": {DataType: "String", StringValue: &recordType}}
+	}
+	event := events.SQSEvent{Records: []events.SQSMessage{
+		{MessageId: "legacy", Body: string(legacy), MessageAttributes: attrs("insert")},
+		{MessageId: "unknown", Body: string(legacy), MessageAttributes: attrs("upsert")},
+		{MessageId: "garbage", Body: "{", MessageAttributes: attrs("insert")},
+	}}
+
+	tiDB := &db.RecordingTiDB{}
+	resp, err := (&Syncer{TiDB: tiDB}).Handle(context.Background(), event)
+	assert.NoError(t, err)
+	assert.Equal(t, []events.SQSBatchItemFailure{{ItemIdentifier: "unknown"}, {ItemIdentifier: "garbage"}}, resp.BatchItemFailures)
+	assert.Len(t, tiDB.Puts(), 1, "bare job bodies queued before the change records are still inserted")
+
+	tiDB.PutErr = errors.New("tidb down")
+	resp, err = (&Syncer{TiDB: tiDB}).Handle(context.Background(), events.SQSEvent{Records: event.Records[:1]})
+	assert.NoError(t, err)
+	assert.Equal(t, []events.SQSBatchItemFailure{{ItemIdentifier: "legacy"}}, resp.BatchItemFailures)
+}
+
+func TestStreamReceiverWebhookEvents(t *testing.T) {
+	ctx := context.Background()
+	outbox := changefeed.NewOutbox()
+	jobs := db.NewMemoryDDB()
+	assert.NoError(t, jobs.SetTableName("jobs"))
+	table := changefeed.NewTable(jobs, outbox)
+
+	const webhookQueueURL = "https://sqs.local/webhooks"
+	client := &queue.MemoryClient{}
+	receiver := &StreamReceiver{Client: client, QueueURL: syncQueueURL, WebhookQueueURL: webhookQueueURL}
+
+	job := loadTestJob(t)
+	_, err := table.Put(job)
+	assert.NoError(t, err)
+	job.Status = models.StatusFailed
+	_, err = table.Put(job)
+	assert.NoError(t, err)
+	assert.NoError(t, table.Delete(&db.DDBKey{OrgID: job.OrgID2, DocID: job.DocID}))
+	assert.NoError(t, outbox.Drain(ctx, receiver.Handle))
+
+	assert.Len(t, client.Receive(syncQueueURL).Records, 3)
+
+	types := make([]string, 0)
+	for _, msg := range client.Receive(webhookQueueURL).Records {
+		ev := new(webhook.Event)
+		assert.NoError(t, json.Unmarshal([]byte(msg.Body), ev))
+		assert.Equal(t, job.DocID, ev.JobID)
+		assert.Equal(t, "org1", ev.OrgID)
+		types = append(types, ev.Type)
+	}
+	assert.Equal(t, []string{webhook.EventJobCreated, webhook.EventJobStatusChanged, webhook.EventJobDeleted}, types)
+
+	// a failed webhook send doesn't fail the record the sync already received
+	receiver.Client = &failingQueue{SendMessageClient: client, queueURL: webhookQueueURL}
+	job.Status = models.StatusCompleted
+	_, err = table.Put(job)
+	assert.NoError(t, err)
+	assert.NoError(t, outbox.Drain(ctx, receiver.Handle))
+	assert.Len(t, client.Receive(syncQueueURL).Records, 1)
+	assert.Empty(t, client.Receive(webhookQueueURL).Records)
+
+	receiver.Client = client
+	client.SendErr = errors.New("sqs down")
+	job.Status = models.StatusFailed
+	_, err = table.Put(job)
+	assert.NoError(t, err)
+	assert.Error(t, outbox.Drain(ctx, receiver.Handle))
+	assert.Equal(t, 1, outbox.Pending(), "the failed change is delivered again")
+}
+
+// failingQueue fails the sends to one queue
+type failingQueue struct {
+	queue.SendMessageClient
+	queueURL string
+}
+
+func (f *failingQueue) SendMessage(ctx context.Context, in *sqs.SendMessageInput, opts ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	if aws.ToString(in.QueueUrl) == f.queueURL {
+		return nil, errors.New("sqs down")
+	}
+	return f.SendMessageClient.SendMessage(ctx, in, opts...)
+}
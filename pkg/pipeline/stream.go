@@ -0,0 +1,165 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	logger "github.com/sirupsen/logrus"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/ddbstream"
+	"poc-ddb-tidb-search/pkg/models"
+	queue "poc-ddb-tidb-search/pkg/sqs"
+	"poc-ddb-tidb-search/pkg/webhook"
+)
+
+// StreamReceiver forwards the job table changes to the sync queue, and the job lifecycle events
+// to the webhook queue when it is set
+type StreamReceiver struct {
+	Client          queue.SendMessageClient
+	QueueURL        string
+	WebhookQueueURL string
+}
+
+// Handle is the stream handler, failed records are reported so the stream retries from them
+func (sr *StreamReceiver) Handle(ctx context.Context, streamEvent events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
+	streamEventFailures := events.DynamoDBEventResponse{BatchItemFailures: make([]events.DynamoDBBatchItemFailure, 0)}
+
+	for _, event := range streamEvent.Records {
+		change, err := parseRecordStream(&event)
+		if err != nil {
+			logger.WithFields(logger.Fields{
+				"error": err.Error(),
+				"code":  "DDBStreamErr",
+			}).Error("failed to parse stream event")
+			streamEventFailures.BatchItemFailures = append(streamEventFailures.BatchItemFailures, events.DynamoDBBatchItemFailure{ItemIdentifier: event.Change.SequenceNumber})
+			continue
+		}
+
+		job := change.Current()
+
+		var changed, tables []string
+		if change.OldImage != nil && change.NewImage != nil {
+			changed = models.DiffJobs(change.OldImage, change.NewImage)
+			if len(changed) == 0 {
+				logger.WithFields(logger.Fields{
+					"orgID": job.OrgID2,
+					"docID": job.DocID,
+				}).Info("skipping no-op update")
+				continue
+			}
+
+			tables, err = db.AffectedTables(change.OldImage, change.NewImage)
+			if err != nil {
+				logger.WithFields(logger.Fields{
+					"error": err.Error(),
+					"code":  "DiffErr",
+				}).Error("failed to compare job tables")
+				streamEventFailures.BatchItemFailures = append(streamEventFailures.BatchItemFailures, events.DynamoDBBatchItemFailure{ItemIdentifier: event.Change.SequenceNumber})
+				continue
+			}
+		}
+
+		err = sr.sendToQueue(ctx, change, tables)
+		if err != nil {
+			logger.WithFields(logger.Fields{
+				"error": err.Error(),
+				"code":  "SQSErr",
+			}).Error("failed to send stream event to queue ")
+			streamEventFailures.BatchItemFailures = append(streamEventFailures.BatchItemFailures, events.DynamoDBBatchItemFailure{ItemIdentifier: event.Change.SequenceNumber})
+			continue
+		}
+
+		// the sync already has the record, retrying it for the webhook would sync it twice
+		err = sr.sendWebhookEvent(ctx, job, &event, changed)
+		if err != nil {
+			logger.WithFields(logger.Fields{
+				"error":   err.Error(),
+				"code":    "SQSErr",
+				"eventID": event.EventID,
+				"orgID":   job.OrgID2,
+				"docID":   job.DocID,
+			}).Error("failed to send webhook event to queue, the event is dropped")
+		}
+	}
+
+	return streamEventFailures, nil
+}
+
+// parseRecordStream decodes the keys and images of the stream event, removed items only
+// have their keys and old image
+func parseRecordStream(event *events.DynamoDBEventRecord) (*ddbstream.Change[models.Job], error) {
+	return ddbstream.ConvertChange[models.Job](event, "json") // should add dynamodbav tags in job struct as well
+}
+
+// sendToQueue forwards the change record to the TiDB sync, modify events carry the tables that need updating
+func (sr *StreamReceiver) sendToQueue(ctx context.Context, change *ddbstream.Change[models.Job], tables []string) error {
+	msg, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+
+	job := change.Current()
+	input := queue.NewQueueInput(sr.QueueURL, string(msg))
+	input.SetMessageAttributes("recordType", strings.ToLower(change.EventName)) // remove, insert or modify
+	input.SetMessageAttributes("orgID", job.OrgID2)
+	if len(tables) > 0 {
+		input.SetMessageAttributes("changedTables", strings.Join(tables, ","))
+	}
+	input.SetMessageGroupID(job.OrgID2)
+
+	_, err = queue.Enqueue(ctx, sr.Client, input)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// sendWebhookEvent queues the job lifecycle event for the webhook dispatcher, the stream event id
+// identifies it to the receivers. Modify events changing the status are sent as job.status_changed
+func (sr *StreamReceiver) sendWebhookEvent(ctx context.Context, job *models.Job, event *events.DynamoDBEventRecord, changed []string) error {
+	if sr.WebhookQueueURL == "" {
+		return nil
+	}
+
+	eventType := webhook.EventJobUpdated
+	switch event.EventName {
+	case string(events.DynamoDBOperationTypeInsert):
+		eventType = webhook.EventJobCreated
+	case string(events.DynamoDBOperationTypeRemove):
+		eventType = webhook.EventJobDeleted
+	default:
+		for _, path := range changed {
+			if path == "status" {
+				eventType = webhook.EventJobStatusChanged
+			}
+		}
+	}
+
+	ev := &webhook.Event{
+		ID:            event.EventID,
+		Type:          eventType,
+		OrgID:         job.OrgID2,
+		OccurredAt:    event.Change.ApproximateCreationDateTime.UTC(),
+		JobID:         job.DocID,
+		ChangedFields: changed,
+	}
+	if eventType != webhook.EventJobDeleted {
+		ev.Job = job
+	}
+
+	msg, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	input := queue.NewQueueInput(sr.WebhookQueueURL, string(msg))
+	input.SetMessageAttributes("eventType", eventType)
+	input.SetMessageAttributes("orgID", job.OrgID2)
+
+	_, err = queue.Enqueue(ctx, sr.Client, input)
+	return err
+}
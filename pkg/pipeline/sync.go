@@ -0,0 +1,361 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+	logger "github.com/sirupsen/logrus"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/ddbstream"
+	"poc-ddb-tidb-search/pkg/models"
+	queue "poc-ddb-tidb-search/pkg/sqs"
+	"poc-ddb-tidb-search/pkg/watch"
+)
+
+const (
+	recType_Insert = "insert"
+	recType_Modify = "modify"
+	recType_Remove = "remove"
+
+	// RecordTypeReconcile marks the jobs queued by the reconciler, their rows are replaced by the
+	// new image or deleted when there is none
+	RecordTypeReconcile = "reconcile"
+)
+
+// Syncer applies the queued job changes to TiDB. When the saved search table is set, the synced
+// jobs are matched against the watched searches, sqs sinks publish to WatchQueueURL and webhook
+// sinks to the webhook dispatcher at WebhookQueueURL with Client
+type Syncer struct {
+	TiDB            db.DB
+	SavedSearches   db.DB
+	Client          queue.SendMessageClient
+	WatchQueueURL   string
+	WebhookQueueURL string
+}
+
+// Handle is the sync queue handler, failed messages are reported so only they are retried
+func (s *Syncer) Handle(ctx context.Context, event events.SQSEvent) (*events.SQSEventResponse, error) {
+	failures := make([]events.SQSBatchItemFailure, 0, len(event.Records))
+	for _, record := range event.Records {
+		err := s.parseAndSend(ctx, &record)
+		if err != nil {
+			failures = append(failures, events.SQSBatchItemFailure{ItemIdentifier: record.MessageId})
+		}
+	}
+
+	return &events.SQSEventResponse{
+		BatchItemFailures: failures,
+	}, nil
+}
+
+func (s *Syncer) parseAndSend(ctx context.Context, record *events.SQSMessage) error {
+
+	change, err := parseChange(record.Body)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "SQSParseErr",
+			"body":  record.Body,
+		}).Error("failed to parse sqs message")
+		return err
+	}
+
+	// get sqs messag attributes -> recordType, orgID and the changed tables of modify records
+	orgID, recordType, tables := getMessageAttribs(record)
+	if orgID == "" {
+		orgID = change.Current().OrgID2
+	}
+
+	return s.syncToTiDB(ctx, orgID, recordType, tables, change)
+}
+
+// parseChange decodes the stream change record, messages queued before the records were
+// forwarded only have the new image of the job
+func parseChange(body string) (*ddbstream.Change[models.Job], error) {
+	change := new(ddbstream.Change[models.Job])
+	err := json.Unmarshal([]byte(body), change)
+	if err != nil {
+		return nil, err
+	}
+
+	if change.Keys == nil && change.NewImage == nil && change.OldImage == nil {
+		job := new(models.Job)
+		if err := json.Unmarshal([]byte(body), job); err != nil {
+			return nil, err
+		}
+		change.NewImage = job
+	}
+
+	return change, nil
+}
+
+func (s *Syncer) syncToTiDB(ctx context.Context, orgID, recordType string, tables []string, change *ddbstream.Change[models.Job]) error {
+	var err error
+
+	switch recordType {
+
+	case recType_Insert:
+		if change.NewImage == nil {
+			return errors.New("insert record without new image")
+		}
+
+		var id string
+		id, err = insertToTiDB(change.NewImage, s.TiDB)
+		if err == nil {
+			// the job is synced, a failed notification must not retry the insert
+			s.notifyWatchers(ctx, orgID, recordType, id, change.NewImage, nil)
+		}
+
+	case recType_Modify:
+		if change.NewImage == nil {
+			return errors.New("modify record without new image")
+		}
+
+		err = s.modify(ctx, orgID, tables, change)
+
+	case RecordTypeReconcile:
+		err = reconcileToTiDB(orgID, change, s.TiDB)
+
+	case recType_Remove:
+		err = removeFromTiDB(orgID, change, s.TiDB)
+
+	default:
+		return errors.New("unknown record type")
+	}
+
+	return err
+}
+
+func getMessageAttribs(record *events.SQSMessage) (string, string, []string) {
+	orgID, recType := "", ""
+	var tables []string
+
+	for k, v := range record.MessageAttributes {
+		switch k {
+		case "orgID":
+			orgID = *v.StringValue
+		case "recordType":
+			recType = *v.StringValue
+		case "changedTables":
+			tables = strings.Split(*v.StringValue, ",")
+		default:
+			continue
+		}
+	}
+
+	return orgID, recType, tables
+}
+
+func insertToTiDB(job *models.Job, tiDB db.DB) (string, error) {
+	id := uuid.New()
+
+	stmts, err := db.MakeInsertJobSQLStatements(job, id.String())
+	if err != nil {
+		return "", err
+	}
+
+	sqlStmts := make([]any, 0, len(stmts))
+	for _, stmt := range stmts {
+		sqlStmts = append(sqlStmts, stmt)
+	}
+
+	_, err = tiDB.Put(sqlStmts...)
+	if err != nil {
+		return "", err
+	}
+
+	return id.String(), nil
+}
+
+// reconcileToTiDB deletes the rows of the job and inserts the new image, in one transaction
+func reconcileToTiDB(orgID string, change *ddbstream.Change[models.Job], tiDB db.DB) error {
+	job := change.Current()
+	if job == nil || job.ID == "" {
+		return errors.New("reconcile record without job id")
+	}
+
+	sqlStmts := make([]any, 0)
+	for _, stmt := range db.MakeDeleteJobsSQLStatements(map[string][]string{orgID: {job.ID}}) {
+		sqlStmts = append(sqlStmts, stmt)
+	}
+
+	if change.NewImage != nil {
+		stmts, err := db.MakeInsertJobSQLStatements(change.NewImage, uuid.New().String())
+		if err != nil {
+			return err
+		}
+		for _, stmt := range stmts {
+			sqlStmts = append(sqlStmts, stmt)
+		}
+	}
+
+	_, err := tiDB.Put(sqlStmts...)
+	return err
+}
+
+// removeFromTiDB deletes the rows of the removed job
+func removeFromTiDB(orgID string, change *ddbstream.Change[models.Job], tiDB db.DB) error {
+	job := change.Current()
+	if job == nil || job.ID == "" {
+		return errors.New("remove record without job id")
+	}
+
+	sqlStmts := make([]any, 0)
+	for _, stmt := range db.MakeDeleteJobsSQLStatements(map[string][]string{orgID: {job.ID}}) {
+		sqlStmts = append(sqlStmts, stmt)
+	}
+
+	_, err := tiDB.Put(sqlStmts...)
+	return err
+}
+
+// modify replaces the rows of the synced job in the changed tables, all of them when the record
+// doesn't say which. A job which was never synced is inserted. The watched searches are notified
+// of the searches the job matches after the change but didn't before
+func (s *Syncer) modify(ctx context.Context, orgID string, tables []string, change *ddbstream.Change[models.Job]) error {
+	job := change.NewImage
+
+	res, err := s.TiDB.Search(db.MakeSelectJobUUIDSQLStatement(orgID, job.ID))
+	if err != nil {
+		return err
+	}
+	if r, ok := res.(*db.TiDBResult); !ok || len(r.Details) == 0 {
+		id, err := insertToTiDB(job, s.TiDB)
+		if err == nil {
+			s.notifyWatchers(ctx, orgID, recType_Modify, id, job, nil)
+		}
+		return err
+	}
+	id := res.(*db.TiDBResult).Details[0].UUID
+
+	if len(tables) == 0 && change.OldImage != nil {
+		tables, err = db.AffectedTables(change.OldImage, job)
+		if err != nil {
+			return err
+		}
+		if len(tables) == 0 {
+			return nil
+		}
+	}
+	if len(tables) == 0 {
+		tables = db.JobTables
+	}
+
+	stmts, err := db.MakeUpdateJobSQLStatements(job, id, tables)
+	if err != nil {
+		return err
+	}
+	sqlStmts := make([]any, 0, len(stmts))
+	for _, stmt := range stmts {
+		sqlStmts = append(sqlStmts, stmt)
+	}
+
+	// without the searches the job matched before, every match would look new
+	matched, _, matchErr := s.matchWatchers(orgID, recType_Modify, id, job)
+	if _, err := s.TiDB.Put(sqlStmts...); err != nil {
+		return err
+	}
+	if matchErr != nil {
+		logger.WithFields(logger.Fields{
+			"error": matchErr.Error(),
+			"code":  "WatchErr",
+			"orgID": orgID,
+			"jobID": job.ID,
+		}).Error("failed to match watched searches before the update, the watchers are not notified")
+		return nil
+	}
+
+	// the job is synced, a failed notification must not retry the update
+	skip := make(map[string]bool, len(matched))
+	for _, n := range matched {
+		skip[n.SavedSearchID] = true
+	}
+	s.notifyWatchers(ctx, orgID, recType_Modify, id, job, skip)
+	return nil
+}
+
+// matchWatchers returns a notification per watched search of the org the synced job matches and
+// the searches by id, none when there is no saved search table
+func (s *Syncer) matchWatchers(orgID, recordType, id string, job *models.Job) ([]*watch.Notification, map[string]*db.SavedSearch, error) {
+	if s.SavedSearches == nil {
+		return nil, nil, nil
+	}
+	if orgID == "" {
+		orgID = job.OrgID2
+	}
+
+	searches, err := db.ListWatchedSearches(s.SavedSearches, orgID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list watched searches: %w", err)
+	}
+	if len(searches) == 0 {
+		return nil, nil, nil
+	}
+
+	matches, err := watch.Match(s.TiDB, searches, recordType, id, job)
+	if err != nil {
+		return nil, nil, fmt.Errorf("match watched searches: %w", err)
+	}
+
+	byID := make(map[string]*db.SavedSearch, len(searches))
+	for _, search := range searches {
+		byID[search.ID] = search
+	}
+	return matches, byID, nil
+}
+
+// notifyWatchers publishes the synced job to the sinks of the org's watched searches it matches,
+// except the skipped ones
+func (s *Syncer) notifyWatchers(ctx context.Context, orgID, recordType, id string, job *models.Job, skip map[string]bool) {
+	matches, byID, err := s.matchWatchers(orgID, recordType, id, job)
+	if err != nil {
+		logger.WithFields(logger.Fields{
+			"error": err.Error(),
+			"code":  "WatchErr",
+			"orgID": orgID,
+			"jobID": job.ID,
+		}).Error("failed to match watched searches")
+		return
+	}
+
+	for _, n := range matches {
+		if skip[n.SavedSearchID] {
+			continue
+		}
+		sink, err := s.watchSink(byID[n.SavedSearchID].Watch)
+		if err == nil {
+			err = sink.Publish(ctx, n)
+		}
+		if err != nil {
+			logger.WithFields(logger.Fields{
+				"error":         err.Error(),
+				"code":          "WatchErr",
+				"savedSearchID": n.SavedSearchID,
+			}).Error("failed to publish watch notification")
+		}
+	}
+}
+
+func (s *Syncer) watchSink(w *db.SearchWatch) (watch.Sink, error) {
+	if s.Client == nil {
+		return nil, errors.New("no sqs client for watch notifications")
+	}
+
+	switch w.Sink {
+	case db.WatchSinkWebhook:
+		if s.WebhookQueueURL == "" {
+			return nil, errors.New("no webhook queue for watch notifications")
+		}
+		return &watch.WebhookSink{Client: s.Client, QueueURL: s.WebhookQueueURL}, nil
+	case db.WatchSinkSQS:
+		return &watch.SQSSink{Client: s.Client, QueueURL: s.WatchQueueURL}, nil
+	}
+
+	return nil, errors.New("unknown watch sink " + w.Sink)
+}
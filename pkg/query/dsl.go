@@ -0,0 +1,339 @@
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// FieldType tells how a filter field's values are validated and compared
+type FieldType int
+
+const (
+	FieldString FieldType = iota
+	FieldDate
+	FieldNumber
+	FieldList // child table values (tags, references), only eq and in
+)
+
+// FilterFields are the fields a filter can use, pkg/db maps them to columns
+var FilterFields = map[string]FieldType{
+	"shipment_id":           FieldString,
+	"order_id":              FieldString,
+	"job_id":                FieldString,
+	"status":                FieldString,
+	"start_time":            FieldDate,
+	"commit_time":           FieldDate,
+	"completed_time":        FieldDate,
+	"cod_amount":            FieldNumber,
+	"vendor_name":           FieldString,
+	"facility_name":         FieldString,
+	"sender_name":           FieldString,
+	"consignee_name":        FieldString,
+	"customer_account_name": FieldString,
+	"driver_id":             FieldString,
+	"driver_name":           FieldString,
+	"vehicle_number":        FieldString,
+	"tracking_id":           FieldString,
+	"client_order_code":     FieldString,
+	"order_label":           FieldString,
+	"shipment_label":        FieldString,
+	"package_label":         FieldString,
+	"pickup_postcode":       FieldString,
+	"pickup_city":           FieldString,
+	"pickup_state":          FieldString,
+	"pickup_country":        FieldString,
+	"delivery_postcode":     FieldString,
+	"delivery_city":         FieldString,
+	"delivery_state":        FieldString,
+	"delivery_country":      FieldString,
+	"shipment_tags":         FieldList,
+	"order_tags":            FieldList,
+	"customer_ref":          FieldList,
+}
+
+const (
+	OpEq       = "eq"
+	OpIn       = "in"
+	OpRange    = "range"
+	OpPrefix   = "prefix"
+	OpContains = "contains"
+)
+
+const (
+	maxFilterDepth  = 10
+	maxFilterLeaves = 100
+	maxInValues     = 500
+)
+
+// Filter is the json form of the search filter language, a node is either
+// {"and": [...]}, {"or": [...]}, {"not": {...}} or a field condition such as
+// {"field": "status", "op": "in", "value": ["failed", "cancelled"]} and
+// {"field": "start_time", "op": "range", "gte": "2023-03-01", "lt": "2023-04-01"}
+type Filter struct {
+	And []*Filter `json:"and,omitempty"`
+	Or  []*Filter `json:"or,omitempty"`
+	Not *Filter   `json:"not,omitempty"`
+
+	Field string `json:"field,omitempty"`
+	Op    string `json:"op,omitempty"`
+	Value any    `json:"value,omitempty"`
+	Gte   any    `json:"gte,omitempty"`
+	Gt    any    `json:"gt,omitempty"`
+	Lte   any    `json:"lte,omitempty"`
+	Lt    any    `json:"lt,omitempty"`
+}
+
+// FilterSearch is the POST /search body
+type FilterSearch struct {
+	Filter     *Filter `json:"filter"`
+	PageSize   int     `json:"page_size"`
+	PageNumber int     `json:"page_number"`
+
+	Root Node `json:"-"` // parsed Filter
+}
+
+// Node is the parsed filter AST
+type Node interface {
+	node()
+}
+
+type AndNode struct {
+	Children []Node
+}
+
+type OrNode struct {
+	Children []Node
+}
+
+type NotNode struct {
+	Child Node
+}
+
+// CompareNode is an eq, in, prefix or contains condition
+type CompareNode struct {
+	Field  string
+	Type   FieldType
+	Op     string
+	Values []string
+}
+
+// RangeNode bounds a field, unset bounds are empty
+type RangeNode struct {
+	Field string
+	Type  FieldType
+	Gte   string
+	Gt    string
+	Lte   string
+	Lt    string
+}
+
+func (AndNode) node()     {}
+func (OrNode) node()      {}
+func (NotNode) node()     {}
+func (CompareNode) node() {}
+func (RangeNode) node()   {}
+
+func FilterSearchFromRequest(request *events.APIGatewayProxyRequest) (*FilterSearch, error) {
+	fs := &FilterSearch{PageSize: pageSize}
+	if err := json.Unmarshal([]byte(request.Body), fs); err != nil {
+		return nil, fmt.Errorf("invalid search body: %v", err)
+	}
+
+	if fs.Filter == nil {
+		return nil, errors.New("missing filter")
+	}
+	if fs.PageSize <= 0 {
+		fs.PageSize = pageSize
+	}
+	if fs.PageSize > maxPageSize {
+		return nil, fmt.Errorf("page size must be at most %d", maxPageSize)
+	}
+	if fs.PageNumber < 0 {
+		return nil, errors.New("page number must not be negative")
+	}
+
+	root, err := ParseFilter(fs.Filter)
+	if err != nil {
+		return nil, err
+	}
+	fs.Root = root
+
+	return fs, nil
+}
+
+// ParseFilter validates the filter and converts it to the AST
+func ParseFilter(f *Filter) (Node, error) {
+	leaves := 0
+	return parseFilter(f, 0, &leaves)
+}
+
+func parseFilter(f *Filter, depth int, leaves *int) (Node, error) {
+	if f == nil {
+		return nil, errors.New("empty filter node")
+	}
+	if depth > maxFilterDepth {
+		return nil, fmt.Errorf("filter is nested deeper than %d levels", maxFilterDepth)
+	}
+
+	kinds := 0
+	for _, set := range []bool{f.And != nil, f.Or != nil, f.Not != nil, f.Field != ""} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return nil, errors.New("filter node must have exactly one of and, or, not or field")
+	}
+
+	switch {
+	case f.And != nil:
+		children, err := parseChildren(f.And, depth, leaves)
+		if err != nil {
+			return nil, err
+		}
+		return &AndNode{Children: children}, nil
+	case f.Or != nil:
+		children, err := parseChildren(f.Or, depth, leaves)
+		if err != nil {
+			return nil, err
+		}
+		return &OrNode{Children: children}, nil
+	case f.Not != nil:
+		child, err := parseFilter(f.Not, depth+1, leaves)
+		if err != nil {
+			return nil, err
+		}
+		return &NotNode{Child: child}, nil
+	}
+
+	*leaves++
+	if *leaves > maxFilterLeaves {
+		return nil, fmt.Errorf("filter has more than %d conditions", maxFilterLeaves)
+	}
+
+	return parseCondition(f)
+}
+
+func parseChildren(filters []*Filter, depth int, leaves *int) ([]Node, error) {
+	if len(filters) == 0 {
+		return nil, errors.New("and/or must have at least one filter")
+	}
+
+	children := make([]Node, 0, len(filters))
+	for _, child := range filters {
+		n, err := parseFilter(child, depth+1, leaves)
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, n)
+	}
+	return children, nil
+}
+
+func parseCondition(f *Filter) (Node, error) {
+	fieldType, ok := FilterFields[f.Field]
+	if !ok {
+		return nil, fmt.Errorf("unsupported filter field %q", f.Field)
+	}
+
+	switch f.Op {
+	case OpEq, OpPrefix, OpContains:
+		if fieldType == FieldList && f.Op != OpEq {
+			return nil, fmt.Errorf("%s only supports eq and in", f.Field)
+		}
+		if fieldType != FieldString && fieldType != FieldList && f.Op != OpEq {
+			return nil, fmt.Errorf("%s does not support %s", f.Field, f.Op)
+		}
+
+		v, err := filterValue(f.Field, fieldType, f.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &CompareNode{Field: f.Field, Type: fieldType, Op: f.Op, Values: []string{v}}, nil
+
+	case OpIn:
+		list, ok := f.Value.([]any)
+		if !ok || len(list) == 0 {
+			return nil, fmt.Errorf("%s in needs a non empty list", f.Field)
+		}
+		if len(list) > maxInValues {
+			return nil, fmt.Errorf("%s in has more than %d values", f.Field, maxInValues)
+		}
+
+		values := make([]string, 0, len(list))
+		for _, item := range list {
+			v, err := filterValue(f.Field, fieldType, item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, v)
+		}
+		return &CompareNode{Field: f.Field, Type: fieldType, Op: OpIn, Values: values}, nil
+
+	case OpRange:
+		if fieldType != FieldDate && fieldType != FieldNumber {
+			return nil, fmt.Errorf("%s does not support range", f.Field)
+		}
+		if f.Gte == nil && f.Gt == nil && f.Lte == nil && f.Lt == nil {
+			return nil, fmt.Errorf("%s range needs at least one of gte, gt, lte or lt", f.Field)
+		}
+
+		r := &RangeNode{Field: f.Field, Type: fieldType}
+		bounds := []struct {
+			in  any
+			out *string
+		}{{f.Gte, &r.Gte}, {f.Gt, &r.Gt}, {f.Lte, &r.Lte}, {f.Lt, &r.Lt}}
+
+		for _, b := range bounds {
+			if b.in == nil {
+				continue
+			}
+			v, err := filterValue(f.Field, fieldType, b.in)
+			if err != nil {
+				return nil, err
+			}
+			*b.out = v
+		}
+		return r, nil
+	}
+
+	return nil, fmt.Errorf("unsupported filter op %q", f.Op)
+}
+
+// filterValue converts a json scalar to the string form of the field type. Dates are compared as
+// whole days, so an RFC3339 value becomes the yyyy-mm-dd of its own offset
+func filterValue(field string, fieldType FieldType, value any) (string, error) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		s = strconv.FormatBool(v)
+	default:
+		return "", fmt.Errorf("%s value must be a string or number", field)
+	}
+
+	switch fieldType {
+	case FieldDate:
+		if _, err := time.Parse(dateLayout, s); err == nil {
+			return s, nil
+		}
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t.Format(dateLayout), nil
+		}
+		return "", fmt.Errorf("%s value %q must be yyyy-mm-dd or RFC3339", field, s)
+	case FieldNumber:
+		if _, err := strconv.ParseFloat(s, 64); err != nil {
+			return "", fmt.Errorf("%s value %q must be a number", field, s)
+		}
+	}
+
+	return s, nil
+}
@@ -3,31 +3,71 @@ package query
 import (
 	"errors"
 	"fmt"
+	"poc-ddb-tidb-search/pkg/geo"
 	"poc-ddb-tidb-search/pkg/models"
 	"strconv"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 )
 
 type JobSearchParams struct {
 	//jobs table
-	ShipmentID string
-	OrderID    string
-	JobID      string
-	Status     string
-	StartTime  string // cast to date
-	CommitTime string // cast to date
+	ShipmentID string `json:"shipment_id,omitempty"`
+	OrderID    string `json:"order_id,omitempty"`
+	JobID      string `json:"job_id,omitempty"`
+	Status     string `json:"status,omitempty"`
+	StartTime  string `json:"start_time,omitempty"`  // cast to date
+	CommitTime string `json:"commit_time,omitempty"` // cast to date
 
 	//ref table
-	ShipmentTags  string // like
-	OrderRefTags  string // like
-	ConsigneeName string
-	SenderName    string
-	VendorName    string
-	FacilityName  string
-
-	PageSize   int
-	PageNumber int
+	ConsigneeName   string `json:"consignee_name,omitempty"`
+	SenderName      string `json:"sender_name,omitempty"`
+	VendorName      string `json:"vendor_name,omitempty"`
+	FacilityName    string `json:"facility_name,omitempty"`
+	AccountName     string `json:"customer_account_name,omitempty"`
+	DriverID        string `json:"driver_id,omitempty"`
+	DriverName      string `json:"driver_name,omitempty"`
+	VehicleNumber   string `json:"vehicle_number,omitempty"`
+	TrackingID      string `json:"tracking_id,omitempty"`
+	ClientOrderCode string `json:"client_order_code,omitempty"`
+	OrderLabel      string `json:"order_label,omitempty"`
+	ShipmentLabel   string `json:"shipment_label,omitempty"`
+	PackageLabel    string `json:"package_label,omitempty"`
+
+	//ref table, address of both legs, *PostcodePrefix matches postcodes starting with the value
+	PickupPostcode         string `json:"pickup_postcode,omitempty"`
+	PickupPostcodePrefix   string `json:"pickup_postcode_prefix,omitempty"`
+	PickupCity             string `json:"pickup_city,omitempty"`
+	PickupState            string `json:"pickup_state,omitempty"`
+	PickupCountry          string `json:"pickup_country,omitempty"`
+	DeliveryPostcode       string `json:"delivery_postcode,omitempty"`
+	DeliveryPostcodePrefix string `json:"delivery_postcode_prefix,omitempty"`
+	DeliveryCity           string `json:"delivery_city,omitempty"`
+	DeliveryState          string `json:"delivery_state,omitempty"`
+	DeliveryCountry        string `json:"delivery_country,omitempty"`
+
+	//customer references table
+	CustomerRef string `json:"customer_ref,omitempty"`
+
+	//tag tables, exact tag match
+	ShipmentTags []string `json:"shipment_tags,omitempty"`
+	OrderTags    []string `json:"order_tags,omitempty"`
+	TagMatch     string   `json:"tag_match,omitempty"` // any (default) or all of the tags
+
+	//job locations table
+	Near     *geo.Point       `json:"near,omitempty"`
+	RadiusKm float64          `json:"radius_km,omitempty"`
+	BBox     *geo.BoundingBox `json:"bbox,omitempty"`
+	GeoLeg   string           `json:"geo_leg,omitempty"` // service (default), pickup or delivery
+
+	//keywords table
+	Text string `json:"q,omitempty"` // free text over names, addresses and tags, ordered by relevance
+
+	Facets []string `json:"facets,omitempty"` // group by counts, see allFacets
+
+	PageSize   int `json:"page_size"`
+	PageNumber int `json:"page_number"`
 }
 
 type JobRow struct {
@@ -35,11 +75,17 @@ type JobRow struct {
 	Job  *models.Job `json:"job"`
 }
 
+type FacetCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
 type JobSearchResult struct {
-	Data         []*JobRow `json:"data"`
-	PageSize     int       `json:"page_size"`
-	TotalItems   int       `json:"total_items"`
-	ResponseTime string    `json:"response_time"`
+	Data         []*JobRow                `json:"data"`
+	PageSize     int                      `json:"page_size"`
+	TotalItems   int                      `json:"total_items"`
+	Facets       map[string][]*FacetCount `json:"facets,omitempty"`
+	ResponseTime string                   `json:"response_time"`
 }
 
 var allQueryParameters = []string{
@@ -51,15 +97,61 @@ var allQueryParameters = []string{
 	"commit_time",
 	"shipment_tags",
 	"order_tags",
+	"tag_match",
 	"consignee_name",
 	"sender_name",
 	"vendor_name",
 	"facility_name",
+	"customer_account_name",
+	"driver_id",
+	"driver_name",
+	"vehicle_number",
+	"tracking_id",
+	"client_order_code",
+	"order_label",
+	"shipment_label",
+	"package_label",
+	"pickup_postcode",
+	"pickup_postcode_prefix",
+	"pickup_city",
+	"pickup_state",
+	"pickup_country",
+	"delivery_postcode",
+	"delivery_postcode_prefix",
+	"delivery_city",
+	"delivery_state",
+	"delivery_country",
+	"customer_ref",
+	"near",
+	"radius_km",
+	"bbox",
+	"geo_leg",
+	"q",
+	"facets",
 	"page_size",
 	"page_number",
 }
 
-const pageSize = 20
+var allFacets = []string{
+	"status",
+	"assigned_vendor",
+	"assigned_facility",
+}
+
+const (
+	pageSize    = 20
+	maxPageSize = 100
+)
+
+var errNoParams = errors.New("no valid params found")
+
+const (
+	TagMatchAny = "any"
+	TagMatchAll = "all"
+)
+
+// GeoLegs are the job_locations legs, service is the pickup or delivery location depending on the service type
+var GeoLegs = []string{"service", "pickup", "delivery"}
 
 func ParametersFromRequest(request *events.APIGatewayProxyRequest) (*JobSearchParams, error) {
 	p := &JobSearchParams{PageNumber: 0, PageSize: pageSize}
@@ -71,6 +163,51 @@ func ParametersFromRequest(request *events.APIGatewayProxyRequest) (*JobSearchPa
 	return p, nil
 }
 
+// ParametersFromSavedSearch starts from the saved params and overrides them with the request's query parameters
+func ParametersFromSavedSearch(saved *JobSearchParams, request *events.APIGatewayProxyRequest) (*JobSearchParams, error) {
+	p := *saved
+	if p.PageSize <= 0 {
+		p.PageSize = pageSize
+	}
+
+	if err := p.readQueryParameters(request); err != nil && !errors.Is(err, errNoParams) {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// Validate checks params that did not come from query parameters, e.g. a saved search body
+func (p *JobSearchParams) Validate() error {
+	if p.TagMatch != "" && p.TagMatch != TagMatchAny && p.TagMatch != TagMatchAll {
+		return fmt.Errorf("tag match must be %s or %s", TagMatchAny, TagMatchAll)
+	}
+	if p.GeoLeg != "" && !contains(GeoLegs, p.GeoLeg) {
+		return fmt.Errorf("unsupported geo leg %q", p.GeoLeg)
+	}
+	if (p.Near == nil) != (p.RadiusKm == 0) {
+		return errors.New("near and radius_km must be used together")
+	}
+	if p.Near != nil && (!p.Near.Valid() || p.RadiusKm < 0) {
+		return errors.New("near is not a valid coordinate")
+	}
+	if p.BBox != nil {
+		if err := p.BBox.Validate(); err != nil {
+			return err
+		}
+	}
+	for _, f := range p.Facets {
+		if !contains(allFacets, f) {
+			return fmt.Errorf("unsupported facet %q", f)
+		}
+	}
+	if p.PageSize < 0 || p.PageNumber < 0 {
+		return errors.New("page size and number must not be negative")
+	}
+
+	return nil
+}
+
 func (p *JobSearchParams) readQueryParameters(request *events.APIGatewayProxyRequest) error {
 	hasParamValue := false
 
@@ -98,9 +235,9 @@ func (p *JobSearchParams) readQueryParameters(request *events.APIGatewayProxyReq
 		case "commit_time":
 			p.CommitTime = param
 		case "shipment_tags":
-			p.ShipmentTags = param
+			p.ShipmentTags = splitList(param)
 		case "order_tags":
-			p.OrderRefTags = param
+			p.OrderTags = splitList(param)
 		case "consignee_name":
 			p.ConsigneeName = param
 		case "sender_name":
@@ -109,6 +246,88 @@ func (p *JobSearchParams) readQueryParameters(request *events.APIGatewayProxyReq
 			p.VendorName = param
 		case "facility_name":
 			p.FacilityName = param
+		case "customer_account_name":
+			p.AccountName = param
+		case "driver_id":
+			p.DriverID = param
+		case "driver_name":
+			p.DriverName = param
+		case "vehicle_number":
+			p.VehicleNumber = param
+		case "tracking_id":
+			p.TrackingID = param
+		case "client_order_code":
+			p.ClientOrderCode = param
+		case "order_label":
+			p.OrderLabel = param
+		case "shipment_label":
+			p.ShipmentLabel = param
+		case "package_label":
+			p.PackageLabel = param
+		case "pickup_postcode":
+			p.PickupPostcode = param
+		case "pickup_postcode_prefix":
+			p.PickupPostcodePrefix = param
+		case "pickup_city":
+			p.PickupCity = param
+		case "pickup_state":
+			p.PickupState = param
+		case "pickup_country":
+			p.PickupCountry = param
+		case "delivery_postcode":
+			p.DeliveryPostcode = param
+		case "delivery_postcode_prefix":
+			p.DeliveryPostcodePrefix = param
+		case "delivery_city":
+			p.DeliveryCity = param
+		case "delivery_state":
+			p.DeliveryState = param
+		case "delivery_country":
+			p.DeliveryCountry = param
+		case "customer_ref":
+			p.CustomerRef = param
+		case "tag_match":
+			if param != "" && param != TagMatchAny && param != TagMatchAll {
+				return fmt.Errorf("tag match must be %s or %s", TagMatchAny, TagMatchAll)
+			}
+			p.TagMatch = param
+		case "near":
+			coords, err := parseFloats(param, 2)
+			if err != nil {
+				return fmt.Errorf("near must be lat,lon: %v", err)
+			}
+			p.Near = &geo.Point{Lat: coords[0], Lon: coords[1]}
+			if !p.Near.Valid() {
+				return errors.New("near is not a valid coordinate")
+			}
+		case "radius_km":
+			radius, err := strconv.ParseFloat(param, 64)
+			if err != nil || radius <= 0 {
+				return errors.New("radius_km must be a positive number")
+			}
+			p.RadiusKm = radius
+		case "bbox":
+			coords, err := parseFloats(param, 4)
+			if err != nil {
+				return fmt.Errorf("bbox must be min_lat,min_lon,max_lat,max_lon: %v", err)
+			}
+			p.BBox = &geo.BoundingBox{MinLat: coords[0], MinLon: coords[1], MaxLat: coords[2], MaxLon: coords[3]}
+			if err := p.BBox.Validate(); err != nil {
+				return err
+			}
+		case "geo_leg":
+			if !contains(GeoLegs, param) {
+				return fmt.Errorf("unsupported geo leg %q", param)
+			}
+			p.GeoLeg = param
+		case "q":
+			p.Text = param
+		case "facets":
+			facets, err := parseFacets(param)
+			if err != nil {
+				return err
+			}
+			p.Facets = facets
 		case "page_size":
 			pageSize, err := strconv.ParseInt(param, 10, 32)
 			if err != nil {
@@ -124,12 +343,61 @@ func (p *JobSearchParams) readQueryParameters(request *events.APIGatewayProxyReq
 		}
 	}
 
+	if (p.Near == nil) != (p.RadiusKm == 0) {
+		return errors.New("near and radius_km must be used together")
+	}
+
 	if !hasParamValue {
-		return errors.New("no valid params found")
+		return errNoParams
 	}
 	return nil
 }
 
+func parseFloats(param string, n int) ([]float64, error) {
+	parts := strings.Split(param, ",")
+	if len(parts) != n {
+		return nil, fmt.Errorf("expected %d numbers", n)
+	}
+
+	values := make([]float64, 0, n)
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// splitList splits a comma separated param, dropping empty and duplicate values
+func splitList(param string) []string {
+	list := make([]string, 0)
+	seen := make(map[string]bool)
+
+	for _, v := range strings.Split(param, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		list = append(list, v)
+	}
+
+	return list
+}
+
+func parseFacets(param string) ([]string, error) {
+	facets := splitList(param)
+	for _, f := range facets {
+		if !contains(allFacets, f) {
+			return nil, fmt.Errorf("unsupported facet %q", f)
+		}
+	}
+
+	return facets, nil
+}
+
 func GetOrgID(request *events.APIGatewayProxyRequest) string {
 	orgID, ok := request.Headers["ORGID"]
 	if !ok {
@@ -141,3 +409,12 @@ func GetOrgID(request *events.APIGatewayProxyRequest) string {
 
 	return orgID
 }
+
+func GetUserID(request *events.APIGatewayProxyRequest) string {
+	userID, ok := request.Headers["USERID"]
+	if !ok {
+		userID = request.Headers["userid"]
+	}
+
+	return userID
+}
@@ -0,0 +1,33 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParametersFromSavedSearch(t *testing.T) {
+	saved := &JobSearchParams{Status: "failed", FacilityName: "North Hub", PageSize: 50}
+
+	p, err := ParametersFromSavedSearch(saved, &events.APIGatewayProxyRequest{
+		QueryStringParameters: map[string]string{"saved": "abc", "status": "cancelled", "start_time": "2023-03-01"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "cancelled", p.Status)
+	assert.Equal(t, "North Hub", p.FacilityName)
+	assert.Equal(t, "2023-03-01", p.StartTime)
+	assert.Equal(t, 50, p.PageSize)
+	assert.Equal(t, "failed", saved.Status, "saved params must not change")
+
+	p, err = ParametersFromSavedSearch(saved, &events.APIGatewayProxyRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, *saved, *p)
+}
+
+func TestValidateSavedParams(t *testing.T) {
+	assert.NoError(t, (&JobSearchParams{Status: "failed", Facets: []string{"status"}}).Validate())
+	assert.Error(t, (&JobSearchParams{TagMatch: "some"}).Validate())
+	assert.Error(t, (&JobSearchParams{Facets: []string{"detail"}}).Validate())
+	assert.Error(t, (&JobSearchParams{RadiusKm: 5}).Validate())
+}
@@ -0,0 +1,112 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// ReportParams describes an aggregate over the jobs matching Filters:
+// the metric is computed per time bucket of DateField and per GroupBy value
+type ReportParams struct {
+	Filters   *JobSearchParams `json:"filters"`
+	Bucket    string           `json:"bucket"`     // day, week, month or empty for no time bucket
+	DateField string           `json:"date_field"` // start_time, commit_time or completed_time
+	GroupBy   string           `json:"group_by"`   // see reportDimensions, empty for no grouping
+	Metric    string           `json:"metric"`     // count, on_time or cod_total
+	From      string           `json:"from"`       // yyyy-mm-dd, inclusive
+	To        string           `json:"to"`         // yyyy-mm-dd, inclusive
+}
+
+type ReportRow struct {
+	Bucket  string             `json:"bucket,omitempty"`
+	Group   string             `json:"group,omitempty"`
+	Metrics map[string]float64 `json:"metrics"`
+}
+
+type ReportResult struct {
+	Bucket       string       `json:"bucket,omitempty"`
+	GroupBy      string       `json:"group_by,omitempty"`
+	Metric       string       `json:"metric"`
+	Rows         []*ReportRow `json:"rows"`
+	ResponseTime string       `json:"response_time"`
+}
+
+var (
+	reportBuckets    = []string{"", "day", "week", "month"}
+	reportDateFields = []string{"start_time", "commit_time", "completed_time"}
+	reportDimensions = []string{"", "status", "assigned_vendor", "assigned_facility", "job_city",
+		"pickup_city", "pickup_country", "delivery_city", "delivery_country"}
+	reportMetrics = []string{"count", "on_time", "cod_total"}
+)
+
+const dateLayout = "2006-01-02"
+
+func ReportParametersFromRequest(request *events.APIGatewayProxyRequest) (*ReportParams, error) {
+	filters := &JobSearchParams{}
+	if err := filters.readQueryParameters(request); err != nil && !errors.Is(err, errNoParams) {
+		return nil, err
+	}
+
+	qs := request.QueryStringParameters
+	p := &ReportParams{
+		Filters:   filters,
+		Bucket:    qs["bucket"],
+		DateField: qs["date_field"],
+		GroupBy:   qs["group_by"],
+		Metric:    qs["metric"],
+		From:      qs["from"],
+		To:        qs["to"],
+	}
+
+	if p.DateField == "" {
+		p.DateField = "start_time"
+	}
+	if p.Metric == "" {
+		p.Metric = "count"
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Validate checks the report params against the supported buckets, fields, dimensions and metrics
+func (p *ReportParams) Validate() error {
+	if !contains(reportBuckets, p.Bucket) {
+		return fmt.Errorf("unsupported bucket %q", p.Bucket)
+	}
+	if !contains(reportDateFields, p.DateField) {
+		return fmt.Errorf("unsupported date field %q", p.DateField)
+	}
+	if !contains(reportDimensions, p.GroupBy) {
+		return fmt.Errorf("unsupported group by %q", p.GroupBy)
+	}
+	if !contains(reportMetrics, p.Metric) {
+		return fmt.Errorf("unsupported metric %q", p.Metric)
+	}
+
+	for _, d := range []string{p.From, p.To} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse(dateLayout, d); err != nil {
+			return fmt.Errorf("date %q is not in yyyy-mm-dd format", d)
+		}
+	}
+
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,31 @@
+package query
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportParametersFromRequest(t *testing.T) {
+	p, err := ReportParametersFromRequest(&events.APIGatewayProxyRequest{
+		QueryStringParameters: map[string]string{"bucket": "week", "group_by": "assigned_vendor", "status": "failed", "from": "2023-03-01"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "start_time", p.DateField)
+	assert.Equal(t, "count", p.Metric)
+	assert.Equal(t, "failed", p.Filters.Status)
+	assert.Equal(t, "2023-03-01", p.From)
+
+	for _, qs := range []map[string]string{
+		{"bucket": "year"},
+		{"date_field": "updated_at"},
+		{"group_by": "detail"},
+		{"metric": "sum"},
+		{"from": "01/03/2023"},
+		{"to": "2023-03-01' or '1'='1"},
+	} {
+		_, err := ReportParametersFromRequest(&events.APIGatewayProxyRequest{QueryStringParameters: qs})
+		assert.Error(t, err, qs)
+	}
+}
@@ -0,0 +1,237 @@
+// Package reconcile compares the jobs of an org in the job table with their TiDB rows, to find the
+// jobs the sync lost, the rows of removed jobs and the rows out of date with their job
+package reconcile
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	logger "github.com/sirupsen/logrus"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/ddbstream"
+	"poc-ddb-tidb-search/pkg/models"
+	"poc-ddb-tidb-search/pkg/pipeline"
+	"poc-ddb-tidb-search/pkg/query"
+	queue "poc-ddb-tidb-search/pkg/sqs"
+)
+
+const defaultPageSize = 500
+
+// the kinds of drift between the job table and TiDB
+const (
+	DriftMissing   = "missing"   // the job has no TiDB row
+	DriftExtra     = "extra"     // the row has no job, e.g. the job was removed
+	DriftStale     = "stale"     // the row holds another version of the job
+	DriftDuplicate = "duplicate" // the job has more than one row
+)
+
+// Drift is a job whose TiDB rows differ from the job table, UUIDs are the rows TiDB has of it
+type Drift struct {
+	Kind  string   `json:"kind"`
+	OrgID string   `json:"org_id"`
+	JobID string   `json:"job_id"`
+	DocID string   `json:"doc_id,omitempty"`
+	UUIDs []string `json:"uuids,omitempty"`
+
+	job *models.Job // the job of the table, or of the extra row
+}
+
+// Report is the result of an org, Jobs are the jobs of the table and Rows the jobs rows of TiDB
+type Report struct {
+	OrgID  string   `json:"org_id"`
+	Jobs   int      `json:"jobs"`
+	Rows   int      `json:"rows"`
+	Drifts []*Drift `json:"drifts"`
+}
+
+// Reconciler compares the job table DDB with TiDB. Repairs are sent to the sync queue QueueURL
+// with Client, the sync replaces the rows of the job, or deletes them when the job is gone
+type Reconciler struct {
+	DDB      db.DB
+	TiDB     db.DB
+	Client   queue.SendMessageClient
+	QueueURL string
+	PageSize int
+}
+
+// tidbRow is a jobs row and the hash of its detail
+type tidbRow struct {
+	uuid string
+	hash string
+	job  *models.Job
+}
+
+// Org compares the jobs of the org, reading the TiDB rows in pages of PageSize
+func (r *Reconciler) Org(ctx context.Context, orgID string) (*Report, error) {
+	if r.PageSize < 1 {
+		r.PageSize = defaultPageSize
+	}
+
+	res, err := r.DDB.Search(&db.DDBQuery{OrgID: orgID})
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := make(map[string]*models.Job)
+	hashes := make(map[string]string)
+	for _, item := range res.([]map[string]types.AttributeValue) {
+		job := new(models.Job)
+		if err := db.UnmarshalDDBItem(item, job); err != nil || job.ID == "" {
+			continue // not a job
+		}
+		if hashes[job.ID], err = Hash(job); err != nil {
+			return nil, err
+		}
+		jobs[job.ID] = job
+	}
+
+	rows, extra, err := r.tidbRows(orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{OrgID: orgID, Jobs: len(jobs), Rows: len(extra), Drifts: make([]*Drift, 0)}
+	for _, list := range rows {
+		report.Rows += len(list)
+	}
+
+	for id, job := range jobs {
+		list := rows[id]
+		drift := &Drift{OrgID: orgID, JobID: id, DocID: job.DocID, job: job}
+		for _, row := range list {
+			drift.UUIDs = append(drift.UUIDs, row.uuid)
+		}
+
+		switch {
+		case len(list) == 0:
+			drift.Kind = DriftMissing
+		case len(list) > 1:
+			drift.Kind = DriftDuplicate
+		case list[0].hash != hashes[id]:
+			drift.Kind = DriftStale
+		default:
+			continue
+		}
+		report.Drifts = append(report.Drifts, drift)
+	}
+
+	for id, list := range rows {
+		if jobs[id] != nil {
+			continue
+		}
+		drift := &Drift{Kind: DriftExtra, OrgID: orgID, JobID: id, DocID: list[0].job.DocID, job: list[0].job}
+		for _, row := range list {
+			drift.UUIDs = append(drift.UUIDs, row.uuid)
+		}
+		report.Drifts = append(report.Drifts, drift)
+	}
+
+	// rows whose detail is not a job can only be found by uuid
+	report.Drifts = append(report.Drifts, extra...)
+
+	sort.Slice(report.Drifts, func(i, j int) bool {
+		a, b := report.Drifts[i], report.Drifts[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.JobID != b.JobID {
+			return a.JobID < b.JobID
+		}
+		return fmt.Sprint(a.UUIDs) < fmt.Sprint(b.UUIDs)
+	})
+	return report, nil
+}
+
+// tidbRows reads the jobs rows of the org by job id, and the rows without a decodable job as extra
+func (r *Reconciler) tidbRows(orgID string) (map[string][]*tidbRow, []*Drift, error) {
+	rows := make(map[string][]*tidbRow)
+	extra := make([]*Drift, 0)
+	after := ""
+
+	for {
+		res, err := r.TiDB.Search(db.MakeExportSQLStatement(&query.JobSearchParams{}, orgID, after, r.PageSize))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		details := res.(*db.TiDBResult).Details
+		for _, row := range details {
+			job, err := row.Job()
+			if err != nil || job.ID == "" {
+				extra = append(extra, &Drift{Kind: DriftExtra, OrgID: orgID, UUIDs: []string{row.UUID}})
+				continue
+			}
+
+			hash, err := Hash(job)
+			if err != nil {
+				return nil, nil, err
+			}
+			rows[job.ID] = append(rows[job.ID], &tidbRow{uuid: row.UUID, hash: hash, job: job})
+		}
+
+		if len(details) < r.PageSize {
+			return rows, extra, nil
+		}
+		after = details[len(details)-1].UUID
+	}
+}
+
+// Hash is the sha256 of the job's json, the same for the job of the table and the detail of its row
+func Hash(job *models.Job) (string, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Repair queues a reconcile record per drift for the sync, with the job as the new image unless the
+// job is gone. Rows without a job id can not be repaired through the sync and are skipped
+func (r *Reconciler) Repair(ctx context.Context, drifts []*Drift) (int, error) {
+	repaired := 0
+	for _, d := range drifts {
+		if d.JobID == "" || d.job == nil {
+			logger.WithFields(logger.Fields{
+				"orgID": d.OrgID,
+				"uuids": d.UUIDs,
+				"code":  "ReconcileSkip",
+			}).Warn("row without a job can not be repaired")
+			continue
+		}
+
+		change := &ddbstream.Change[models.Job]{
+			EventName: "RECONCILE",
+			Keys:      &models.Job{OrgID2: d.OrgID, DocID: d.DocID},
+		}
+		if d.Kind == DriftExtra {
+			change.OldImage = d.job
+		} else {
+			change.NewImage = d.job
+		}
+
+		msg, err := json.Marshal(change)
+		if err != nil {
+			return repaired, err
+		}
+
+		input := queue.NewQueueInput(r.QueueURL, string(msg))
+		input.SetMessageAttributes("recordType", pipeline.RecordTypeReconcile)
+		input.SetMessageAttributes("orgID", d.OrgID)
+		input.SetMessageGroupID(d.OrgID)
+
+		if _, err := queue.Enqueue(ctx, r.Client, input); err != nil {
+			return repaired, err
+		}
+		repaired++
+	}
+
+	return repaired, nil
+}
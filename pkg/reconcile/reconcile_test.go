@@ -0,0 +1,156 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/models"
+	"poc-ddb-tidb-search/pkg/pipeline"
+	queue "poc-ddb-tidb-search/pkg/sqs"
+)
+
+const syncQueueURL = "https://sqs.local/sync.fifo"
+
+func loadTestJob(t *testing.T, id string) *models.Job {
+	payload, err := os.ReadFile("../../testData/job.json")
+	assert.NoError(t, err)
+
+	job := new(models.Job)
+	assert.NoError(t, json.Unmarshal(payload, job))
+	job.OrgID2 = "org1"
+	job.ID = id
+	job.DocID = id
+	return job
+}
+
+func detail(t *testing.T, job *models.Job) string {
+	data, err := json.Marshal(job)
+	assert.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+var pageSQL = regexp.MustCompile(`uuid > '([^']*)' order by uuid limit (\d+)`)
+
+// pagedTiDB answers the export statements of the reconciler from the rows, by uuid
+func pagedTiDB(rows []*db.TiDBRow) *db.RecordingTiDB {
+	sort.Slice(rows, func(i, j int) bool { return rows[i].UUID < rows[j].UUID })
+
+	return &db.RecordingTiDB{SearchFunc: func(input ...any) (*db.TiDBResult, error) {
+		m := pageSQL.FindStringSubmatch(input[0].(string))
+		limit, _ := strconv.Atoi(m[2])
+
+		page := make([]*db.TiDBRow, 0)
+		for _, row := range rows {
+			if row.UUID > m[1] && len(page) < limit {
+				page = append(page, row)
+			}
+		}
+		return &db.TiDBResult{Details: page}, nil
+	}}
+}
+
+// newFixtures returns a table of jobs 1 to 4 and TiDB rows with job 1 in sync, job 2 missing,
+// job 3 out of date, job 4 twice, the removed job 5 and a row which is not a job
+func newFixtures(t *testing.T) (db.DB, *db.RecordingTiDB) {
+	table := db.NewMemoryDDB()
+	assert.NoError(t, table.SetTableName("jobs"))
+
+	for _, id := range []string{"JOB-1", "JOB-2", "JOB-3", "JOB-4"} {
+		job := loadTestJob(t, id)
+		job.Status = models.StatusCompleted
+		_, err := table.Put(job)
+		assert.NoError(t, err)
+	}
+	_, err := table.Put(&db.DDBKey{OrgID: "org1", DocID: "search#1"})
+	assert.NoError(t, err)
+
+	completed := func(id string) *models.Job {
+		job := loadTestJob(t, id)
+		job.Status = models.StatusCompleted
+		return job
+	}
+	stale := completed("JOB-3")
+	stale.Status = models.StatusOnRoute
+
+	tidb := pagedTiDB([]*db.TiDBRow{
+		{UUID: "uuid-1", Detail: detail(t, completed("JOB-1"))},
+		{UUID: "uuid-3", Detail: detail(t, stale)},
+		{UUID: "uuid-4a", Detail: detail(t, completed("JOB-4"))},
+		{UUID: "uuid-4b", Detail: detail(t, completed("JOB-4"))},
+		{UUID: "uuid-5", Detail: detail(t, completed("JOB-5"))},
+		{UUID: "uuid-x", Detail: "not a job"},
+	})
+	return table, tidb
+}
+
+func TestOrg(t *testing.T) {
+	table, tidb := newFixtures(t)
+
+	r := &Reconciler{DDB: table, TiDB: tidb, PageSize: 2}
+	report, err := r.Org(context.Background(), "org1")
+	assert.NoError(t, err)
+
+	assert.Equal(t, 4, report.Jobs)
+	assert.Equal(t, 6, report.Rows)
+	assert.Len(t, tidb.Searches(), 4, "6 rows in pages of 2 and the empty last page")
+
+	kinds := make([]string, 0)
+	for _, d := range report.Drifts {
+		kinds = append(kinds, d.Kind+" "+d.JobID+" "+strings.Join(d.UUIDs, ","))
+	}
+	assert.Equal(t, []string{
+		"duplicate JOB-4 uuid-4a,uuid-4b",
+		"extra  uuid-x",
+		"extra JOB-5 uuid-5",
+		"missing JOB-2 ",
+		"stale JOB-3 uuid-3",
+	}, kinds)
+}
+
+func TestRepair(t *testing.T) {
+	ctx := context.Background()
+	table, tidb := newFixtures(t)
+	client := &queue.MemoryClient{}
+
+	r := &Reconciler{DDB: table, TiDB: tidb, Client: client, QueueURL: syncQueueURL}
+	report, err := r.Org(ctx, "org1")
+	assert.NoError(t, err)
+
+	repaired, err := r.Repair(ctx, report.Drifts)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, repaired, "the row without a job is skipped")
+
+	// the sync replaces the rows of the jobs and deletes the rows of the removed one
+	synced := &db.RecordingTiDB{}
+	resp, err := (&pipeline.Syncer{TiDB: synced}).Handle(ctx, client.Receive(syncQueueURL))
+	assert.NoError(t, err)
+	assert.Empty(t, resp.BatchItemFailures)
+
+	puts := synced.Puts()
+	assert.Len(t, puts, 4)
+	for _, put := range puts {
+		assert.True(t, strings.HasPrefix(put[0].(string), "Delete from job_tags"), put[0])
+
+		inserts := 0
+		for _, stmt := range put {
+			if strings.HasPrefix(stmt.(string), "Insert into jobs (") {
+				inserts++
+			}
+		}
+		if strings.Contains(put[0].(string), "JOB-5") {
+			assert.Equal(t, 0, inserts)
+		} else {
+			assert.Equal(t, 1, inserts)
+		}
+	}
+}
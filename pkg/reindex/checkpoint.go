@@ -0,0 +1,96 @@
+package reindex
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"poc-ddb-tidb-search/pkg/db"
+)
+
+// Checkpoint is the progress of a reindex: per scan segment the key of the last item written to
+// TiDB. A reindex resumes after those keys, so it needs the same table and number of segments
+type Checkpoint struct {
+	Table    string     `json:"table"`
+	Segments []*Segment `json:"segments"`
+}
+
+// Segment is the progress of one scan segment, LastKey is nil until its first page is written
+type Segment struct {
+	Segment int        `json:"segment"`
+	LastKey *db.DDBKey `json:"last_key,omitempty"`
+	Done    bool       `json:"done"`
+	Items   int64      `json:"items"`
+}
+
+// newCheckpoint returns the checkpoint of a reindex which has not started
+func newCheckpoint(table string, segments int) *Checkpoint {
+	cp := &Checkpoint{Table: table, Segments: make([]*Segment, 0, segments)}
+	for i := 0; i < segments; i++ {
+		cp.Segments = append(cp.Segments, &Segment{Segment: i})
+	}
+	return cp
+}
+
+// Done reports whether every segment was scanned to its end
+func (cp *Checkpoint) Done() bool {
+	for _, s := range cp.Segments {
+		if !s.Done {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckpointStore loads the checkpoint of an earlier run and saves the progress of this one
+type CheckpointStore interface {
+	Load() (*Checkpoint, error)
+	Save(cp *Checkpoint) error
+}
+
+// CheckpointFile keeps the checkpoint in a json file, rewritten after every page
+type CheckpointFile struct {
+	Path string
+}
+
+// Load reads the checkpoint, nil if the file does not exist
+func (f *CheckpointFile) Load() (*Checkpoint, error) {
+	data, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cp := new(Checkpoint)
+	if err := json.Unmarshal(data, cp); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// Save writes the checkpoint to a temporary file first, so a killed reindex never leaves half of it
+func (f *CheckpointFile) Save(cp *Checkpoint) error {
+	data, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), filepath.Base(f.Path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.Path)
+}
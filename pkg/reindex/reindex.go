@@ -0,0 +1,247 @@
+// Package reindex rebuilds the TiDB search tables from the job table, for a new cluster or a schema
+// change the stream sync only applies to jobs written after it
+package reindex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	logger "github.com/sirupsen/logrus"
+	"golang.org/x/time/rate"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/models"
+)
+
+const defaultPageSize = 100
+
+// Reindexer scans the job table in parallel segments and upserts every page of jobs into TiDB in a
+// transaction, with the inserts of the stream sync. Limiter paces the scan requests of all segments,
+// nil for no limit. The progress is saved to Checkpoints after every page, nil to neither save nor resume
+type Reindexer struct {
+	Client      dynamodb.ScanAPIClient
+	Table       string
+	TiDB        db.DB
+	Segments    int
+	PageSize    int32
+	Limiter     *rate.Limiter
+	Checkpoints CheckpointStore
+
+	mu sync.Mutex
+	cp *Checkpoint
+}
+
+// Stats counts the items of a run, Skipped are the items which are not jobs with an org and job id
+type Stats struct {
+	Scanned int64 `json:"scanned"`
+	Indexed int64 `json:"indexed"`
+	Skipped int64 `json:"skipped"`
+}
+
+// Run reindexes the segments the checkpoint has not finished, until all are done or one fails
+func (r *Reindexer) Run(ctx context.Context) (*Stats, error) {
+	if r.Table == "" {
+		return nil, errors.New("no table specified")
+	}
+	if r.Segments < 1 {
+		r.Segments = 1
+	}
+	if r.PageSize < 1 {
+		r.PageSize = defaultPageSize
+	}
+
+	if err := r.loadCheckpoint(); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stats := new(Stats)
+	errs := make(chan error, r.Segments)
+	var wg sync.WaitGroup
+
+	for _, seg := range r.cp.Segments {
+		if seg.Done {
+			continue
+		}
+
+		wg.Add(1)
+		go func(seg *Segment) {
+			defer wg.Done()
+			if err := r.scanSegment(ctx, seg, stats); err != nil {
+				errs <- fmt.Errorf("segment %d: %w", seg.Segment, err)
+				cancel()
+			}
+		}(seg)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	return stats, <-errs
+}
+
+func (r *Reindexer) loadCheckpoint() error {
+	r.cp = newCheckpoint(r.Table, r.Segments)
+	if r.Checkpoints == nil {
+		return nil
+	}
+
+	cp, err := r.Checkpoints.Load()
+	if err != nil || cp == nil {
+		return err
+	}
+
+	if cp.Table != r.Table || len(cp.Segments) != r.Segments {
+		return fmt.Errorf("checkpoint is of table %s with %d segments, remove it to reindex %s with %d segments",
+			cp.Table, len(cp.Segments), r.Table, r.Segments)
+	}
+
+	r.cp = cp
+	return nil
+}
+
+// scanSegment reads the pages of the segment after its checkpoint key
+func (r *Reindexer) scanSegment(ctx context.Context, seg *Segment, stats *Stats) error {
+	var startKey map[string]types.AttributeValue
+	if seg.LastKey != nil {
+		key, err := db.MarshalDDBItem(seg.LastKey)
+		if err != nil {
+			return err
+		}
+		startKey = key
+	}
+
+	for {
+		if r.Limiter != nil {
+			if err := r.Limiter.Wait(ctx); err != nil {
+				return err
+			}
+		}
+
+		out, err := r.Client.Scan(ctx, &dynamodb.ScanInput{
+			TableName:         aws.String(r.Table),
+			Segment:           aws.Int32(int32(seg.Segment)),
+			TotalSegments:     aws.Int32(int32(r.Segments)),
+			Limit:             aws.Int32(r.PageSize),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			logger.WithFields(logger.Fields{
+				"error":   err.Error(),
+				"code":    "DDBScanErr",
+				"segment": seg.Segment,
+			}).Error("failed to scan ddb")
+			return err
+		}
+
+		indexed, err := r.write(out.Items)
+		if err != nil {
+			logger.WithFields(logger.Fields{
+				"error":   err.Error(),
+				"code":    "TiDBErr",
+				"segment": seg.Segment,
+			}).Error("failed to write reindexed jobs")
+			return err
+		}
+
+		atomic.AddInt64(&stats.Scanned, int64(len(out.Items)))
+		atomic.AddInt64(&stats.Indexed, int64(indexed))
+		atomic.AddInt64(&stats.Skipped, int64(len(out.Items)-indexed))
+
+		if err := r.advance(seg, out.LastEvaluatedKey, len(out.Items)); err != nil {
+			return err
+		}
+		if seg.Done {
+			logger.WithFields(logger.Fields{
+				"segment": seg.Segment,
+				"items":   seg.Items,
+			}).Info("segment reindexed")
+			return nil
+		}
+		startKey = out.LastEvaluatedKey
+	}
+}
+
+// write upserts the jobs of the page in one transaction: the rows the jobs have are deleted and
+// inserted again, so a resumed or repeated reindex and jobs synced meanwhile are not duplicated
+func (r *Reindexer) write(items []map[string]types.AttributeValue) (int, error) {
+	jobIDs := make(map[string][]string)
+	inserts := make([]any, 0, len(items)*4)
+
+	for _, item := range items {
+		job := new(models.Job)
+		if err := db.UnmarshalDDBItem(item, job); err != nil || job.OrgID2 == "" || job.ID == "" {
+			fields := logger.Fields{"orgID": job.OrgID2, "docID": job.DocID, "code": "ReindexSkip"}
+			if err != nil {
+				fields["error"] = err.Error()
+			}
+			logger.WithFields(fields).Warn("skipping item which is not a job")
+			continue
+		}
+
+		stmts, err := db.MakeInsertJobSQLStatements(job, uuid.New().String())
+		if err != nil {
+			return 0, err
+		}
+
+		jobIDs[job.OrgID2] = append(jobIDs[job.OrgID2], job.ID)
+		for _, stmt := range stmts {
+			inserts = append(inserts, stmt)
+		}
+	}
+
+	if len(inserts) == 0 {
+		return 0, nil
+	}
+
+	stmts := make([]any, 0, len(inserts)+7)
+	for _, stmt := range db.MakeDeleteJobsSQLStatements(jobIDs) {
+		stmts = append(stmts, stmt)
+	}
+	stmts = append(stmts, inserts...)
+
+	if _, err := r.TiDB.Put(stmts...); err != nil {
+		return 0, err
+	}
+
+	indexed := 0
+	for _, ids := range jobIDs {
+		indexed += len(ids)
+	}
+	return indexed, nil
+}
+
+// advance moves the segment past the written page and saves the checkpoint, the segment is done
+// when the scan returns no last key
+func (r *Reindexer) advance(seg *Segment, lastKey map[string]types.AttributeValue, items int) error {
+	var key *db.DDBKey
+	if len(lastKey) > 0 {
+		key = new(db.DDBKey)
+		if err := db.UnmarshalDDBItem(lastKey, key); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seg.Items += int64(items)
+	seg.Done = key == nil
+	if key != nil {
+		seg.LastKey = key
+	}
+
+	if r.Checkpoints == nil {
+		return nil
+	}
+	return r.Checkpoints.Save(r.cp)
+}
@@ -0,0 +1,219 @@
+package reindex
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/models"
+)
+
+// fakeScan serves the items like a parallel scan, item i is in segment i modulo the total segments.
+// A full page has a last key, so the segment ends with an empty page like dynamodb's may
+type fakeScan struct {
+	items []map[string]types.AttributeValue
+	fail  func(in *dynamodb.ScanInput) error
+
+	mu     sync.Mutex
+	inputs []*dynamodb.ScanInput
+}
+
+func (f *fakeScan) Scan(ctx context.Context, in *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	f.mu.Lock()
+	f.inputs = append(f.inputs, in)
+	f.mu.Unlock()
+
+	if f.fail != nil {
+		if err := f.fail(in); err != nil {
+			return nil, err
+		}
+	}
+
+	segment := make([]map[string]types.AttributeValue, 0)
+	for i, item := range f.items {
+		if i%int(*in.TotalSegments) == int(*in.Segment) {
+			segment = append(segment, item)
+		}
+	}
+
+	start := 0
+	if in.ExclusiveStartKey != nil {
+		after := key(in.ExclusiveStartKey)
+		for i, item := range segment {
+			if key(item) == after {
+				start = i + 1
+			}
+		}
+	}
+
+	end := start + int(*in.Limit)
+	if end > len(segment) {
+		end = len(segment)
+	}
+
+	out := &dynamodb.ScanOutput{Items: segment[start:end]}
+	if end-start == int(*in.Limit) {
+		last := key(segment[end-1])
+		out.LastEvaluatedKey, _ = db.MarshalDDBItem(&last)
+	}
+	return out, nil
+}
+
+func key(item map[string]types.AttributeValue) db.DDBKey {
+	k := db.DDBKey{}
+	_ = db.UnmarshalDDBItem(item, &k)
+	return k
+}
+
+// newFakeScan returns 25 jobs of two orgs and a saved search like item without a job id
+func newFakeScan(t *testing.T) *fakeScan {
+	payload, err := os.ReadFile("../../testData/job.json")
+	assert.NoError(t, err)
+
+	f := new(fakeScan)
+	for i := 0; i < 25; i++ {
+		job := new(models.Job)
+		assert.NoError(t, json.Unmarshal(payload, job))
+		job.OrgID2 = fmt.Sprintf("org%d", i%2+1)
+		job.ID = fmt.Sprintf("JOB-%02d", i)
+		job.DocID = job.ID
+
+		item, err := db.MarshalDDBItem(job)
+		assert.NoError(t, err)
+		f.items = append(f.items, item)
+	}
+
+	item, err := db.MarshalDDBItem(&db.DDBKey{OrgID: "org1", DocID: "search#1"})
+	assert.NoError(t, err)
+	f.items = append(f.items, item)
+
+	return f
+}
+
+// insertedJobs returns the job ids of the jobs inserts, in order
+func insertedJobs(tidb *db.RecordingTiDB) []string {
+	ids := make([]string, 0)
+	for _, put := range tidb.Puts() {
+		for _, stmt := range put {
+			if s := stmt.(string); strings.HasPrefix(s, "Insert into jobs (") {
+				ids = append(ids, strings.Split(s, `","`)[3])
+			}
+		}
+	}
+	return ids
+}
+
+func TestRun(t *testing.T) {
+	scan := newFakeScan(t)
+	tidb := &db.RecordingTiDB{}
+	checkpoints := &CheckpointFile{Path: filepath.Join(t.TempDir(), "reindex.json")}
+
+	r := &Reindexer{Client: scan, Table: "jobs", TiDB: tidb, Segments: 3, PageSize: 4,
+		Limiter: rate.NewLimiter(rate.Inf, 1), Checkpoints: checkpoints}
+	stats, err := r.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, &Stats{Scanned: 26, Indexed: 25, Skipped: 1}, stats)
+	assert.Len(t, insertedJobs(tidb), 25)
+
+	// every page is a transaction deleting the rows of its jobs first
+	for _, put := range tidb.Puts() {
+		assert.True(t, strings.HasPrefix(put[0].(string), "Delete from job_tags"), put[0])
+	}
+
+	cp, err := checkpoints.Load()
+	assert.NoError(t, err)
+	assert.True(t, cp.Done())
+	items := int64(0)
+	for _, seg := range cp.Segments {
+		items += seg.Items
+	}
+	assert.Equal(t, int64(26), items)
+
+	// a finished checkpoint scans nothing again
+	scans := len(scan.inputs)
+	stats, err = r.Run(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, &Stats{}, stats)
+	assert.Len(t, scan.inputs, scans)
+}
+
+func TestRunResume(t *testing.T) {
+	scan := newFakeScan(t)
+	tidb := &db.RecordingTiDB{}
+	checkpoints := &CheckpointFile{Path: filepath.Join(t.TempDir(), "reindex.json")}
+
+	// segment 1 fails on its second page
+	scan.fail = func(in *dynamodb.ScanInput) error {
+		if *in.Segment == 1 && in.ExclusiveStartKey != nil {
+			return errors.New("throttled")
+		}
+		return nil
+	}
+
+	r := &Reindexer{Client: scan, Table: "jobs", TiDB: tidb, Segments: 2, PageSize: 5, Checkpoints: checkpoints}
+	_, err := r.Run(context.Background())
+	assert.ErrorContains(t, err, "segment 1: throttled")
+
+	cp, err := checkpoints.Load()
+	assert.NoError(t, err)
+	assert.False(t, cp.Done())
+	assert.Equal(t, &db.DDBKey{OrgID: "org2", DocID: "JOB-09"}, cp.Segments[1].LastKey)
+
+	scan.fail = nil
+	scan.inputs = nil
+	r = &Reindexer{Client: scan, Table: "jobs", TiDB: tidb, Segments: 2, PageSize: 5, Checkpoints: checkpoints}
+	_, err = r.Run(context.Background())
+	assert.NoError(t, err)
+
+	// segment 1 resumed after its first page, no job was inserted twice
+	for _, in := range scan.inputs {
+		if *in.Segment == 1 {
+			assert.NotNil(t, in.ExclusiveStartKey)
+		}
+	}
+	assert.ElementsMatch(t, func() []string {
+		ids := make([]string, 0, 25)
+		for i := 0; i < 25; i++ {
+			ids = append(ids, fmt.Sprintf("JOB-%02d", i))
+		}
+		return ids
+	}(), insertedJobs(tidb))
+
+	cp, err = checkpoints.Load()
+	assert.NoError(t, err)
+	assert.True(t, cp.Done())
+}
+
+func TestRunCheckpointMismatch(t *testing.T) {
+	checkpoints := &CheckpointFile{Path: filepath.Join(t.TempDir(), "reindex.json")}
+	assert.NoError(t, checkpoints.Save(newCheckpoint("jobs", 4)))
+
+	r := &Reindexer{Client: newFakeScan(t), Table: "jobs", TiDB: &db.RecordingTiDB{}, Segments: 2, Checkpoints: checkpoints}
+	_, err := r.Run(context.Background())
+	assert.ErrorContains(t, err, "with 4 segments")
+}
+
+func TestRunTiDBError(t *testing.T) {
+	checkpoints := &CheckpointFile{Path: filepath.Join(t.TempDir(), "reindex.json")}
+	r := &Reindexer{Client: newFakeScan(t), Table: "jobs", TiDB: &db.RecordingTiDB{PutErr: errors.New("down")}, Checkpoints: checkpoints}
+
+	_, err := r.Run(context.Background())
+	assert.ErrorContains(t, err, "down")
+
+	// the failed page is not checkpointed
+	cp, err := checkpoints.Load()
+	assert.NoError(t, err)
+	assert.Nil(t, cp)
+}
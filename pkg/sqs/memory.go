@@ -0,0 +1,198 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// MemoryClient records the sent messages instead of sending them, for tests and local runs.
+// SendErr makes every send fail. ReceiveMessage and the delete and visibility calls use the recorded
+// messages like sqs does, a received message is hidden for the visibility timeout until it is deleted
+type MemoryClient struct {
+	SendErr error
+
+	mu       sync.Mutex
+	messages []*sentMessage
+	sent     int
+	received int
+}
+
+type sentMessage struct {
+	id    string
+	input *sqs.SendMessageInput
+
+	sentAt    time.Time
+	receipt   string
+	visibleAt time.Time
+	receives  int
+}
+
+func (mc *MemoryClient) SendMessage(ctx context.Context, in *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	if mc.SendErr != nil {
+		return nil, mc.SendErr
+	}
+
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	mc.sent++
+	id := strconv.Itoa(mc.sent)
+	mc.messages = append(mc.messages, &sentMessage{id: id, input: in, sentAt: time.Now()})
+	return &sqs.SendMessageOutput{MessageId: aws.String(id)}, nil
+}
+
+// Messages returns the recorded messages in the order they were sent
+func (mc *MemoryClient) Messages() []*sqs.SendMessageInput {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	out := make([]*sqs.SendMessageInput, 0, len(mc.messages))
+	for _, m := range mc.messages {
+		out = append(out, m.input)
+	}
+	return out
+}
+
+// ReceiveMessage returns the visible messages of the queue, at most MaxNumberOfMessages, 1 if it is
+// not set. Waiting for messages is not simulated
+func (mc *MemoryClient) ReceiveMessage(ctx context.Context, in *sqs.ReceiveMessageInput, _ ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	max := int(in.MaxNumberOfMessages)
+	if max < 1 {
+		max = 1
+	}
+	visibility := 30 * time.Second
+	if in.VisibilityTimeout > 0 {
+		visibility = time.Duration(in.VisibilityTimeout) * time.Second
+	}
+
+	now := time.Now()
+	out := &sqs.ReceiveMessageOutput{Messages: make([]types.Message, 0)}
+	for _, m := range mc.messages {
+		if len(out.Messages) == max {
+			break
+		}
+		if aws.ToString(m.input.QueueUrl) != aws.ToString(in.QueueUrl) || now.Before(m.visibleAt) {
+			continue
+		}
+
+		mc.received++
+		m.receipt = m.id + "#" + strconv.Itoa(mc.received)
+		m.visibleAt = now.Add(visibility)
+		m.receives++
+		out.Messages = append(out.Messages, m.message())
+	}
+
+	return out, nil
+}
+
+// DeleteMessage removes the message of the receipt handle of its last receive
+func (mc *MemoryClient) DeleteMessage(ctx context.Context, in *sqs.DeleteMessageInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	for i, m := range mc.messages {
+		if aws.ToString(m.input.QueueUrl) == aws.ToString(in.QueueUrl) && m.receipt != "" && m.receipt == aws.ToString(in.ReceiptHandle) {
+			mc.messages = append(mc.messages[:i], mc.messages[i+1:]...)
+			return &sqs.DeleteMessageOutput{}, nil
+		}
+	}
+
+	return nil, errors.New("receipt handle is invalid")
+}
+
+// DeleteMessageBatch deletes every entry like DeleteMessage, the invalid handles are the failed entries
+func (mc *MemoryClient) DeleteMessageBatch(ctx context.Context, in *sqs.DeleteMessageBatchInput, _ ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error) {
+	out := &sqs.DeleteMessageBatchOutput{}
+	for _, e := range in.Entries {
+		_, err := mc.DeleteMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: in.QueueUrl, ReceiptHandle: e.ReceiptHandle})
+		if err != nil {
+			out.Failed = append(out.Failed, types.BatchResultErrorEntry{Id: e.Id, Code: aws.String("ReceiptHandleIsInvalid"), Message: aws.String(err.Error()), SenderFault: true})
+			continue
+		}
+		out.Successful = append(out.Successful, types.DeleteMessageBatchResultEntry{Id: e.Id})
+	}
+	return out, nil
+}
+
+// ChangeMessageVisibility hides the message of the receipt handle for the timeout from now, 0 makes it visible
+func (mc *MemoryClient) ChangeMessageVisibility(ctx context.Context, in *sqs.ChangeMessageVisibilityInput, _ ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	for _, m := range mc.messages {
+		if aws.ToString(m.input.QueueUrl) == aws.ToString(in.QueueUrl) && m.receipt != "" && m.receipt == aws.ToString(in.ReceiptHandle) {
+			m.visibleAt = time.Now().Add(time.Duration(in.VisibilityTimeout) * time.Second)
+			return &sqs.ChangeMessageVisibilityOutput{}, nil
+		}
+	}
+
+	return nil, errors.New("receipt handle is invalid")
+}
+
+func (m *sentMessage) message() types.Message {
+	msg := types.Message{
+		MessageId:         aws.String(m.id),
+		ReceiptHandle:     aws.String(m.receipt),
+		Body:              m.input.MessageBody,
+		MessageAttributes: make(map[string]types.MessageAttributeValue, len(m.input.MessageAttributes)),
+		Attributes: map[string]string{
+			"ApproximateReceiveCount": strconv.Itoa(m.receives),
+			"SentTimestamp":           strconv.FormatInt(m.sentAt.UnixMilli(), 10),
+		},
+	}
+	if m.input.MessageGroupId != nil {
+		msg.Attributes["MessageGroupId"] = *m.input.MessageGroupId
+	}
+	for k, v := range m.input.MessageAttributes {
+		msg.MessageAttributes[k] = v
+	}
+	return msg
+}
+
+// Receive removes the recorded messages of the queue and returns them as the lambda sqs event
+func (mc *MemoryClient) Receive(queueURL string) events.SQSEvent {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	event := events.SQSEvent{Records: make([]events.SQSMessage, 0)}
+	kept := mc.messages[:0]
+	for _, m := range mc.messages {
+		if aws.ToString(m.input.QueueUrl) != queueURL {
+			kept = append(kept, m)
+			continue
+		}
+		event.Records = append(event.Records, ToSQSMessage(m.id, m.input))
+	}
+	mc.messages = kept
+
+	return event
+}
+
+// ToSQSMessage returns a sent message as the lambda sqs event receives it
+func ToSQSMessage(id string, in *sqs.SendMessageInput) events.SQSMessage {
+	msg := events.SQSMessage{
+		MessageId:         id,
+		Body:              aws.ToString(in.MessageBody),
+		EventSource:       "aws:sqs",
+		EventSourceARN:    aws.ToString(in.QueueUrl),
+		Attributes:        make(map[string]string),
+		MessageAttributes: make(map[string]events.SQSMessageAttribute),
+	}
+	if in.MessageGroupId != nil {
+		msg.Attributes["MessageGroupId"] = *in.MessageGroupId
+	}
+	for k, v := range in.MessageAttributes {
+		msg.MessageAttributes[k] = events.SQSMessageAttribute{DataType: aws.ToString(v.DataType), StringValue: v.StringValue}
+	}
+	return msg
+}
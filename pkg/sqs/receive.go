@@ -0,0 +1,177 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// the limits sqs puts on receives and visibility timeouts
+const (
+	MaxReceiveMessages = 10
+	MaxWaitTime        = 20 * time.Second
+	MaxVisibility      = 12 * time.Hour
+	maxDeleteBatch     = 10
+)
+
+type ReceiveClient interface {
+	ReceiveMessage(context.Context, *sqs.ReceiveMessageInput, ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+}
+
+type DeleteClient interface {
+	DeleteMessage(context.Context, *sqs.DeleteMessageInput, ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	DeleteMessageBatch(context.Context, *sqs.DeleteMessageBatchInput, ...func(*sqs.Options)) (*sqs.DeleteMessageBatchOutput, error)
+}
+
+type ChangeVisibilityClient interface {
+	ChangeMessageVisibility(context.Context, *sqs.ChangeMessageVisibilityInput, ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+}
+
+// ReceiveInput reads up to MaxMessages messages, waiting WaitTime for one to arrive (long polling)
+// and hiding them for Visibility, the visibility timeout of the queue when 0
+type ReceiveInput struct {
+	QueueURL    string
+	MaxMessages int32
+	WaitTime    time.Duration
+	Visibility  time.Duration
+}
+
+// NewReceiveInput long polls for a full batch of messages
+func NewReceiveInput(queueURL string) *ReceiveInput {
+	return &ReceiveInput{
+		QueueURL:    queueURL,
+		MaxMessages: MaxReceiveMessages,
+		WaitTime:    MaxWaitTime,
+	}
+}
+
+func (ri *ReceiveInput) Validate() error {
+	errors := make([]string, 0)
+	if len(ri.QueueURL) == 0 {
+		errors = append(errors, "missing queue url")
+	}
+
+	if ri.MaxMessages < 1 || ri.MaxMessages > MaxReceiveMessages {
+		errors = append(errors, fmt.Sprintf("max messages must be between 1 and %d", MaxReceiveMessages))
+	}
+
+	if ri.WaitTime < 0 || ri.WaitTime > MaxWaitTime || ri.WaitTime%time.Second != 0 {
+		errors = append(errors, "wait time must be whole seconds up to 20s")
+	}
+
+	if err := validateVisibility(ri.Visibility); err != "" {
+		errors = append(errors, err)
+	}
+
+	if len(errors) == 0 {
+		return nil
+	}
+
+	return &SQSError{
+		Message: "validation of sqs receive failed",
+		Faults:  errors,
+	}
+}
+
+func validateVisibility(visibility time.Duration) string {
+	if visibility < 0 || visibility > MaxVisibility || visibility%time.Second != 0 {
+		return "visibility timeout must be whole seconds up to 12h"
+	}
+	return ""
+}
+
+// Receive returns the received messages with their attributes, none when the wait time passed
+// without a message
+func Receive(ctx context.Context, client ReceiveClient, input *ReceiveInput) ([]types.Message, error) {
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+
+	output, err := client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:              aws.String(input.QueueURL),
+		MaxNumberOfMessages:   input.MaxMessages,
+		WaitTimeSeconds:       int32(input.WaitTime / time.Second),
+		VisibilityTimeout:     int32(input.Visibility / time.Second),
+		AttributeNames:        []types.QueueAttributeName{types.QueueAttributeNameAll},
+		MessageAttributeNames: []string{"All"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return output.Messages, nil
+}
+
+// ExtendVisibility hides a received message for another timeout from now, so a slow consumer keeps it
+func ExtendVisibility(ctx context.Context, client ChangeVisibilityClient, queueURL, receiptHandle string, timeout time.Duration) error {
+	errors := make([]string, 0)
+	if len(queueURL) == 0 {
+		errors = append(errors, "missing queue url")
+	}
+	if len(receiptHandle) == 0 {
+		errors = append(errors, "missing receipt handle")
+	}
+	if err := validateVisibility(timeout); err != "" {
+		errors = append(errors, err)
+	}
+	if len(errors) > 0 {
+		return &SQSError{
+			Message: "validation of sqs visibility change failed",
+			Faults:  errors,
+		}
+	}
+
+	_, err := client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(queueURL),
+		ReceiptHandle:     aws.String(receiptHandle),
+		VisibilityTimeout: int32(timeout / time.Second),
+	})
+	return err
+}
+
+// DeleteBatch deletes the received messages in batches of 10, the handles which failed are the
+// faults of the returned error
+func DeleteBatch(ctx context.Context, client DeleteClient, queueURL string, receiptHandles []string) error {
+	if len(queueURL) == 0 {
+		return &SQSError{Message: "validation of sqs delete failed", Faults: []string{"missing queue url"}}
+	}
+
+	faults := make([]string, 0)
+	for start := 0; start < len(receiptHandles); start += maxDeleteBatch {
+		end := start + maxDeleteBatch
+		if end > len(receiptHandles) {
+			end = len(receiptHandles)
+		}
+
+		entries := make([]types.DeleteMessageBatchRequestEntry, 0, end-start)
+		for i := start; i < end; i++ {
+			entries = append(entries, types.DeleteMessageBatchRequestEntry{
+				Id:            aws.String(strconv.Itoa(i)),
+				ReceiptHandle: aws.String(receiptHandles[i]),
+			})
+		}
+
+		output, err := client.DeleteMessageBatch(ctx, &sqs.DeleteMessageBatchInput{QueueUrl: aws.String(queueURL), Entries: entries})
+		if err != nil {
+			return err
+		}
+		for _, f := range output.Failed {
+			i, _ := strconv.Atoi(aws.ToString(f.Id))
+			faults = append(faults, fmt.Sprintf("%s: %s", receiptHandles[i], aws.ToString(f.Message)))
+		}
+	}
+
+	if len(faults) == 0 {
+		return nil
+	}
+
+	return &SQSError{
+		Message: fmt.Sprintf("%d of %d sqs messages not deleted", len(faults), len(receiptHandles)),
+		Faults:  faults,
+	}
+}
@@ -0,0 +1,96 @@
+package queue
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnqueueToMemoryClient(t *testing.T) {
+	client := &MemoryClient{}
+
+	input := NewQueueInput("https://sqs.local/sync.fifo", `{"id":"job1"}`)
+	input.SetMessageAttributes("recordType", "insert")
+	_, err := Enqueue(context.Background(), client, input)
+	assert.Error(t, err, "fifo queues need a message group")
+	assert.Empty(t, client.Messages())
+
+	input.SetMessageGroupID("org1")
+	out, err := Enqueue(context.Background(), client, input)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", *out.MessageID)
+
+	other := NewQueueInput("https://sqs.local/other", "other")
+	_, err = Enqueue(context.Background(), client, other)
+	assert.NoError(t, err)
+	assert.Len(t, client.Messages(), 2)
+
+	event := client.Receive("https://sqs.local/sync.fifo")
+	assert.Len(t, event.Records, 1)
+	assert.Equal(t, "1", event.Records[0].MessageId)
+	assert.Equal(t, `{"id":"job1"}`, event.Records[0].Body)
+	assert.Equal(t, "org1", event.Records[0].Attributes["MessageGroupId"])
+	assert.Equal(t, "insert", *event.Records[0].MessageAttributes["recordType"].StringValue)
+
+	assert.Len(t, client.Messages(), 1, "messages of other queues are kept")
+	assert.Empty(t, client.Receive("https://sqs.local/sync.fifo").Records)
+}
+
+func TestReceiveInputValidate(t *testing.T) {
+	assert.NoError(t, NewReceiveInput("https://sqs.local/sync.fifo").Validate())
+
+	input := &ReceiveInput{MaxMessages: 11, WaitTime: 1500 * time.Millisecond, Visibility: 13 * time.Hour}
+	err := input.Validate()
+	assert.Error(t, err)
+
+	sqsErr := new(SQSError)
+	assert.ErrorAs(t, err, &sqsErr)
+	assert.Len(t, sqsErr.Faults, 4)
+
+	_, err = Receive(context.Background(), &MemoryClient{}, input)
+	assert.Error(t, err)
+}
+
+func TestReceiveExtendAndDelete(t *testing.T) {
+	ctx := context.Background()
+	client := &MemoryClient{}
+	queueURL := "https://sqs.local/worker"
+	for i := 0; i < 12; i++ {
+		_, err := Enqueue(ctx, client, NewQueueInput(queueURL, "job"+strconv.Itoa(i)))
+		assert.NoError(t, err)
+	}
+
+	input := NewReceiveInput(queueURL)
+	input.Visibility = time.Minute
+	first, err := Receive(ctx, client, input)
+	assert.NoError(t, err)
+	assert.Len(t, first, 10)
+	assert.Equal(t, "1", first[0].Attributes["ApproximateReceiveCount"])
+
+	second, err := Receive(ctx, client, input)
+	assert.NoError(t, err)
+	assert.Len(t, second, 2, "the first batch is hidden")
+
+	// a visibility of 0 hands the message to the next receive
+	assert.NoError(t, ExtendVisibility(ctx, client, queueURL, *second[0].ReceiptHandle, 0))
+	again, err := Receive(ctx, client, input)
+	assert.NoError(t, err)
+	assert.Len(t, again, 1)
+	assert.Equal(t, "2", again[0].Attributes["ApproximateReceiveCount"])
+	assert.Error(t, ExtendVisibility(ctx, client, queueURL, *second[0].ReceiptHandle, time.Minute), "the handle of the older receive")
+	assert.Error(t, ExtendVisibility(ctx, client, queueURL, "", time.Minute))
+
+	handles := []string{*second[1].ReceiptHandle, *again[0].ReceiptHandle, "bogus"}
+	for _, m := range first {
+		handles = append(handles, *m.ReceiptHandle)
+	}
+	err = DeleteBatch(ctx, client, queueURL, handles)
+	sqsErr := new(SQSError)
+	assert.ErrorAs(t, err, &sqsErr)
+	assert.Equal(t, "1 of 13 sqs messages not deleted", sqsErr.Message)
+	assert.Len(t, sqsErr.Faults, 1)
+	assert.Empty(t, client.Messages())
+}
@@ -0,0 +1,142 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"poc-ddb-tidb-search/pkg/db"
+	"poc-ddb-tidb-search/pkg/models"
+	queue "poc-ddb-tidb-search/pkg/sqs"
+	"poc-ddb-tidb-search/pkg/webhook"
+)
+
+// Notification tells a saved search owner that a synced job matches the search
+type Notification struct {
+	OrgID         string `json:"org_id"`
+	UserID        string `json:"user_id"`
+	SavedSearchID string `json:"saved_search_id"`
+	Name          string `json:"name"`
+	Event         string `json:"event"`
+	UUID          string `json:"uuid"`
+	JobID         string `json:"job_id"`
+	ShipmentID    string `json:"shipment_id"`
+	Status        string `json:"status"`
+}
+
+// Sink publishes notifications
+type Sink interface {
+	Publish(context.Context, *Notification) error
+}
+
+// SQSSink sends notifications to a queue, fifo queues are grouped by org
+type SQSSink struct {
+	Client   queue.SendMessageClient
+	QueueURL string
+}
+
+func (s *SQSSink) Publish(ctx context.Context, n *Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	input := queue.NewQueueInput(s.QueueURL, string(body))
+	input.SetMessageAttributes("orgID", n.OrgID)
+	input.SetMessageAttributes("savedSearchID", n.SavedSearchID)
+	if strings.HasSuffix(s.QueueURL, ".fifo") {
+		input.SetMessageGroupID(n.OrgID)
+	}
+
+	_, err = queue.Enqueue(ctx, s.Client, input)
+	return err
+}
+
+// WebhookSink queues notifications as search.matched events for the webhook dispatcher, which
+// signs and posts them to the org endpoints subscribed to the event
+type WebhookSink struct {
+	Client   queue.SendMessageClient
+	QueueURL string
+	Now      func() time.Time
+}
+
+func (s *WebhookSink) Publish(ctx context.Context, n *Notification) error {
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+
+	ev := &webhook.Event{
+		ID:         uuid.New().String(),
+		Type:       webhook.EventSearchMatched,
+		OrgID:      n.OrgID,
+		OccurredAt: now().UTC(),
+		JobID:      n.JobID,
+		Search: &webhook.SearchMatch{
+			SavedSearchID: n.SavedSearchID,
+			UserID:        n.UserID,
+			Name:          n.Name,
+			Event:         n.Event,
+			ShipmentID:    n.ShipmentID,
+			Status:        n.Status,
+		},
+	}
+
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	input := queue.NewQueueInput(s.QueueURL, string(body))
+	input.SetMessageAttributes("eventType", ev.Type)
+	input.SetMessageAttributes("orgID", n.OrgID)
+
+	_, err = queue.Enqueue(ctx, s.Client, input)
+	return err
+}
+
+// Match runs the watched searches restricted to the synced job and returns a notification per match
+func Match(tiDB db.DB, searches []*db.SavedSearch, event, uuid string, job *models.Job) ([]*Notification, error) {
+	matches := make([]*Notification, 0)
+	if len(searches) == 0 {
+		return matches, nil
+	}
+
+	res, err := tiDB.Search(db.MakeWatchMatchSQLStatement(searches, uuid))
+	if err != nil {
+		return nil, err
+	}
+	r, ok := res.(*db.TiDBResult)
+	if !ok {
+		return matches, nil
+	}
+
+	matched := make(map[string]bool, len(r.Details))
+	for _, row := range r.Details {
+		matched[row.UUID] = true
+	}
+
+	for i, s := range searches {
+		if !matched[strconv.Itoa(i)] {
+			continue
+		}
+
+		matches = append(matches, &Notification{
+			OrgID:         s.OrgID,
+			UserID:        s.UserID,
+			SavedSearchID: s.ID,
+			Name:          s.Name,
+			Event:         event,
+			UUID:          uuid,
+			JobID:         job.ID,
+			ShipmentID:    job.RefShipmentID,
+			Status:        string(job.Status),
+		})
+	}
+
+	return matches, nil
+}
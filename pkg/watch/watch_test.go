@@ -0,0 +1,59 @@
+package watch
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+
+	"poc-ddb-tidb-search/pkg/webhook"
+)
+
+type fakeSendClient struct {
+	inputs []*sqs.SendMessageInput
+}
+
+func (f *fakeSendClient) SendMessage(ctx context.Context, in *sqs.SendMessageInput, _ ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	f.inputs = append(f.inputs, in)
+	return &sqs.SendMessageOutput{MessageId: aws.String("1")}, nil
+}
+
+var notification = &Notification{OrgID: "org1", SavedSearchID: "s1", Name: "failed north", Event: "insert", UUID: "u1", Status: "failed"}
+
+func TestSQSSink(t *testing.T) {
+	client := &fakeSendClient{}
+
+	sink := &SQSSink{Client: client, QueueURL: "https://sqs.local/watch.fifo"}
+	assert.NoError(t, sink.Publish(context.Background(), notification))
+
+	assert.Len(t, client.inputs, 1)
+	assert.Equal(t, "org1", *client.inputs[0].MessageGroupId)
+	assert.Equal(t, "s1", *client.inputs[0].MessageAttributes["savedSearchID"].StringValue)
+
+	var got Notification
+	assert.NoError(t, json.Unmarshal([]byte(*client.inputs[0].MessageBody), &got))
+	assert.Equal(t, *notification, got)
+}
+
+func TestWebhookSink(t *testing.T) {
+	client := &fakeSendClient{}
+	now := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+
+	sink := &WebhookSink{Client: client, QueueURL: "https://sqs.local/webhooks", Now: func() time.Time { return now }}
+	assert.NoError(t, sink.Publish(context.Background(), notification))
+
+	assert.Len(t, client.inputs, 1)
+	assert.Equal(t, webhook.EventSearchMatched, *client.inputs[0].MessageAttributes["eventType"].StringValue)
+
+	var got webhook.Event
+	assert.NoError(t, json.Unmarshal([]byte(*client.inputs[0].MessageBody), &got))
+	assert.NotEmpty(t, got.ID)
+	assert.Equal(t, webhook.EventSearchMatched, got.Type)
+	assert.Equal(t, "org1", got.OrgID)
+	assert.Equal(t, now, got.OccurredAt)
+	assert.Equal(t, &webhook.SearchMatch{SavedSearchID: "s1", Name: "failed north", Event: "insert", Status: "failed"}, got.Search)
+}
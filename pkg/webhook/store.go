@@ -0,0 +1,95 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"poc-ddb-tidb-search/pkg/db"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	endpointPrefix   = "endpoint#"
+	deadLetterPrefix = "deadletter#"
+)
+
+var ErrEndpointNotFound = errors.New("webhook endpoint not found")
+
+// DDBStore keeps the endpoints and dead letters of an org in the webhooks table, the table must be set
+type DDBStore struct {
+	DB db.DB
+}
+
+func (s *DDBStore) PutEndpoint(ctx context.Context, ep *Endpoint) error {
+	ep.DocID = endpointPrefix + ep.ID
+	_, err := s.DB.Put(ep)
+	return err
+}
+
+func (s *DDBStore) DeleteEndpoint(ctx context.Context, orgID, id string) error {
+	item, err := s.DB.Get(&db.DDBKey{OrgID: orgID, DocID: endpointPrefix + id})
+	if err != nil {
+		return err
+	}
+	if av, _ := item.(map[string]types.AttributeValue); av == nil {
+		return ErrEndpointNotFound
+	}
+
+	return s.DB.Delete(&db.DDBKey{OrgID: orgID, DocID: endpointPrefix + id})
+}
+
+func (s *DDBStore) Endpoints(ctx context.Context, orgID string) ([]*Endpoint, error) {
+	list := make([]*Endpoint, 0)
+	err := s.query(orgID, endpointPrefix, func() any {
+		ep := new(Endpoint)
+		list = append(list, ep)
+		return ep
+	})
+	return list, err
+}
+
+// PutDeadLetter keys the dead letters by failure time so they list oldest first
+func (s *DDBStore) PutDeadLetter(ctx context.Context, dl *DeadLetter) error {
+	dl.DocID = deadLetterPrefix + dl.FailedAt.UTC().Format("20060102T150405.000") + "#" + dl.ID
+	_, err := s.DB.Put(dl)
+	return err
+}
+
+func (s *DDBStore) DeadLetters(ctx context.Context, orgID string) ([]*DeadLetter, error) {
+	list := make([]*DeadLetter, 0)
+	err := s.query(orgID, deadLetterPrefix, func() any {
+		dl := new(DeadLetter)
+		list = append(list, dl)
+		return dl
+	})
+	return list, err
+}
+
+// query decodes each item of the org docID prefix into a new value from next
+func (s *DDBStore) query(orgID, prefix string, next func() any) error {
+	res, err := s.DB.Search(&db.DDBQuery{OrgID: orgID, DocIDPrefix: prefix})
+	if err != nil {
+		return err
+	}
+
+	items, _ := res.([]map[string]types.AttributeValue)
+	for _, item := range items {
+		if err := db.UnmarshalDDBItem(item, next()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidEventTypes checks the subscribed event types
+func ValidEventTypes(eventTypes []string) error {
+	all := &Endpoint{Events: EventTypes}
+	for _, t := range eventTypes {
+		if !all.Subscribed(t) {
+			return errors.New("unsupported event type " + t + ", must be one of " + strings.Join(EventTypes, ", "))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"poc-ddb-tidb-search/pkg/models"
+)
+
+const (
+	EventJobCreated       = "job.created"
+	EventJobUpdated       = "job.updated"
+	EventJobStatusChanged = "job.status_changed"
+	EventJobDeleted       = "job.deleted"
+	EventSearchMatched    = "search.matched"
+)
+
+// EventTypes are the job lifecycle and watched search events an endpoint can subscribe to
+var EventTypes = []string{EventJobCreated, EventJobUpdated, EventJobStatusChanged, EventJobDeleted, EventSearchMatched}
+
+const (
+	SignatureHeader = "X-Webhook-Signature" // t=<unix seconds>,v1=<hex hmac sha256 of "<t>.<body>">
+	EventTypeHeader = "X-Webhook-Event"
+	EventIDHeader   = "X-Webhook-Id"
+)
+
+// Event is the payload posted to the endpoints, the id is stable across retries
+type Event struct {
+	ID            string       `json:"id"`
+	Type          string       `json:"type"`
+	OrgID         string       `json:"org_id"`
+	OccurredAt    time.Time    `json:"occurred_at"`
+	JobID         string       `json:"job_id"`
+	ChangedFields []string     `json:"changed_fields,omitempty"` // json paths of the job fields changed by an update
+	Job           *models.Job  `json:"job,omitempty"`
+	Search        *SearchMatch `json:"search,omitempty"`
+}
+
+// SearchMatch is the watched saved search of a search.matched event and the state of the job
+// matching it
+type SearchMatch struct {
+	SavedSearchID string `json:"saved_search_id"`
+	UserID        string `json:"user_id"`
+	Name          string `json:"name"`
+	Event         string `json:"event"` // the synced record type, insert or modify
+	ShipmentID    string `json:"shipment_id"`
+	Status        string `json:"status"`
+}
+
+// Endpoint is an org's registered receiver, no Events means all of them
+type Endpoint struct {
+	OrgID     string    `json:"orgID"`
+	DocID     string    `json:"docID"`
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (e *Endpoint) Subscribed(eventType string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, t := range e.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// DeadLetter keeps an event that could not be delivered to an endpoint after all attempts
+type DeadLetter struct {
+	OrgID      string    `json:"orgID"`
+	DocID      string    `json:"docID"`
+	ID         string    `json:"id"`
+	EndpointID string    `json:"endpoint_id"`
+	URL        string    `json:"url"`
+	Event      *Event    `json:"event"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"status_code,omitempty"`
+	LastError  string    `json:"last_error"`
+	FailedAt   time.Time `json:"failed_at"`
+}
+
+// Store reads the org endpoints and keeps the dead letters
+type Store interface {
+	Endpoints(ctx context.Context, orgID string) ([]*Endpoint, error)
+	PutDeadLetter(ctx context.Context, dl *DeadLetter) error
+}
+
+// DeliveryError is returned once an event is given up on
+type DeliveryError struct {
+	Attempts   int
+	StatusCode int
+	Err        error
+}
+
+func (de *DeliveryError) Error() string {
+	return fmt.Sprintf("delivery failed after %d attempts: %v", de.Attempts, de.Err)
+}
+
+// ErrNoTimeLeft is returned when the context deadline leaves no time for a request, the event is
+// left to the queue to redeliver
+var ErrNoTimeLeft = errors.New("no time left before the deadline to deliver the event")
+
+// Sign returns the signature header value of the body
+func Sign(secret string, timestamp int64, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, signature(secret, timestamp, body))
+}
+
+func signature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header against the body, rejecting timestamps older than the tolerance
+func Verify(secret, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var ts int64
+	var sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			ts, _ = strconv.ParseInt(v, 10, 64)
+		case "v1":
+			sig = v
+		}
+	}
+
+	if ts == 0 || sig == "" {
+		return errors.New("malformed signature header")
+	}
+	if now.Sub(time.Unix(ts, 0)) > tolerance {
+		return errors.New("signature timestamp is too old")
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, ts, body))) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// Dispatcher posts events to the subscribed endpoints, retrying with exponential backoff. A retry
+// is only made when its wait and request fit before the context deadline, e.g. the lambda timeout
+type Dispatcher struct {
+	Client      *http.Client
+	MaxAttempts int
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	Sleep       func(time.Duration)
+	Now         func() time.Time
+}
+
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 5,
+		BaseBackoff: time.Second,
+		MaxBackoff:  30 * time.Second,
+		Sleep:       time.Sleep,
+		Now:         time.Now,
+	}
+}
+
+// Dispatch delivers the event to every subscribed endpoint of its org, undelivered events go to the
+// dead letter store. Only store errors and ErrNoTimeLeft are returned, so the caller can retry the
+// whole event
+func (d *Dispatcher) Dispatch(ctx context.Context, store Store, ev *Event) error {
+	endpoints, err := store.Endpoints(ctx, ev.OrgID)
+	if err != nil {
+		return err
+	}
+
+	for _, ep := range endpoints {
+		if !ep.Subscribed(ev.Type) {
+			continue
+		}
+
+		err := d.Deliver(ctx, ep, ev)
+		if errors.Is(err, ErrNoTimeLeft) {
+			return err
+		}
+		var de *DeliveryError
+		if !errors.As(err, &de) {
+			continue
+		}
+
+		dl := &DeadLetter{
+			OrgID:      ev.OrgID,
+			ID:         ev.ID + ":" + ep.ID,
+			EndpointID: ep.ID,
+			URL:        ep.URL,
+			Event:      ev,
+			Attempts:   de.Attempts,
+			StatusCode: de.StatusCode,
+			LastError:  de.Err.Error(),
+			FailedAt:   d.Now().UTC(),
+		}
+		if err := store.PutDeadLetter(ctx, dl); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Deliver posts the signed event until the endpoint answers 2xx, a non retryable status, attempts
+// run out or the context deadline is too near for another one
+func (d *Dispatcher) Deliver(ctx context.Context, ep *Endpoint, ev *Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return &DeliveryError{Err: err}
+	}
+	if !d.hasTime(ctx, 0) {
+		return ErrNoTimeLeft
+	}
+
+	var lastErr error
+	var lastStatus int
+	attempt := 0
+
+	for attempt < d.MaxAttempts {
+		if attempt > 0 {
+			wait := d.backoff(attempt)
+			if !d.hasTime(ctx, wait) {
+				break
+			}
+			d.Sleep(wait)
+		}
+		attempt++
+
+		status, err := d.post(ctx, ep, ev, body)
+		if err == nil && status >= 200 && status < 300 {
+			return nil
+		}
+
+		lastStatus = status
+		lastErr = err
+		if err == nil {
+			lastErr = fmt.Errorf("endpoint responded with %d", status)
+			if !retryable(status) {
+				break
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return &DeliveryError{Attempts: attempt, StatusCode: lastStatus, Err: lastErr}
+}
+
+func (d *Dispatcher) post(ctx context.Context, ep *Endpoint, ev *Event, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ep.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventTypeHeader, ev.Type)
+	req.Header.Set(EventIDHeader, ev.ID)
+	req.Header.Set(SignatureHeader, Sign(ep.Secret, d.Now().Unix(), body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	return resp.StatusCode, nil
+}
+
+// hasTime tells if a request after the wait ends before the context deadline, a request taking
+// at most the client timeout
+func (d *Dispatcher) hasTime(ctx context.Context, wait time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return true
+	}
+	return deadline.Sub(d.Now()) > wait+d.Client.Timeout
+}
+
+// backoff doubles the wait per attempt, capped at MaxBackoff
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	wait := d.BaseBackoff << (attempt - 1)
+	if wait <= 0 || wait > d.MaxBackoff {
+		return d.MaxBackoff
+	}
+	return wait
+}
+
+// retryable tells if a failed status may succeed later, other 4xx are the receiver rejecting the event
+func retryable(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests || status == http.StatusRequestTimeout
+}
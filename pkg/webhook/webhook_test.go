@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeStore struct {
+	endpoints   []*Endpoint
+	deadLetters []*DeadLetter
+}
+
+func (f *fakeStore) Endpoints(ctx context.Context, orgID string) ([]*Endpoint, error) {
+	return f.endpoints, nil
+}
+
+func (f *fakeStore) PutDeadLetter(ctx context.Context, dl *DeadLetter) error {
+	f.deadLetters = append(f.deadLetters, dl)
+	return nil
+}
+
+func testDispatcher(sleeps *[]time.Duration) *Dispatcher {
+	d := NewDispatcher()
+	d.Sleep = func(w time.Duration) { *sleeps = append(*sleeps, w) }
+	return d
+}
+
+var testEvent = &Event{ID: "ev1", Type: EventJobCreated, OrgID: "org1", JobID: "job1"}
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Now()
+	body := []byte(`{"id":"ev1"}`)
+	header := Sign("s3cret", now.Unix(), body)
+
+	assert.NoError(t, Verify("s3cret", header, body, time.Minute, now))
+	assert.Error(t, Verify("other", header, body, time.Minute, now))
+	assert.Error(t, Verify("s3cret", header, []byte(`{"id":"ev2"}`), time.Minute, now))
+	assert.Error(t, Verify("s3cret", header, body, time.Minute, now.Add(time.Hour)))
+	assert.Error(t, Verify("s3cret", "garbage", body, time.Minute, now))
+}
+
+func TestDeliverRetriesUntilSuccess(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		assert.NoError(t, Verify("s3cret", r.Header.Get(SignatureHeader), body, time.Minute, time.Now()))
+		assert.Equal(t, EventJobCreated, r.Header.Get(EventTypeHeader))
+		assert.Equal(t, "ev1", r.Header.Get(EventIDHeader))
+
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	sleeps := make([]time.Duration, 0)
+	d := testDispatcher(&sleeps)
+
+	err := d.Deliver(context.Background(), &Endpoint{ID: "ep1", URL: srv.URL, Secret: "s3cret"}, testEvent)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), calls)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, sleeps)
+}
+
+func TestDispatchDeadLetters(t *testing.T) {
+	var failing, rejecting int32
+	failingSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failing, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failingSrv.Close()
+
+	rejectingSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&rejecting, 1)
+		w.WriteHeader(http.StatusGone)
+	}))
+	defer rejectingSrv.Close()
+
+	okSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer okSrv.Close()
+
+	store := &fakeStore{endpoints: []*Endpoint{
+		{ID: "failing", URL: failingSrv.URL},
+		{ID: "rejecting", URL: rejectingSrv.URL},
+		{ID: "ok", URL: okSrv.URL},
+		{ID: "unsubscribed", URL: failingSrv.URL, Events: []string{EventJobDeleted}},
+	}}
+
+	sleeps := make([]time.Duration, 0)
+	d := testDispatcher(&sleeps)
+	d.MaxBackoff = 3 * time.Second
+
+	assert.NoError(t, d.Dispatch(context.Background(), store, testEvent))
+
+	assert.Equal(t, int32(5), failing)
+	assert.Equal(t, int32(1), rejecting, "4xx responses are not retried")
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}, sleeps)
+
+	assert.Len(t, store.deadLetters, 2)
+	assert.Equal(t, "failing", store.deadLetters[0].EndpointID)
+	assert.Equal(t, 5, store.deadLetters[0].Attempts)
+	assert.Equal(t, http.StatusInternalServerError, store.deadLetters[0].StatusCode)
+	assert.Equal(t, "ev1:failing", store.deadLetters[0].ID)
+	assert.Equal(t, "rejecting", store.deadLetters[1].EndpointID)
+	assert.Equal(t, 1, store.deadLetters[1].Attempts)
+}
+
+func TestDeliverStopsBeforeDeadline(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	// the clock moves with the backoff sleeps only
+	now := time.Now()
+	sleeps := make([]time.Duration, 0)
+	d := NewDispatcher()
+	d.Now = func() time.Time { return now }
+	d.Sleep = func(w time.Duration) {
+		sleeps = append(sleeps, w)
+		now = now.Add(w)
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), now.Add(25*time.Second))
+	defer cancel()
+
+	err := d.Deliver(ctx, &Endpoint{ID: "ep1", URL: srv.URL}, testEvent)
+	var de *DeliveryError
+	assert.ErrorAs(t, err, &de)
+	assert.Equal(t, 4, de.Attempts, "the 8s wait and a 10s request don't fit in the 18s left")
+	assert.Equal(t, int32(4), calls)
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}, sleeps)
+
+	// without the time for a request the event is left to the queue
+	store := &fakeStore{endpoints: []*Endpoint{{ID: "ep1", URL: srv.URL}}}
+	ctx, cancel = context.WithDeadline(context.Background(), now.Add(5*time.Second))
+	defer cancel()
+
+	assert.ErrorIs(t, d.Dispatch(ctx, store, testEvent), ErrNoTimeLeft)
+	assert.Empty(t, store.deadLetters)
+	assert.Equal(t, int32(4), calls)
+}